@@ -0,0 +1,97 @@
+// Package audit records who changed what in an append-only log.
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"smarapp-api/models"
+	"time"
+)
+
+// Execer is satisfied by both *sql.DB and *sql.Tx, so events can be recorded
+// in the transaction of the change they describe
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Event describes a single change. Before and After are snapshots of the
+// target, nil when it was created or deleted; only the fields that differ
+// are stored.
+type Event struct {
+	ActorID        *int
+	ImpersonatorID *int
+	Action         string
+	TargetType     string
+	TargetID       string
+	Before         interface{}
+	After          interface{}
+	RequestID      string
+	IPAddress      string
+}
+
+// Record stores an event. Times are stored in UTC so that time ranges can be
+// compared in SQL.
+func Record(db Execer, event Event) error {
+	changes, err := Diff(event.Before, event.After)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO audit_events (actor_id, impersonator_id, action, target_type, target_id, changes, request_id, ip_address, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		event.ActorID, event.ImpersonatorID, event.Action, event.TargetType, event.TargetID,
+		string(data), event.RequestID, event.IPAddress, time.Now().UTC(),
+	)
+	return err
+}
+
+// Diff compares two snapshots field by field, using their JSON form. A nil
+// snapshot counts as having no fields.
+func Diff(before, after interface{}) (map[string]models.AuditChange, error) {
+	beforeFields, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]models.AuditChange{}
+	for name, value := range beforeFields {
+		if other, ok := afterFields[name]; !ok || !reflect.DeepEqual(value, other) {
+			changes[name] = models.AuditChange{Before: value, After: afterFields[name]}
+		}
+	}
+	for name, value := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			changes[name] = models.AuditChange{After: value}
+		}
+	}
+
+	return changes, nil
+}
+
+func fields(snapshot interface{}) (map[string]interface{}, error) {
+	if snapshot == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("audit snapshot must be an object: %w", err)
+	}
+	return result, nil
+}
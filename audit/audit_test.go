@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"smarapp-api/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type snapshot struct {
+	Name  string   `json:"name"`
+	Price float64  `json:"price"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   interface{}
+		after    interface{}
+		expected map[string]models.AuditChange
+	}{
+		{
+			name:   "update keeps only changed fields",
+			before: snapshot{Name: "Lamp", Price: 10, Tags: []string{"home"}},
+			after:  snapshot{Name: "Lamp", Price: 12.5, Tags: []string{"home"}},
+			expected: map[string]models.AuditChange{
+				"price": {Before: 10.0, After: 12.5},
+			},
+		},
+		{
+			name:   "create lists every field as added",
+			before: nil,
+			after:  snapshot{Name: "Lamp", Price: 10},
+			expected: map[string]models.AuditChange{
+				"name":  {After: "Lamp"},
+				"price": {After: 10.0},
+			},
+		},
+		{
+			name:   "delete lists every field as removed",
+			before: snapshot{Name: "Lamp", Price: 10},
+			after:  nil,
+			expected: map[string]models.AuditChange{
+				"name":  {Before: "Lamp"},
+				"price": {Before: 10.0},
+			},
+		},
+		{
+			name:   "removed optional field",
+			before: snapshot{Name: "Lamp", Tags: []string{"home"}},
+			after:  snapshot{Name: "Lamp"},
+			expected: map[string]models.AuditChange{
+				"tags": {Before: []interface{}{"home"}},
+			},
+		},
+		{
+			name:     "no snapshots",
+			expected: map[string]models.AuditChange{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := Diff(tt.before, tt.after)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, changes)
+		})
+	}
+}
+
+func TestDiff_RejectsNonObjects(t *testing.T) {
+	_, err := Diff("not an object", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"smarapp-api/config"
+	"smarapp-api/database"
+	"smarapp-api/handlers"
+	"smarapp-api/middleware"
+	"smarapp-api/models"
+	"smarapp-api/password"
+	"time"
+)
+
+// runCommand executes a maintenance subcommand instead of starting the server
+func runCommand(args []string, cfg *config.Config, passwords password.Hasher, policy *password.Policy) error {
+	switch args[0] {
+	case "create-admin":
+		return createAdminCommand(args[1:], passwords, policy)
+	case "generate-signing-key":
+		return generateSigningKeyCommand(args[1:])
+	case "rebuild-search-index":
+		return rebuildSearchIndexCommand()
+	case "reconcile-inventory":
+		return reconcileInventoryCommand(args[1:])
+	case "purge-products":
+		return purgeProductsCommand(args[1:], cfg)
+	default:
+		return fmt.Errorf("unknown command %q (available: create-admin, generate-signing-key, rebuild-search-index, reconcile-inventory, purge-products)", args[0])
+	}
+}
+
+// createAdminCommand bootstraps an admin account, since the public API only
+// grants the admin role through invites issued by an existing admin.
+func createAdminCommand(args []string, passwords password.Hasher, policy *password.Policy) error {
+	fs := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	username := fs.String("username", "", "admin username (3-50 characters)")
+	email := fs.String("email", "", "admin email")
+	plainPassword := fs.String("password", os.Getenv("ADMIN_PASSWORD"), "admin password (defaults to $ADMIN_PASSWORD)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if len(*username) < 3 || len(*username) > 50 {
+		return errors.New("username must be between 3 and 50 characters")
+	}
+	if _, err := mail.ParseAddress(*email); err != nil {
+		return errors.New("a valid email is required")
+	}
+	if err := policy.Check(*plainPassword); err != nil {
+		return err
+	}
+
+	var existingID int
+	err := database.DB.QueryRow("SELECT id FROM users WHERE email = ? OR username = ?", *email, *username).Scan(&existingID)
+	if err != sql.ErrNoRows {
+		if err != nil {
+			return err
+		}
+		return errors.New("user with this email or username already exists")
+	}
+
+	hashedPassword, err := passwords.Hash(*plainPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	result, err := database.DB.Exec(
+		"INSERT INTO users (username, email, password, role, email_verified_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		*username, *email, hashedPassword, models.RoleAdmin, time.Now(), time.Now(), time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	userID, _ := result.LastInsertId()
+	fmt.Printf("Admin user %s created (ID: %d)\n", *username, userID)
+	return nil
+}
+
+// generateSigningKeyCommand writes a new private key to JWT_KEYS_DIR. The key
+// is published in the JWKS right away but only signs tokens once
+// JWT_SIGNING_KEY_ID points at it.
+func generateSigningKeyCommand(args []string) error {
+	fs := flag.NewFlagSet("generate-signing-key", flag.ContinueOnError)
+	dir := fs.String("dir", os.Getenv("JWT_KEYS_DIR"), "key directory (defaults to $JWT_KEYS_DIR)")
+	alg := fs.String("alg", "EdDSA", "key algorithm (EdDSA or RS256)")
+	kid := fs.String("id", "", "key ID (defaults to the current date and a random suffix)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *dir == "" {
+		return errors.New("a key directory is required")
+	}
+
+	if *kid == "" {
+		suffix, err := middleware.NewTokenID()
+		if err != nil {
+			return err
+		}
+		*kid = time.Now().Format("2006-01-02") + "-" + suffix[:8]
+	}
+
+	var key crypto.Signer
+	var err error
+	switch *alg {
+	case "EdDSA":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case "RS256":
+		key, err = rsa.GenerateKey(rand.Reader, 3072)
+	default:
+		return fmt.Errorf("unsupported algorithm %q (use EdDSA or RS256)", *alg)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*dir, 0o700); err != nil {
+		return err
+	}
+
+	path := filepath.Join(*dir, *kid+".pem")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s key %s written to %s\n", *alg, *kid, path)
+	return nil
+}
+
+// rebuildSearchIndexCommand re-indexes all products for full-text search
+func rebuildSearchIndexCommand() error {
+	if err := database.RebuildProductSearchIndex(); err != nil {
+		return err
+	}
+
+	var count int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM products").Scan(&count); err != nil {
+		return err
+	}
+	fmt.Printf("Search index rebuilt (%d products)\n", count)
+	return nil
+}
+
+// reconcileInventoryCommand reports products and variants whose stock does
+// not add up to their inventory ledger, and with -fix resets them to it
+func reconcileInventoryCommand(args []string) error {
+	fs := flag.NewFlagSet("reconcile-inventory", flag.ContinueOnError)
+	fix := fs.Bool("fix", false, "set drifted stock to the ledger sum")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	drift, err := database.InventoryDrift()
+	if err != nil {
+		return err
+	}
+	if len(drift) == 0 {
+		fmt.Println("Inventory is in sync with the ledger")
+		return nil
+	}
+
+	for _, d := range drift {
+		item := fmt.Sprintf("product %d (%s)", d.ProductID, d.Name)
+		if d.VariantID != nil {
+			item = fmt.Sprintf("variant %d (%s) of product %d", *d.VariantID, d.Name, d.ProductID)
+		}
+		fmt.Printf("%s: stock %d, ledger %d, drift %+d\n", item, d.Stock, d.LedgerStock, d.Stock-d.LedgerStock)
+	}
+
+	if !*fix {
+		return fmt.Errorf("%d items drifted from the ledger, run with -fix to reset them", len(drift))
+	}
+	if err := database.FixInventoryDrift(); err != nil {
+		return err
+	}
+	fmt.Printf("Reset %d items to the ledger\n", len(drift))
+	return nil
+}
+
+// purgeProductsCommand removes products that have been in the trash for
+// longer than -older-than, except those that were ordered
+func purgeProductsCommand(args []string, cfg *config.Config) error {
+	fs := flag.NewFlagSet("purge-products", flag.ContinueOnError)
+	olderThan := fs.Duration("older-than", 30*24*time.Hour, "only purge products deleted at least this long ago")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *olderThan < 0 {
+		return errors.New("-older-than cannot be negative")
+	}
+
+	blobs, err := newBlobStore(cfg)
+	if err != nil {
+		return fmt.Errorf("invalid storage settings: %w", err)
+	}
+	productHandler := handlers.NewProductHandler()
+	productHandler.Images = blobs
+
+	purged, err := productHandler.PurgeDeletedProducts(time.Now().Add(-*olderThan))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Purged %d deleted products\n", purged)
+	return nil
+}
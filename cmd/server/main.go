@@ -1,18 +1,28 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"os"
 	"smarapp-api/config"
 	"smarapp-api/database"
 	_ "smarapp-api/docs"
 	"smarapp-api/handlers"
+	"smarapp-api/mailer"
 	"smarapp-api/middleware"
+	"smarapp-api/models"
+	"smarapp-api/oidc"
+	"smarapp-api/password"
+	"smarapp-api/storage"
 	"smarapp-api/websocket"
+	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // @title SmarApp API
@@ -34,48 +44,123 @@ import (
 // @securityDefinitions.apikey BearerAuth
 // @in header
 // @name Authorization
-// @description Type "Bearer" followed by a space and JWT token.
+// @description Type "Bearer" followed by a space and JWT token, or "ApiKey" followed by a space and an API key.
 
 func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
 
+	// Password hashing and policy, also used by create-admin
+	passwords, err := newPasswordHasher(cfg)
+	if err != nil {
+		log.Fatalf("Invalid password hashing settings: %v", err)
+	}
+	passwordPolicy, err := newPasswordPolicy(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load password policy: %v", err)
+	}
+
 	// Initialize database
 	if err := database.InitDB(cfg.DatabaseURL); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer database.CloseDB()
 
+	// Maintenance subcommands, e.g. `server create-admin -username ... -email ...`
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:], cfg, passwords, passwordPolicy); err != nil {
+			log.Fatalf("Command failed: %v", err)
+		}
+		return
+	}
+
 	// Initialize WebSocket hub
 	hub := websocket.NewHub()
 	go hub.Run()
 
+	// Load token signing keys
+	keys, err := loadKeySet(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+
+	// Product images
+	blobs, err := newBlobStore(cfg)
+	if err != nil {
+		log.Fatalf("Invalid storage settings: %v", err)
+	}
+
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(cfg.JWTSecret)
+	authHandler.Keys = keys
+	authHandler.AccessTokenTTL = cfg.AccessTokenTTL
+	authHandler.RefreshTokenTTL = cfg.RefreshTokenTTL
+	authHandler.Mailer = newMailer(cfg)
+	authHandler.PublicURL = cfg.PublicURL
+	authHandler.PasswordResetURL = cfg.PasswordResetURL
+	authHandler.Passwords = passwords
+	authHandler.PasswordPolicy = passwordPolicy
+	for _, provider := range cfg.OIDCProviders {
+		authHandler.OIDCProviders[provider.Name] = &oidc.Provider{
+			Name:         provider.Name,
+			IssuerURL:    provider.IssuerURL,
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			RedirectURL:  strings.TrimSuffix(cfg.PublicURL, "/") + "/api/v1/auth/oidc/callback",
+			Scopes:       provider.Scopes,
+		}
+	}
 	productHandler := handlers.NewProductHandler()
+	productHandler.Images = blobs
+	productHandler.MaxImageSize = int64(cfg.MaxImageBytes)
+	categoryHandler := handlers.NewCategoryHandler()
+	tagHandler := handlers.NewTagHandler()
 	orderHandler := handlers.NewOrderHandler()
+	orderHandler.RequireVerifiedEmail = cfg.RequireVerifiedEmail
+	inviteHandler := handlers.NewInviteHandler()
+	userHandler := handlers.NewUserHandler()
+	settingsHandler := handlers.NewSettingsHandler()
+	roleHandler := handlers.NewRoleHandler()
 	chatHandler := handlers.NewChatHandler(hub)
+	auditHandler := handlers.NewAuditHandler()
 
 	// Setup Gin router
 	r := gin.Default()
 
+	// Client IPs drive login throttling, so X-Forwarded-For is only honored
+	// from configured proxies
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// CORS middleware - Allow all origins for development
 	r.Use(cors.New(cors.Config{
 		AllowOriginFunc: func(origin string) bool {
 			return true // Allow all origins
 		},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-Requested-With"},
-		ExposeHeaders:    []string{"Content-Length", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-Requested-With", "If-Match", "If-None-Match", middleware.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", "Authorization", "ETag", middleware.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * 3600, // 12 hours
 	}))
 
+	// Tag every request with an ID so audit events can be traced back to it
+	r.Use(middleware.RequestID())
+
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	// Public keys for services verifying our tokens
+	r.GET("/.well-known/jwks.json", middleware.JWKSHandler(keys))
+
+	// Uploaded images, when kept on local disk
+	if local, ok := blobs.(*storage.LocalStore); ok {
+		r.Static("/media", local.Dir())
+	}
+
 	// Swagger documentation
 	r.GET("/docs/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
@@ -87,30 +172,91 @@ func main() {
 		{
 			auth.POST("/register", authHandler.Register)
 			auth.POST("/login", authHandler.Login)
+			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/forgot-password", authHandler.ForgotPassword)
+			auth.POST("/reset-password", authHandler.ResetPassword)
+			auth.GET("/verify-email", authHandler.VerifyEmail)
+			auth.POST("/2fa/verify", authHandler.VerifyTwoFactor)
+			auth.GET("/oidc/login", authHandler.OIDCLogin)
+			auth.GET("/oidc/callback", authHandler.OIDCCallback)
 		}
 
 		// Public product routes
 		products := api.Group("/products")
 		{
 			products.GET("", productHandler.GetProducts)
+			products.GET("/search", productHandler.SearchProducts)
 			products.GET("/:id", productHandler.GetProduct)
+			products.GET("/:id/variants", productHandler.GetProductVariants)
 		}
+
+		// Public catalog browsing
+		categories := api.Group("/categories")
+		{
+			categories.GET("", categoryHandler.ListCategories)
+			categories.GET("/:slug/products", categoryHandler.GetCategoryProducts)
+		}
+		api.GET("/tags", tagHandler.ListTags)
 	}
 
 	// Protected routes
 	protected := api.Group("/")
-	protected.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+	protected.Use(middleware.AuthMiddlewareWithKeys(keys))
 	{
+		// Session management
+		protected.POST("/auth/logout", authHandler.Logout)
+
 		// User profile
 		protected.GET("/profile", authHandler.GetProfile)
+		protected.POST("/profile/verify-email", authHandler.ResendVerification)
 
-		// Product management (admin only)
+		// Account credentials can only be changed from a login session, not with an API key
+		account := protected.Group("/profile")
+		account.Use(middleware.SessionOnly())
+		{
+			account.PATCH("", authHandler.UpdateProfile)
+			account.DELETE("", authHandler.DeleteProfile)
+			account.POST("/password", authHandler.ChangePassword)
+			account.POST("/2fa/setup", authHandler.SetupTwoFactor)
+			account.POST("/2fa/enable", authHandler.EnableTwoFactor)
+			account.POST("/2fa/disable", authHandler.DisableTwoFactor)
+			account.POST("/api-keys", authHandler.CreateAPIKey)
+			account.GET("/api-keys", authHandler.ListAPIKeys)
+			account.DELETE("/api-keys/:id", authHandler.RevokeAPIKey)
+			account.GET("/sessions", authHandler.ListSessions)
+			account.DELETE("/sessions/:id", authHandler.RevokeSession)
+		}
+
+		// Product management
 		adminProducts := protected.Group("/products")
-		adminProducts.Use(middleware.AdminMiddleware())
+		adminProducts.Use(middleware.RequirePermission(models.PermissionProductsWrite))
 		{
 			adminProducts.POST("", productHandler.CreateProduct)
 			adminProducts.PUT("/:id", productHandler.UpdateProduct)
+			adminProducts.PATCH("/:id", productHandler.PatchProduct)
 			adminProducts.DELETE("/:id", productHandler.DeleteProduct)
+			adminProducts.PUT("/:id/options", productHandler.SetProductOptions)
+			adminProducts.POST("/:id/variants", productHandler.CreateVariant)
+			adminProducts.PUT("/:id/variants/:variant_id", productHandler.UpdateVariant)
+			adminProducts.DELETE("/:id/variants/:variant_id", productHandler.DeleteVariant)
+			adminProducts.POST("/:id/images", productHandler.UploadProductImage)
+			adminProducts.PUT("/:id/images/order", productHandler.ReorderProductImages)
+			adminProducts.DELETE("/:id/images/:image_id", productHandler.DeleteProductImage)
+		}
+
+		// Category, tag, inventory and trash management
+		adminCatalog := protected.Group("/admin")
+		adminCatalog.Use(middleware.RequirePermission(models.PermissionProductsWrite))
+		{
+			adminCatalog.POST("/categories", categoryHandler.CreateCategory)
+			adminCatalog.PUT("/categories/:id", categoryHandler.UpdateCategory)
+			adminCatalog.DELETE("/categories/:id", categoryHandler.DeleteCategory)
+			adminCatalog.POST("/tags", tagHandler.CreateTag)
+			adminCatalog.PUT("/tags/:id", tagHandler.UpdateTag)
+			adminCatalog.DELETE("/tags/:id", tagHandler.DeleteTag)
+			adminCatalog.GET("/products/:id/inventory", productHandler.GetProductInventory)
+			adminCatalog.POST("/products/:id/inventory", productHandler.RecordInventoryMovement)
+			adminCatalog.POST("/products/:id/restore", productHandler.RestoreProduct)
 		}
 
 		// Order management
@@ -123,16 +269,84 @@ func main() {
 
 		// Admin order management
 		adminOrders := protected.Group("/admin/orders")
-		adminOrders.Use(middleware.AdminMiddleware())
+		adminOrders.Use(middleware.RequirePermission(models.PermissionOrdersReadAll))
 		{
 			adminOrders.GET("", orderHandler.GetAllOrders)
 		}
 
+		// Admin invite management
+		adminInvites := protected.Group("/admin/invites")
+		adminInvites.Use(middleware.RequirePermission(models.PermissionInvitesManage))
+		{
+			adminInvites.POST("", inviteHandler.CreateInvite)
+			adminInvites.GET("", inviteHandler.GetInvites)
+			adminInvites.DELETE("/:id", inviteHandler.DeleteInvite)
+		}
+
+		// Admin user management
+		adminUsers := protected.Group("/admin/users")
+		adminUsers.Use(middleware.RequirePermission(models.PermissionUsersRead))
+		{
+			usersWrite := middleware.RequirePermission(models.PermissionUsersWrite)
+			adminUsers.GET("", userHandler.ListUsers)
+			adminUsers.GET("/:id", userHandler.GetUser)
+			adminUsers.PUT("/:id/role", usersWrite, userHandler.UpdateUserRole)
+			adminUsers.POST("/:id/suspend", usersWrite, userHandler.SuspendUser)
+			adminUsers.POST("/:id/unsuspend", usersWrite, userHandler.UnsuspendUser)
+			adminUsers.POST("/:id/unlock", usersWrite, userHandler.UnlockUser)
+			adminUsers.DELETE("/:id", usersWrite, userHandler.DeleteUser)
+			adminUsers.GET("/:id/sessions", userHandler.ListUserSessions)
+			adminUsers.DELETE("/:id/sessions", usersWrite, userHandler.RevokeUserSessions)
+			adminUsers.POST("/:id/impersonate", middleware.RequirePermission(models.PermissionUsersImpersonate), authHandler.ImpersonateUser)
+		}
+
+		// Admin impersonation audit log
+		adminImpersonations := protected.Group("/admin/impersonation-events")
+		adminImpersonations.Use(middleware.RequirePermission(models.PermissionUsersRead))
+		{
+			adminImpersonations.GET("", userHandler.ListImpersonationEvents)
+		}
+
+		// Admin audit log of data changes
+		adminAudit := protected.Group("/admin/audit")
+		adminAudit.Use(middleware.RequirePermission(models.PermissionAuditRead))
+		{
+			adminAudit.GET("", auditHandler.ListAuditEvents)
+			adminAudit.GET("/export", auditHandler.ExportAuditEvents)
+		}
+
+		// Admin login attempt review
+		adminLoginAttempts := protected.Group("/admin/login-attempts")
+		adminLoginAttempts.Use(middleware.RequirePermission(models.PermissionUsersRead))
+		{
+			adminLoginAttempts.GET("", userHandler.ListLoginAttempts)
+		}
+
+		// Admin security settings
+		adminSettings := protected.Group("/admin/settings")
+		adminSettings.Use(middleware.RequirePermission(models.PermissionSettingsManage))
+		{
+			adminSettings.GET("/security", settingsHandler.GetSecuritySettings)
+			adminSettings.PUT("/security", settingsHandler.UpdateSecuritySettings)
+		}
+
+		// Admin role management
+		adminRoles := protected.Group("/admin")
+		adminRoles.Use(middleware.RequirePermission(models.PermissionRolesManage))
+		{
+			adminRoles.GET("/permissions", roleHandler.ListPermissions)
+			adminRoles.GET("/roles", roleHandler.ListRoles)
+			adminRoles.POST("/roles", roleHandler.CreateRole)
+			adminRoles.PUT("/roles/:name", roleHandler.UpdateRole)
+			adminRoles.DELETE("/roles/:name", roleHandler.DeleteRole)
+		}
+
 		// Chat routes
 		chat := protected.Group("/chat")
 		{
 			chat.GET("/ws", chatHandler.HandleWebSocket)
 			chat.GET("/history", chatHandler.GetChatHistory)
+			chat.DELETE("/messages/:id", middleware.RequirePermission(models.PermissionChatModerate), chatHandler.DeleteMessage)
 		}
 	}
 
@@ -141,3 +355,93 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// loadKeySet signs with HS256 and JWT_SECRET unless JWT_KEYS_DIR holds
+// asymmetric keys. HS256 tokens keep being accepted during the migration
+// until JWT_ACCEPT_HS256 is turned off.
+func loadKeySet(cfg *config.Config) (*middleware.KeySet, error) {
+	if cfg.JWTKeysDir == "" {
+		return middleware.NewHMACKeySet(cfg.JWTSecret), nil
+	}
+
+	hmacSecret := ""
+	if cfg.JWTAcceptHS256 {
+		hmacSecret = cfg.JWTSecret
+	}
+	return middleware.LoadKeySet(cfg.JWTKeysDir, cfg.JWTSigningKeyID, hmacSecret)
+}
+
+// newPasswordHasher hashes new passwords with the configured algorithm.
+// Hashes of the other supported algorithm are still accepted and replaced
+// on the next login.
+func newPasswordHasher(cfg *config.Config) (password.Hasher, error) {
+	if cfg.Argon2Memory < 1 || cfg.Argon2Iterations < 1 || cfg.Argon2Parallelism < 1 || cfg.Argon2Parallelism > 255 {
+		return nil, errors.New("ARGON2_MEMORY_KIB, ARGON2_ITERATIONS and ARGON2_PARALLELISM must be positive (parallelism at most 255)")
+	}
+	if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	argon2id := password.DefaultArgon2id()
+	argon2id.Memory = uint32(cfg.Argon2Memory)
+	argon2id.Iterations = uint32(cfg.Argon2Iterations)
+	argon2id.Parallelism = uint8(cfg.Argon2Parallelism)
+	bcryptHasher := password.Bcrypt{Cost: cfg.BcryptCost}
+
+	switch cfg.PasswordHashAlgorithm {
+	case "argon2id":
+		return password.Chain{argon2id, bcryptHasher}, nil
+	case "bcrypt":
+		return password.Chain{bcryptHasher, argon2id}, nil
+	default:
+		return nil, fmt.Errorf("unsupported PASSWORD_HASH_ALGORITHM %q (use argon2id or bcrypt)", cfg.PasswordHashAlgorithm)
+	}
+}
+
+func newPasswordPolicy(cfg *config.Config) (*password.Policy, error) {
+	policy := &password.Policy{
+		MinLength: cfg.PasswordMinLength,
+		MaxLength: cfg.PasswordMaxLength,
+	}
+	if cfg.BreachedPasswordsFile != "" {
+		breached, err := password.LoadBreachedList(cfg.BreachedPasswordsFile)
+		if err != nil {
+			return nil, err
+		}
+		policy.Breached = breached
+		log.Printf("Loaded %d breached passwords", len(breached))
+	}
+	return policy, nil
+}
+
+func newBlobStore(cfg *config.Config) (storage.BlobStore, error) {
+	switch cfg.StorageBackend {
+	case "local":
+		return storage.NewLocalStore(cfg.MediaDir, strings.TrimSuffix(cfg.PublicURL, "/")+"/media"), nil
+	case "s3":
+		if cfg.S3Endpoint == "" || cfg.S3Bucket == "" || cfg.S3AccessKeyID == "" || cfg.S3SecretAccessKey == "" {
+			return nil, errors.New("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required")
+		}
+		return storage.NewS3Store(storage.S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			PublicURL:       cfg.S3PublicURL,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", cfg.StorageBackend)
+	}
+}
+
+// newMailer sends through SMTP when configured and otherwise writes emails
+// to MAIL_DIR so they can be read during development
+func newMailer(cfg *config.Config) mailer.Mailer {
+	if cfg.SMTPHost != "" {
+		return mailer.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	}
+
+	log.Printf("SMTP_HOST not set, writing emails to %s", cfg.MailDir)
+	return mailer.NewFileMailer(cfg.MailDir, cfg.MailFrom)
+}
@@ -2,20 +2,126 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Port        string
-	DatabaseURL string
-	JWTSecret   string
+	Port            string
+	DatabaseURL     string
+	JWTSecret       string
+	JWTKeysDir      string
+	JWTSigningKeyID string
+	JWTAcceptHS256  bool
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	TrustedProxies  []string
+
+	PasswordHashAlgorithm string
+	Argon2Memory          int
+	Argon2Iterations      int
+	Argon2Parallelism     int
+	BcryptCost            int
+	PasswordMinLength     int
+	PasswordMaxLength     int
+	BreachedPasswordsFile string
+
+	PublicURL            string
+	PasswordResetURL     string
+	RequireVerifiedEmail bool
+
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+	MailDir      string
+
+	OIDCProviders []OIDCProviderConfig
+
+	StorageBackend    string
+	MediaDir          string
+	MaxImageBytes     int
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3PublicURL       string
+}
+
+// OIDCProviderConfig registers this API as a client of an OpenID Connect provider
+type OIDCProviderConfig struct {
+	Name         string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
 }
 
 func LoadConfig() *Config {
 	return &Config{
-		Port:        getEnv("PORT", "8080"),
-		DatabaseURL: getEnv("DATABASE_URL", "./smarapp.db"),
-		JWTSecret:   getEnv("JWT_SECRET", "your-secret-key-change-this-in-production"),
+		Port:            getEnv("PORT", "8080"),
+		DatabaseURL:     getEnv("DATABASE_URL", "./smarapp.db"),
+		JWTSecret:       getEnv("JWT_SECRET", "your-secret-key-change-this-in-production"),
+		JWTKeysDir:      getEnv("JWT_KEYS_DIR", ""),
+		JWTSigningKeyID: getEnv("JWT_SIGNING_KEY_ID", ""),
+		JWTAcceptHS256:  getEnvBool("JWT_ACCEPT_HS256", true),
+		AccessTokenTTL:  getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getEnvDuration("REFRESH_TOKEN_TTL", 7*24*time.Hour),
+		TrustedProxies:  getEnvList("TRUSTED_PROXIES"),
+
+		PasswordHashAlgorithm: getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+		Argon2Memory:          getEnvInt("ARGON2_MEMORY_KIB", 19*1024),
+		Argon2Iterations:      getEnvInt("ARGON2_ITERATIONS", 2),
+		Argon2Parallelism:     getEnvInt("ARGON2_PARALLELISM", 1),
+		BcryptCost:            getEnvInt("BCRYPT_COST", 10),
+		PasswordMinLength:     getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordMaxLength:     getEnvInt("PASSWORD_MAX_LENGTH", 128),
+		BreachedPasswordsFile: getEnv("BREACHED_PASSWORDS_FILE", ""),
+
+		PublicURL:            getEnv("PUBLIC_URL", "http://localhost:8080"),
+		PasswordResetURL:     getEnv("PASSWORD_RESET_URL", ""),
+		RequireVerifiedEmail: getEnvBool("REQUIRE_VERIFIED_EMAIL", false),
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		MailFrom:     getEnv("MAIL_FROM", "noreply@localhost"),
+		MailDir:      getEnv("MAIL_DIR", "./mail"),
+
+		OIDCProviders: loadOIDCProviders(),
+
+		StorageBackend:    getEnv("STORAGE_BACKEND", "local"),
+		MediaDir:          getEnv("MEDIA_DIR", "./media"),
+		MaxImageBytes:     getEnvInt("MAX_IMAGE_BYTES", 5<<20),
+		S3Endpoint:        getEnv("S3_ENDPOINT", ""),
+		S3Region:          getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:          getEnv("S3_BUCKET", ""),
+		S3AccessKeyID:     getEnv("S3_ACCESS_KEY_ID", ""),
+		S3SecretAccessKey: getEnv("S3_SECRET_ACCESS_KEY", ""),
+		S3PublicURL:       getEnv("S3_PUBLIC_URL", ""),
+	}
+}
+
+// loadOIDCProviders reads the providers named in OIDC_PROVIDERS (e.g.
+// "corp,google") from OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID,
+// OIDC_<NAME>_CLIENT_SECRET and OIDC_<NAME>_SCOPES
+func loadOIDCProviders() []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range getEnvList("OIDC_PROVIDERS") {
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		providers = append(providers, OIDCProviderConfig{
+			Name:         name,
+			IssuerURL:    getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			Scopes:       getEnvList(prefix + "SCOPES"),
+		})
 	}
+	return providers
 }
 
 func getEnv(key, defaultValue string) string {
@@ -24,3 +130,41 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+// getEnvList splits a comma-separated variable, returning nil when unset
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
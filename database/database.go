@@ -31,6 +31,30 @@ func InitDB(dataSourceName string) error {
 		return fmt.Errorf("failed to create tables: %w", err)
 	}
 
+	if err = migrateTables(); err != nil {
+		return fmt.Errorf("failed to migrate tables: %w", err)
+	}
+
+	if err = createIndexes(); err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+
+	if err = createTriggers(); err != nil {
+		return fmt.Errorf("failed to create triggers: %w", err)
+	}
+
+	if err = createSearchIndex(); err != nil {
+		return fmt.Errorf("failed to create search index: %w", err)
+	}
+
+	if err = seedRoles(); err != nil {
+		return fmt.Errorf("failed to seed roles: %w", err)
+	}
+
+	if err = SeedInventoryLedger(); err != nil {
+		return fmt.Errorf("failed to seed inventory ledger: %w", err)
+	}
+
 	log.Println("Database initialized successfully")
 	return nil
 }
@@ -44,34 +68,50 @@ func createTables() error {
 		email TEXT UNIQUE NOT NULL,
 		password TEXT NOT NULL,
 		role TEXT NOT NULL DEFAULT 'user',
+		suspended_at DATETIME,
+		deleted_at DATETIME,
+		tokens_valid_after DATETIME,
+		email_verified_at DATETIME,
+		totp_secret TEXT,
+		totp_enabled_at DATETIME,
+		totp_last_counter INTEGER,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);`
 
-	// Products table
+	// Products table. Prices are integers in the minor unit of the currency,
+	// such as cents. deleted_at is set while a product is in the trash.
 	productsTable := `
 	CREATE TABLE IF NOT EXISTS products (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		name TEXT NOT NULL,
 		description TEXT NOT NULL,
-		price REAL NOT NULL,
+		price INTEGER NOT NULL,
+		currency TEXT NOT NULL DEFAULT 'USD',
 		stock INTEGER NOT NULL DEFAULT 0,
 		created_by INTEGER NOT NULL,
+		version INTEGER NOT NULL DEFAULT 1,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		deleted_at DATETIME,
 		FOREIGN KEY (created_by) REFERENCES users(id)
 	);`
 
-	// Orders table
+	// Orders table. variant_id and sku record the variant bought, if any; they
+	// are not a foreign key so variants can be removed without losing history.
 	ordersTable := `
 	CREATE TABLE IF NOT EXISTS orders (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		user_id INTEGER NOT NULL,
 		product_id INTEGER NOT NULL,
 		quantity INTEGER NOT NULL,
-		price REAL NOT NULL,
-		total REAL NOT NULL,
+		price INTEGER NOT NULL,
+		total INTEGER NOT NULL,
+		currency TEXT NOT NULL DEFAULT 'USD',
 		status TEXT NOT NULL DEFAULT 'pending',
+		variant_id INTEGER,
+		sku TEXT NOT NULL DEFAULT '',
+		version INTEGER NOT NULL DEFAULT 1,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (user_id) REFERENCES users(id),
@@ -89,7 +129,339 @@ func createTables() error {
 		FOREIGN KEY (user_id) REFERENCES users(id)
 	);`
 
-	tables := []string{usersTable, productsTable, ordersTable, chatTable}
+	// Refresh tokens table. Tokens issued from the same login share a
+	// family_id so a reused (already rotated) token can revoke the whole chain.
+	refreshTokensTable := `
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		family_id TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME,
+		replaced_by INTEGER,
+		mfa INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	// Login sessions, one per refresh token family. Access tokens carry the
+	// session id so signing a device out also rejects its access tokens.
+	sessionsTable := `
+	CREATE TABLE IF NOT EXISTS sessions (
+		id TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		user_agent TEXT NOT NULL DEFAULT '',
+		ip_address TEXT NOT NULL DEFAULT '',
+		mfa INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_seen_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	// Revoked access tokens (jti denylist), kept until the token would have expired
+	revokedTokensTable := `
+	CREATE TABLE IF NOT EXISTS revoked_tokens (
+		jti TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Invites table. Codes are stored hashed and can be redeemed once.
+	invitesTable := `
+	CREATE TABLE IF NOT EXISTS invites (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		code_hash TEXT UNIQUE NOT NULL,
+		role TEXT NOT NULL,
+		email TEXT,
+		created_by INTEGER NOT NULL,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		used_by INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (created_by) REFERENCES users(id),
+		FOREIGN KEY (used_by) REFERENCES users(id)
+	);`
+
+	// Single-use password reset, email verification and two-factor challenge
+	// tokens. The tokens themselves are signed JWTs, only their jti is stored.
+	accountTokensTable := `
+	CREATE TABLE IF NOT EXISTS account_tokens (
+		jti TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		purpose TEXT NOT NULL,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	// Two-factor recovery codes, stored hashed and usable once
+	recoveryCodesTable := `
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		code_hash TEXT NOT NULL,
+		used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	// Runtime settings changed by admins through the API
+	settingsTable := `
+	CREATE TABLE IF NOT EXISTS settings (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Every login attempt, kept for review
+	loginAttemptsTable := `
+	CREATE TABLE IF NOT EXISTS login_attempts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		email TEXT NOT NULL,
+		ip_address TEXT NOT NULL,
+		user_id INTEGER,
+		success BOOLEAN NOT NULL,
+		reason TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	// Consecutive login failures and lockouts per account ("email:...") and
+	// per client IP ("ip:...")
+	loginThrottlesTable := `
+	CREATE TABLE IF NOT EXISTS login_throttles (
+		key TEXT PRIMARY KEY,
+		failures INTEGER NOT NULL DEFAULT 0,
+		last_failure_at DATETIME NOT NULL,
+		locked_until DATETIME
+	);`
+
+	// Personal API keys for machine clients. Only the SHA-256 hash of a key is
+	// stored, the prefix stays readable so users can tell keys apart.
+	apiKeysTable := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		prefix TEXT UNIQUE NOT NULL,
+		key_hash TEXT UNIQUE NOT NULL,
+		scopes TEXT NOT NULL,
+		mfa INTEGER NOT NULL DEFAULT 0,
+		last_used_at DATETIME,
+		revoked_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	// Roles are named sets of permissions. users.role refers to roles.name.
+	rolesTable := `
+	CREATE TABLE IF NOT EXISTS roles (
+		name TEXT PRIMARY KEY,
+		description TEXT NOT NULL DEFAULT '',
+		built_in INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	rolePermissionsTable := `
+	CREATE TABLE IF NOT EXISTS role_permissions (
+		role TEXT NOT NULL,
+		permission TEXT NOT NULL,
+		PRIMARY KEY (role, permission),
+		FOREIGN KEY (role) REFERENCES roles(name) ON DELETE CASCADE
+	);`
+
+	// Pending OpenID Connect logins. The state is stored hashed and the row is
+	// deleted when the provider redirects back.
+	oidcStatesTable := `
+	CREATE TABLE IF NOT EXISTS oidc_states (
+		state_hash TEXT PRIMARY KEY,
+		provider TEXT NOT NULL,
+		nonce TEXT NOT NULL,
+		code_verifier TEXT NOT NULL,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Accounts at external identity providers linked to local users
+	userIdentitiesTable := `
+	CREATE TABLE IF NOT EXISTS user_identities (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		provider TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		email TEXT NOT NULL,
+		last_login_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (provider, subject),
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	// Audit log of admins impersonating users: when it started and every
+	// request made with the impersonation token
+	impersonationEventsTable := `
+	CREATE TABLE IF NOT EXISTS impersonation_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		admin_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		method TEXT NOT NULL,
+		path TEXT NOT NULL,
+		status INTEGER NOT NULL,
+		ip_address TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (admin_id) REFERENCES users(id),
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	// Append-only log of changes, see package audit. Actors are not foreign
+	// keys so the log outlives anything it refers to.
+	auditEventsTable := `
+	CREATE TABLE IF NOT EXISTS audit_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		actor_id INTEGER,
+		impersonator_id INTEGER,
+		action TEXT NOT NULL,
+		target_type TEXT NOT NULL,
+		target_id TEXT NOT NULL,
+		changes TEXT NOT NULL DEFAULT '{}',
+		request_id TEXT NOT NULL DEFAULT '',
+		ip_address TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL
+	);`
+
+	// Category tree. The API refuses to delete categories that still have
+	// subcategories; product assignments go with the category.
+	categoriesTable := `
+	CREATE TABLE IF NOT EXISTS categories (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		slug TEXT NOT NULL UNIQUE,
+		parent_id INTEGER,
+		sort_order INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (parent_id) REFERENCES categories(id)
+	);`
+
+	productCategoriesTable := `
+	CREATE TABLE IF NOT EXISTS product_categories (
+		product_id INTEGER NOT NULL,
+		category_id INTEGER NOT NULL,
+		PRIMARY KEY (product_id, category_id),
+		FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE,
+		FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+	);`
+
+	// Free-form tags, stored lowercase
+	tagsTable := `
+	CREATE TABLE IF NOT EXISTS tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	productTagsTable := `
+	CREATE TABLE IF NOT EXISTS product_tags (
+		product_id INTEGER NOT NULL,
+		tag_id INTEGER NOT NULL,
+		PRIMARY KEY (product_id, tag_id),
+		FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE,
+		FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+	);`
+
+	// Option types of a product, such as size or color, with their values in
+	// display order
+	productOptionsTable := `
+	CREATE TABLE IF NOT EXISTS product_options (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		product_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		UNIQUE (product_id, name),
+		FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+	);`
+
+	productOptionValuesTable := `
+	CREATE TABLE IF NOT EXISTS product_option_values (
+		option_id INTEGER NOT NULL,
+		value TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		PRIMARY KEY (option_id, value),
+		FOREIGN KEY (option_id) REFERENCES product_options(id) ON DELETE CASCADE
+	);`
+
+	// Sellable variants of a product. options holds the chosen value of every
+	// option type as a JSON object with sorted keys, so each combination can
+	// only exist once. A NULL price means the product price, prices are in
+	// the product's currency.
+	productVariantsTable := `
+	CREATE TABLE IF NOT EXISTS product_variants (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		product_id INTEGER NOT NULL,
+		sku TEXT NOT NULL UNIQUE,
+		options TEXT NOT NULL,
+		price INTEGER,
+		stock INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (product_id, options),
+		FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+	);`
+
+	// Product image galleries. The original is stored at original_key and
+	// the thumbnails next to it as <size>.<thumbnail_ext>; the URLs of all of
+	// them are recorded at upload.
+	productImagesTable := `
+	CREATE TABLE IF NOT EXISTS product_images (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		product_id INTEGER NOT NULL,
+		position INTEGER NOT NULL,
+		original_key TEXT NOT NULL,
+		thumbnail_ext TEXT NOT NULL,
+		url TEXT NOT NULL,
+		thumbnails TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		width INTEGER NOT NULL,
+		height INTEGER NOT NULL,
+		size INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+	);`
+
+	// Every change of stock, as a signed quantity. products.stock and
+	// product_variants.stock are kept equal to the sums by a trigger.
+	// variant_id and order_id are not foreign keys so history survives
+	// variants being removed.
+	inventoryMovementsTable := `
+	CREATE TABLE IF NOT EXISTS inventory_movements (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		product_id INTEGER NOT NULL,
+		variant_id INTEGER,
+		kind TEXT NOT NULL CHECK (kind IN ('opening', 'receipt', 'sale', 'adjustment', 'return')),
+		quantity INTEGER NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		actor_id INTEGER,
+		order_id INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+	);`
+
+	tables := []string{
+		usersTable, productsTable, ordersTable, chatTable,
+		refreshTokensTable, sessionsTable, revokedTokensTable, invitesTable, accountTokensTable,
+		recoveryCodesTable, settingsTable, loginAttemptsTable, loginThrottlesTable,
+		apiKeysTable, rolesTable, rolePermissionsTable, oidcStatesTable, userIdentitiesTable,
+		impersonationEventsTable, auditEventsTable, categoriesTable, productCategoriesTable,
+		tagsTable, productTagsTable, productOptionsTable, productOptionValuesTable, productVariantsTable,
+		productImagesTable, inventoryMovementsTable,
+	}
 
 	for _, table := range tables {
 		if _, err := DB.Exec(table); err != nil {
@@ -100,6 +472,239 @@ func createTables() error {
 	return nil
 }
 
+// createIndexes runs after migrateTables so indexes may cover migrated columns
+func createIndexes() error {
+	indexes := []string{
+		"CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id)",
+		"CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_account_tokens_user ON account_tokens(user_id, purpose)",
+		"CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_login_attempts_email ON login_attempts(email)",
+		"CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip_address)",
+		"CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_impersonation_events_admin ON impersonation_events(admin_id)",
+		"CREATE INDEX IF NOT EXISTS idx_impersonation_events_user ON impersonation_events(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor_id)",
+		"CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events(target_type, target_id)",
+		"CREATE INDEX IF NOT EXISTS idx_audit_events_created ON audit_events(created_at)",
+		// Keyset pagination of the product listing, one index per sort field
+		"CREATE INDEX IF NOT EXISTS idx_products_created_at ON products(created_at, id)",
+		"CREATE INDEX IF NOT EXISTS idx_products_price ON products(price, id)",
+		"CREATE INDEX IF NOT EXISTS idx_products_name ON products(name, id)",
+		"CREATE INDEX IF NOT EXISTS idx_products_stock ON products(stock, id)",
+		"CREATE INDEX IF NOT EXISTS idx_products_created_by ON products(created_by)",
+		"CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products(deleted_at)",
+		"CREATE INDEX IF NOT EXISTS idx_categories_parent ON categories(parent_id)",
+		"CREATE INDEX IF NOT EXISTS idx_product_categories_category ON product_categories(category_id)",
+		"CREATE INDEX IF NOT EXISTS idx_product_tags_tag ON product_tags(tag_id)",
+		"CREATE INDEX IF NOT EXISTS idx_product_variants_product ON product_variants(product_id)",
+		"CREATE INDEX IF NOT EXISTS idx_product_images_product ON product_images(product_id, position)",
+		"CREATE INDEX IF NOT EXISTS idx_inventory_movements_product ON inventory_movements(product_id, id)",
+		"CREATE INDEX IF NOT EXISTS idx_inventory_movements_variant ON inventory_movements(variant_id)",
+	}
+
+	for _, index := range indexes {
+		if _, err := DB.Exec(index); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// createTriggers enforces rules the schema cannot express
+func createTriggers() error {
+	triggers := []string{
+		// Audit events can be added but never changed or removed
+		`CREATE TRIGGER IF NOT EXISTS audit_events_no_update BEFORE UPDATE ON audit_events
+		BEGIN SELECT RAISE(ABORT, 'audit_events is append-only'); END`,
+		`CREATE TRIGGER IF NOT EXISTS audit_events_no_delete BEFORE DELETE ON audit_events
+		BEGIN SELECT RAISE(ABORT, 'audit_events is append-only'); END`,
+
+		// Every change of a product or order gets a new version, which is its
+		// ETag. Updates that set the version themselves are left alone.
+		`CREATE TRIGGER IF NOT EXISTS products_version AFTER UPDATE ON products
+		WHEN NEW.version = OLD.version
+		BEGIN
+			UPDATE products SET version = OLD.version + 1 WHERE id = NEW.id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS orders_version AFTER UPDATE ON orders
+		WHEN NEW.version = OLD.version
+		BEGIN
+			UPDATE orders SET version = OLD.version + 1 WHERE id = NEW.id;
+		END`,
+
+		// Stock follows the inventory ledger. Opening balances record stock
+		// that existed before the ledger, so they are not applied again.
+		`CREATE TRIGGER IF NOT EXISTS inventory_movements_apply AFTER INSERT ON inventory_movements
+		WHEN NEW.kind != 'opening'
+		BEGIN
+			UPDATE product_variants SET stock = stock + NEW.quantity, updated_at = NEW.created_at WHERE id = NEW.variant_id;
+			UPDATE products SET stock = stock + NEW.quantity, updated_at = NEW.created_at
+			WHERE id = NEW.product_id AND NEW.variant_id IS NULL;
+		END`,
+
+		// The stock of a product with variants is the sum of their stock, so
+		// listings, filters and sorting keep working on products.stock
+		`CREATE TRIGGER IF NOT EXISTS product_variants_stock_insert AFTER INSERT ON product_variants
+		BEGIN
+			UPDATE products SET stock = (SELECT SUM(stock) FROM product_variants WHERE product_id = NEW.product_id)
+			WHERE id = NEW.product_id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS product_variants_stock_update AFTER UPDATE OF stock ON product_variants
+		BEGIN
+			UPDATE products SET stock = (SELECT SUM(stock) FROM product_variants WHERE product_id = NEW.product_id)
+			WHERE id = NEW.product_id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS product_variants_stock_delete AFTER DELETE ON product_variants
+		BEGIN
+			UPDATE products SET stock = (SELECT COALESCE(SUM(stock), 0) FROM product_variants WHERE product_id = OLD.product_id)
+			WHERE id = OLD.product_id;
+		END`,
+	}
+
+	for _, trigger := range triggers {
+		if _, err := DB.Exec(trigger); err != nil {
+			return fmt.Errorf("failed to create trigger: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// migrateTables brings databases created by older versions up to date with
+// the columns declared in createTables
+func migrateTables() error {
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"users", "suspended_at", "DATETIME"},
+		{"users", "deleted_at", "DATETIME"},
+		{"users", "tokens_valid_after", "DATETIME"},
+		{"users", "email_verified_at", "DATETIME"},
+		{"users", "totp_secret", "TEXT"},
+		{"users", "totp_enabled_at", "DATETIME"},
+		{"users", "totp_last_counter", "INTEGER"},
+		{"refresh_tokens", "mfa", "INTEGER NOT NULL DEFAULT 0"},
+		{"account_tokens", "attempts", "INTEGER NOT NULL DEFAULT 0"},
+		{"orders", "variant_id", "INTEGER"},
+		{"orders", "sku", "TEXT NOT NULL DEFAULT ''"},
+		{"products", "version", "INTEGER NOT NULL DEFAULT 1"},
+		{"orders", "version", "INTEGER NOT NULL DEFAULT 1"},
+		{"products", "currency", "TEXT NOT NULL DEFAULT 'USD'"},
+		{"orders", "currency", "TEXT NOT NULL DEFAULT 'USD'"},
+		{"products", "deleted_at", "DATETIME"},
+	}
+
+	for _, col := range columns {
+		if err := addColumnIfMissing(col.table, col.column, col.definition); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", col.table, col.column, err)
+		}
+	}
+
+	return migrateMoneyColumns()
+}
+
+// migrateMoneyColumns converts prices stored as REAL by older versions to
+// integer cents. Those prices were all in the default currency, USD. SQLite
+// cannot change the type of a column, so each one is replaced by a new
+// column under the same name.
+func migrateMoneyColumns() error {
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"products", "price", "INTEGER NOT NULL DEFAULT 0"},
+		{"product_variants", "price", "INTEGER"},
+		{"orders", "price", "INTEGER NOT NULL DEFAULT 0"},
+		{"orders", "total", "INTEGER NOT NULL DEFAULT 0"},
+	}
+
+	for _, col := range columns {
+		colType, _, err := columnType(col.table, col.column)
+		if err != nil {
+			return err
+		}
+		if colType != "REAL" {
+			continue
+		}
+		if err := convertToCents(col.table, col.column, col.definition); err != nil {
+			return fmt.Errorf("failed to convert %s.%s: %w", col.table, col.column, err)
+		}
+	}
+
+	return nil
+}
+
+func convertToCents(table, column, definition string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Indexed columns cannot be dropped, createIndexes adds the index back
+	// on the new column
+	statements := []string{
+		"DROP INDEX IF EXISTS idx_products_price",
+		fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s_real", table, column, column),
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition),
+		fmt.Sprintf("UPDATE %s SET %s = CAST(ROUND(%s_real * 100) AS INTEGER)", table, column, column),
+		fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s_real", table, column),
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func addColumnIfMissing(table, column, definition string) error {
+	exists, err := columnExists(table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+func columnExists(table, column string) (bool, error) {
+	_, exists, err := columnType(table, column)
+	return exists, err
+}
+
+// columnType returns the declared type of a column and whether the table has
+// the column at all
+func columnType(table, column string) (string, bool, error) {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return "", false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return "", false, err
+		}
+		if name == column {
+			return colType, true, nil
+		}
+	}
+
+	return "", false, rows.Err()
+}
+
 func CloseDB() error {
 	if DB != nil {
 		return DB.Close()
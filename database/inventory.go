@@ -0,0 +1,104 @@
+package database
+
+// StockDrift is a product or variant whose stock differs from the sum of its
+// inventory movements
+type StockDrift struct {
+	ProductID   int
+	VariantID   *int
+	Name        string // Product name, or the SKU of a variant
+	Stock       int
+	LedgerStock int
+}
+
+// SeedInventoryLedger records the current stock of every product and variant
+// as its opening balance, for databases created before the inventory ledger.
+// It does nothing once the ledger has any movement.
+func SeedInventoryLedger() error {
+	var movements int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM inventory_movements").Scan(&movements); err != nil {
+		return err
+	}
+	if movements > 0 {
+		return nil
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Products with variants get one balance per variant
+	_, err = tx.Exec(`
+		INSERT INTO inventory_movements (product_id, variant_id, kind, quantity, reason)
+		SELECT product_id, id, 'opening', stock, 'Opening balance' FROM product_variants WHERE stock != 0`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO inventory_movements (product_id, kind, quantity, reason)
+		SELECT id, 'opening', stock, 'Opening balance' FROM products
+		WHERE stock != 0 AND NOT EXISTS (SELECT 1 FROM product_variants WHERE product_id = products.id)`)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// InventoryDrift lists the products and variants whose stock does not match
+// their inventory ledger
+func InventoryDrift() ([]StockDrift, error) {
+	rows, err := DB.Query(`
+		SELECT p.id, NULL, p.name, p.stock, COALESCE(SUM(m.quantity), 0) AS ledger
+		FROM products p LEFT JOIN inventory_movements m ON m.product_id = p.id
+		GROUP BY p.id
+		HAVING p.stock != ledger
+		UNION ALL
+		SELECT v.product_id, v.id, v.sku, v.stock, COALESCE(SUM(m.quantity), 0) AS ledger
+		FROM product_variants v LEFT JOIN inventory_movements m ON m.variant_id = v.id
+		GROUP BY v.id
+		HAVING v.stock != ledger
+		ORDER BY 1, 2`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drift []StockDrift
+	for rows.Next() {
+		var d StockDrift
+		if err := rows.Scan(&d.ProductID, &d.VariantID, &d.Name, &d.Stock, &d.LedgerStock); err != nil {
+			return nil, err
+		}
+		drift = append(drift, d)
+	}
+	return drift, rows.Err()
+}
+
+// FixInventoryDrift sets every stock to the sum of its inventory movements,
+// treating the ledger as the record of truth
+func FixInventoryDrift() error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE product_variants
+		SET stock = (SELECT COALESCE(SUM(quantity), 0) FROM inventory_movements WHERE variant_id = product_variants.id)
+		WHERE stock != (SELECT COALESCE(SUM(quantity), 0) FROM inventory_movements WHERE variant_id = product_variants.id)`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE products
+		SET stock = (SELECT COALESCE(SUM(quantity), 0) FROM inventory_movements WHERE product_id = products.id)
+		WHERE stock != (SELECT COALESCE(SUM(quantity), 0) FROM inventory_movements WHERE product_id = products.id)`)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"database/sql"
+	"smarapp-api/models"
+	"time"
+)
+
+// seedRoles creates the built-in roles with their default permissions. The
+// admin role is topped up with every permission on each start so permissions
+// added in newer versions reach existing databases.
+func seedRoles() error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	descriptions := map[models.Role]string{
+		models.RoleAdmin: "Full access",
+		models.RoleUser:  "Regular account",
+	}
+
+	for role, permissions := range models.DefaultRolePermissions {
+		result, err := tx.Exec(
+			"INSERT OR IGNORE INTO roles (name, description, built_in, created_at, updated_at) VALUES (?, ?, 1, ?, ?)",
+			role, descriptions[role], time.Now(), time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+
+		created, _ := result.RowsAffected()
+		if created == 0 && role != models.RoleAdmin {
+			continue
+		}
+
+		for _, permission := range permissions {
+			if _, err := tx.Exec("INSERT OR IGNORE INTO role_permissions (role, permission) VALUES (?, ?)", role, permission); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RoleExists reports whether a role with the given name is defined
+func RoleExists(role models.Role) (bool, error) {
+	var name string
+	err := DB.QueryRow("SELECT name FROM roles WHERE name = ?", role).Scan(&name)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RolePermissions returns the permissions granted to a role, in a stable order
+func RolePermissions(role models.Role) ([]models.Permission, error) {
+	rows, err := DB.Query("SELECT permission FROM role_permissions WHERE role = ? ORDER BY permission", role)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []models.Permission{}
+	for rows.Next() {
+		var permission models.Permission
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, rows.Err()
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// ProductSearchFTS reports whether products are indexed with FTS5. The
+// go-sqlite3 driver only includes FTS5 when built with -tags sqlite_fts5;
+// without it product search falls back to LIKE matching.
+var ProductSearchFTS bool
+
+// ErrSearchIndexUnavailable is returned when FTS5 is not compiled in
+var ErrSearchIndexUnavailable = errors.New("FTS5 is not available, build with -tags sqlite_fts5")
+
+// createSearchIndex sets up products_fts, an external content FTS5 table
+// over the name and description of products, kept in sync by triggers.
+// The index is filled when the table is first created.
+func createSearchIndex() error {
+	var exists int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'products_fts'").Scan(&exists); err != nil {
+		return err
+	}
+
+	_, err := DB.Exec(`
+	CREATE VIRTUAL TABLE IF NOT EXISTS products_fts USING fts5(
+		name, description,
+		content = 'products', content_rowid = 'id',
+		tokenize = 'unicode61 remove_diacritics 2', prefix = '2 3'
+	)`)
+	if err != nil && strings.Contains(err.Error(), "no such module: fts5") {
+		ProductSearchFTS = false
+		log.Println("FTS5 is not available, product search falls back to LIKE matching")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ProductSearchFTS = true
+
+	triggers := []string{
+		`CREATE TRIGGER IF NOT EXISTS products_fts_insert AFTER INSERT ON products BEGIN
+			INSERT INTO products_fts (rowid, name, description) VALUES (new.id, new.name, new.description);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS products_fts_delete AFTER DELETE ON products BEGIN
+			INSERT INTO products_fts (products_fts, rowid, name, description) VALUES ('delete', old.id, old.name, old.description);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS products_fts_update AFTER UPDATE OF name, description ON products BEGIN
+			INSERT INTO products_fts (products_fts, rowid, name, description) VALUES ('delete', old.id, old.name, old.description);
+			INSERT INTO products_fts (rowid, name, description) VALUES (new.id, new.name, new.description);
+		END`,
+	}
+	for _, trigger := range triggers {
+		if _, err := DB.Exec(trigger); err != nil {
+			return fmt.Errorf("failed to create trigger: %w", err)
+		}
+	}
+
+	if exists == 0 {
+		return RebuildProductSearchIndex()
+	}
+	return nil
+}
+
+// RebuildProductSearchIndex re-indexes every product, e.g. after products
+// were changed with the triggers missing
+func RebuildProductSearchIndex() error {
+	if !ProductSearchFTS {
+		return ErrSearchIndexUnavailable
+	}
+	_, err := DB.Exec("INSERT INTO products_fts (products_fts) VALUES ('rebuild')")
+	return err
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Setting keys
+const (
+	// SettingRequireAdminTwoFactor ("true"/"false") restricts admin endpoints
+	// to tokens obtained with two-factor authentication
+	SettingRequireAdminTwoFactor = "require_admin_2fa"
+)
+
+// GetSetting returns the value of a setting, or defaultValue if it was never set
+func GetSetting(key, defaultValue string) (string, error) {
+	var value string
+	err := DB.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return defaultValue, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// SetSetting creates or replaces a setting
+func SetSetting(tx *sql.Tx, key, value string) error {
+	_, err := tx.Exec(
+		"INSERT INTO settings (key, value, updated_at) VALUES (?, ?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at",
+		key, value, time.Now(),
+	)
+	return err
+}
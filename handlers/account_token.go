@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"smarapp-api/database"
+	"smarapp-api/middleware"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Purposes of account tokens sent by email
+const (
+	purposePasswordReset      = "password_reset"
+	purposeEmailVerification  = "email_verification"
+	purposeTwoFactorChallenge = "two_factor_challenge"
+)
+
+var errInvalidAccountToken = errors.New("invalid or expired token")
+
+// accountTokenClaims are carried by password reset and email verification
+// tokens. The email binds the token to the address it was sent to, so
+// changing the email invalidates outstanding tokens.
+type accountTokenClaims struct {
+	Purpose string `json:"purpose"`
+	Email   string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// issueAccountToken signs a single-use token for the given purpose and
+// records its jti. Older unused tokens of the same purpose are invalidated.
+func (h *AuthHandler) issueAccountToken(userID int, email, purpose string, ttl time.Duration) (string, error) {
+	jti, err := middleware.NewTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM account_tokens WHERE expires_at < ?", now); err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE account_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL",
+		now, userID, purpose,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO account_tokens (jti, user_id, purpose, expires_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		jti, userID, purpose, expiresAt, now,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", err
+	}
+
+	claims := accountTokenClaims{
+		Purpose: purpose,
+		Email:   email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   strconv.Itoa(userID),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	return h.Keys.Sign(claims)
+}
+
+// parseAccountToken verifies the signature, expiry and purpose of an account token
+func (h *AuthHandler) parseAccountToken(tokenString, purpose string) (*accountTokenClaims, int, error) {
+	claims := &accountTokenClaims{}
+	err := h.Keys.Parse(tokenString, claims)
+	if err != nil || claims.Purpose != purpose || claims.ID == "" {
+		return nil, 0, errInvalidAccountToken
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil, 0, errInvalidAccountToken
+	}
+
+	return claims, userID, nil
+}
+
+// consumeAccountToken marks a token as used, failing if it was used before
+func consumeAccountToken(tx *sql.Tx, jti, purpose string) error {
+	result, err := tx.Exec(
+		"UPDATE account_tokens SET used_at = ? WHERE jti = ? AND purpose = ? AND used_at IS NULL",
+		time.Now(), jti, purpose,
+	)
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return errInvalidAccountToken
+	}
+
+	return nil
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/middleware"
+	"smarapp-api/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAPIKey godoc
+// @Summary Create an API key
+// @Description Create a named, scoped API key for machine clients. Send it as "Authorization: ApiKey <key>". The key is only returned once.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param key body models.CreateAPIKeyRequest true "Key name and scopes (read, write, admin)"
+// @Success 201 {object} models.CreateAPIKeyResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /profile/api-keys [post]
+func (h *AuthHandler) CreateAPIKey(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+
+	granted, _ := c.Get("permissions")
+	permissions, _ := granted.([]models.Permission)
+	scopes := []models.APIKeyScope{}
+	seen := map[models.APIKeyScope]bool{}
+	for _, scope := range req.Scopes {
+		if !scope.IsValid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope: " + string(scope)})
+			return
+		}
+		if scope == models.APIKeyScopeAdmin && len(permissions) == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin scope requires a role with permissions"})
+			return
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	key, prefix, err := middleware.NewAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+
+	scopeList := make([]string, len(scopes))
+	for i, scope := range scopes {
+		scopeList[i] = string(scope)
+	}
+
+	// Keys created from a two-factor session may reach admin endpoints that require it
+	userID, _ := c.Get("user_id")
+	now := time.Now()
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, mfa, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		userID, name, prefix, middleware.HashAPIKey(key), strings.Join(scopeList, ","), c.GetBool("mfa"), now,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	keyID, _ := result.LastInsertId()
+	apiKey := models.APIKey{
+		ID:        int(keyID),
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+
+	if err := recordAudit(c, tx, "api_key.create", auditTargetAPIKey, apiKey.ID, nil, apiKey); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.CreateAPIKeyResponse{
+		Key:    key,
+		APIKey: apiKey,
+	})
+}
+
+// ListAPIKeys godoc
+// @Summary List API keys
+// @Description Get the API keys of the authenticated user, newest first. Keys are never returned, only their prefix.
+// @Tags Authentication
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.APIKey
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /profile/api-keys [get]
+func (h *AuthHandler) ListAPIKeys(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	rows, err := database.DB.Query(`
+		SELECT id, name, prefix, scopes, last_used_at, revoked_at, created_at
+		FROM api_keys
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		var scopes string
+		var lastUsedAt, revokedAt sql.NullTime
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &scopes, &lastUsedAt, &revokedAt, &key.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan API key"})
+			return
+		}
+		key.Scopes = middleware.ParseAPIKeyScopes(scopes)
+		if lastUsedAt.Valid {
+			key.LastUsedAt = &lastUsedAt.Time
+		}
+		if revokedAt.Valid {
+			key.RevokedAt = &revokedAt.Time
+		}
+		keys = append(keys, key)
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Description Revoke one of the authenticated user's API keys. Requests using it are rejected from then on.
+// @Tags Authentication
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "API key ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /profile/api-keys/{id} [delete]
+func (h *AuthHandler) RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"UPDATE api_keys SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		time.Now(), id, userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "api_key.revoke", auditTargetAPIKey, id, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"smarapp-api/database"
+	"smarapp-api/middleware"
+	"smarapp-api/models"
+	"smarapp-api/testutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAPIKeyRouter(handler *AuthHandler) *gin.Engine {
+	r := newTestRouter(handler.JWTSecret)
+	r.Protected.GET("/profile", handler.GetProfile)
+	r.Protected.POST("/profile/verify-email", handler.ResendVerification)
+	r.Protected.GET("/admin/ping", middleware.AdminMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "pong"})
+	})
+
+	account := r.Protected.Group("/profile")
+	account.Use(middleware.SessionOnly())
+	account.PATCH("", handler.UpdateProfile)
+	account.POST("/api-keys", handler.CreateAPIKey)
+	account.GET("/api-keys", handler.ListAPIKeys)
+	account.DELETE("/api-keys/:id", handler.RevokeAPIKey)
+	return r.Engine
+}
+
+func performWithAPIKey(r *gin.Engine, method, path, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "ApiKey "+key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func createTestAPIKey(t *testing.T, r *gin.Engine, token string, scopes ...models.APIKeyScope) models.CreateAPIKeyResponse {
+	w := performJSON(r, "POST", "/profile/api-keys", token, models.CreateAPIKeyRequest{Name: "ci", Scopes: scopes})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response models.CreateAPIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func TestAuthHandler_APIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+	r := newAPIKeyRouter(handler)
+
+	registered := registerTestUser(t, handler, models.RegisterRequest{
+		Username: "testuser",
+		Email:    "test@test.com",
+		Password: "password123",
+	})
+
+	// Regular users cannot create admin keys, unknown scopes are rejected
+	w := performJSON(r, "POST", "/profile/api-keys", registered.Token, models.CreateAPIKeyRequest{Name: "ci", Scopes: []models.APIKeyScope{models.APIKeyScopeAdmin}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = performJSON(r, "POST", "/profile/api-keys", registered.Token, models.CreateAPIKeyRequest{Name: "ci", Scopes: []models.APIKeyScope{"delete"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	created := createTestAPIKey(t, r, registered.Token, models.APIKeyScopeRead, models.APIKeyScopeRead)
+	assert.True(t, strings.HasPrefix(created.Key, created.APIKey.Prefix+"_"))
+	assert.Equal(t, []models.APIKeyScope{models.APIKeyScopeRead}, created.APIKey.Scopes)
+
+	var storedHash string
+	err := database.DB.QueryRow("SELECT key_hash FROM api_keys WHERE id = ?", created.APIKey.ID).Scan(&storedHash)
+	assert.NoError(t, err)
+	assert.NotContains(t, storedHash, created.Key)
+
+	// The key authenticates as its owner and records when it was used
+	w = performWithAPIKey(r, "GET", "/profile", created.Key)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "test@test.com")
+
+	w = performJSON(r, "GET", "/profile/api-keys", registered.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var keys []models.APIKey
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &keys))
+	assert.Len(t, keys, 1)
+	assert.Equal(t, created.APIKey.Prefix, keys[0].Prefix)
+	assert.NotNil(t, keys[0].LastUsedAt)
+	assert.NotContains(t, w.Body.String(), created.Key)
+
+	// A read key cannot change data, manage credentials or reach admin endpoints
+	w = performWithAPIKey(r, "POST", "/profile/verify-email", created.Key)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "write scope")
+
+	writeKey := createTestAPIKey(t, r, registered.Token, models.APIKeyScopeRead, models.APIKeyScopeWrite)
+	w = performWithAPIKey(r, "POST", "/profile/verify-email", writeKey.Key)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performWithAPIKey(r, "GET", "/profile/api-keys", writeKey.Key)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = performWithAPIKey(r, "PATCH", "/profile", writeKey.Key)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Revoked and unknown keys are rejected
+	w = performJSON(r, "DELETE", fmt.Sprintf("/profile/api-keys/%d", created.APIKey.ID), registered.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performJSON(r, "DELETE", fmt.Sprintf("/profile/api-keys/%d", created.APIKey.ID), registered.Token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = performWithAPIKey(r, "GET", "/profile", created.Key)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = performWithAPIKey(r, "GET", "/profile", created.Key+"x")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Suspending the owner disables their keys
+	_, err = database.DB.Exec("UPDATE users SET suspended_at = ? WHERE id = ?", time.Now(), registered.User.ID)
+	assert.NoError(t, err)
+	w = performWithAPIKey(r, "GET", "/profile", writeKey.Key)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAuthHandler_APIKeys_AdminScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+	r := newAPIKeyRouter(handler)
+
+	adminToken, _ := seedTokens(t, handler.JWTSecret)
+
+	readKey := createTestAPIKey(t, r, adminToken, models.APIKeyScopeRead)
+	w := performWithAPIKey(r, "GET", "/admin/ping", readKey.Key)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "admin scope")
+
+	adminKey := createTestAPIKey(t, r, adminToken, models.APIKeyScopeRead, models.APIKeyScopeAdmin)
+	w = performWithAPIKey(r, "GET", "/admin/ping", adminKey.Key)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Demoted admins lose admin access through their keys as well
+	_, err := database.DB.Exec("UPDATE users SET role = 'user' WHERE id = 1")
+	assert.NoError(t, err)
+	w = performWithAPIKey(r, "GET", "/admin/ping", adminKey.Key)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"smarapp-api/audit"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Audit target types
+const (
+	auditTargetUser           = "user"
+	auditTargetProduct        = "product"
+	auditTargetOrder          = "order"
+	auditTargetInvite         = "invite"
+	auditTargetRole           = "role"
+	auditTargetSettings       = "settings"
+	auditTargetChatMessage    = "chat_message"
+	auditTargetAPIKey         = "api_key"
+	auditTargetSession        = "session"
+	auditTargetCategory       = "category"
+	auditTargetTag            = "tag"
+	auditTargetProductVariant = "product_variant"
+)
+
+const auditEventColumns = "id, actor_id, impersonator_id, action, target_type, target_id, changes, request_id, ip_address, created_at"
+
+type AuditHandler struct{}
+
+func NewAuditHandler() *AuditHandler {
+	return &AuditHandler{}
+}
+
+// ListAuditEvents godoc
+// @Summary List audit events (Admin only)
+// @Description Get a paginated log of data changes, newest first. Each event names the actor, the action, the changed record and the fields that changed.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number (default 1)"
+// @Param page_size query int false "Page size (default 20, max 100)"
+// @Param actor_id query int false "Filter by acting user"
+// @Param target_type query string false "Filter by target type (e.g. product, user)"
+// @Param target_id query string false "Filter by target ID"
+// @Param action query string false "Filter by action (e.g. product.update)"
+// @Param request_id query string false "Filter by request ID"
+// @Param from query string false "Only events at or after this time (RFC 3339)"
+// @Param to query string false "Only events before this time (RFC 3339)"
+// @Success 200 {object} models.AuditEventListResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/audit [get]
+func (h *AuditHandler) ListAuditEvents(c *gin.Context) {
+	page, pageSize, err := parsePagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	where, args, err := auditFilters(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM audit_events"+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count audit events"})
+		return
+	}
+
+	rows, err := database.DB.Query(
+		"SELECT "+auditEventColumns+" FROM audit_events"+where+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, pageSize, (page-1)*pageSize)...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit events"})
+		return
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan audit event"})
+			return
+		}
+		events = append(events, event)
+	}
+
+	c.JSON(http.StatusOK, models.AuditEventListResponse{
+		Events:   events,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	})
+}
+
+// ExportAuditEvents godoc
+// @Summary Export audit events (Admin only)
+// @Description Stream every audit event matching the filters as newline-delimited JSON, oldest first, one models.AuditEvent per line
+// @Tags Admin
+// @Produce application/x-ndjson
+// @Security BearerAuth
+// @Param actor_id query int false "Filter by acting user"
+// @Param target_type query string false "Filter by target type (e.g. product, user)"
+// @Param target_id query string false "Filter by target ID"
+// @Param action query string false "Filter by action (e.g. product.update)"
+// @Param request_id query string false "Filter by request ID"
+// @Param from query string false "Only events at or after this time (RFC 3339)"
+// @Param to query string false "Only events before this time (RFC 3339)"
+// @Success 200 {string} string "One JSON event per line"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/audit/export [get]
+func (h *AuditHandler) ExportAuditEvents(c *gin.Context) {
+	where, args, err := auditFilters(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := database.DB.Query("SELECT "+auditEventColumns+" FROM audit_events"+where+" ORDER BY id", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit events"})
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="audit-events.ndjson"`)
+	c.Status(http.StatusOK)
+
+	// The status is already sent, so failures can only end the stream early
+	encoder := json.NewEncoder(c.Writer)
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err == nil {
+			err = encoder.Encode(event)
+		}
+		if err != nil {
+			log.Printf("Failed to export audit events: %v", err)
+			return
+		}
+		c.Writer.Flush()
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Failed to export audit events: %v", err)
+	}
+}
+
+// auditFilters builds the WHERE clause shared by the audit log endpoints
+func auditFilters(c *gin.Context) (string, []interface{}, error) {
+	where := " WHERE 1 = 1"
+	args := []interface{}{}
+
+	if value := c.Query("actor_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return "", nil, errors.New("Invalid actor_id")
+		}
+		where += " AND actor_id = ?"
+		args = append(args, id)
+	}
+
+	for _, filter := range []string{"target_type", "target_id", "action", "request_id"} {
+		if value := c.Query(filter); value != "" {
+			where += " AND " + filter + " = ?"
+			args = append(args, value)
+		}
+	}
+
+	for _, bound := range []struct{ param, condition string }{
+		{"from", " AND created_at >= ?"},
+		{"to", " AND created_at < ?"},
+	} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return "", nil, fmt.Errorf("Invalid %s (must be an RFC 3339 time)", bound.param)
+		}
+		// Events are stored in UTC
+		where += bound.condition
+		args = append(args, t.UTC())
+	}
+
+	return where, args, nil
+}
+
+func scanAuditEvent(rows *sql.Rows) (models.AuditEvent, error) {
+	var event models.AuditEvent
+	var actorID, impersonatorID sql.NullInt64
+	var changes string
+	err := rows.Scan(
+		&event.ID, &actorID, &impersonatorID, &event.Action, &event.TargetType, &event.TargetID,
+		&changes, &event.RequestID, &event.IPAddress, &event.CreatedAt,
+	)
+	if err != nil {
+		return event, err
+	}
+
+	if actorID.Valid {
+		id := int(actorID.Int64)
+		event.ActorID = &id
+	}
+	if impersonatorID.Valid {
+		id := int(impersonatorID.Int64)
+		event.ImpersonatorID = &id
+	}
+
+	err = json.Unmarshal([]byte(changes), &event.Changes)
+	return event, err
+}
+
+// recordAudit stores an audit event for a change made by the request. before
+// and after are snapshots of the target, nil when it was created or deleted.
+// Changes made without authentication, such as registering or resetting a
+// password, are attributed to the account they change.
+func recordAudit(c *gin.Context, db audit.Execer, action, targetType string, targetID interface{}, before, after interface{}) error {
+	event := audit.Event{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   fmt.Sprint(targetID),
+		Before:     before,
+		After:      after,
+		RequestID:  c.GetString("request_id"),
+		IPAddress:  c.ClientIP(),
+	}
+
+	if userID, ok := c.Get("user_id"); ok {
+		actorID := userID.(int)
+		event.ActorID = &actorID
+	} else if id, ok := targetID.(int); ok && targetType == auditTargetUser {
+		event.ActorID = &id
+	}
+	if impersonatorID, ok := c.Get("impersonator_id"); ok {
+		id := impersonatorID.(int)
+		event.ImpersonatorID = &id
+	}
+
+	return audit.Record(db, event)
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"smarapp-api/database"
+	"smarapp-api/middleware"
+	"smarapp-api/models"
+	"smarapp-api/testutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newAuditRouter wires product management and the audit log behind the real middleware, as in main.go
+func newAuditRouter(jwtSecret string) *gin.Engine {
+	productHandler := NewProductHandler()
+	auditHandler := NewAuditHandler()
+
+	r := newTestRouter(jwtSecret, middleware.RequestID())
+	products := r.Require("/products", models.PermissionProductsWrite)
+	products.POST("", productHandler.CreateProduct)
+	products.PATCH("/:id", productHandler.PatchProduct)
+	products.DELETE("/:id", productHandler.DeleteProduct)
+
+	events := r.Require("/admin/audit", models.PermissionAuditRead)
+	events.GET("", auditHandler.ListAuditEvents)
+	events.GET("/export", auditHandler.ExportAuditEvents)
+	return r.Engine
+}
+
+func listAuditEvents(t *testing.T, r *gin.Engine, token, query string) models.AuditEventListResponse {
+	w := performJSON(r, "GET", "/admin/audit"+query, token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response models.AuditEventListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func TestAuditHandler_RecordsProductChanges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	r := newAuditRouter("test-secret")
+	adminToken, _ := seedTokens(t, "test-secret")
+
+	w := performJSON(r, "POST", "/products", adminToken, models.CreateProductRequest{
+		Name: "Lamp", Description: "Desk lamp", Price: usd(2500), Stock: 3,
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var product models.Product
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &product))
+	createRequestID := w.Header().Get(middleware.RequestIDHeader)
+	assert.NotEmpty(t, createRequestID)
+
+	// A valid client supplied request ID is kept
+	body := `{"price": {"amount": "30.00", "currency": "USD"}}`
+	req := httptest.NewRequest("PATCH", fmt.Sprintf("/products/%d", product.ID), strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	req.Header.Set(middleware.RequestIDHeader, "client-req-1")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "client-req-1", w.Header().Get(middleware.RequestIDHeader))
+
+	w = performJSON(r, "DELETE", fmt.Sprintf("/products/%d", product.ID), adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	target := fmt.Sprintf("?target_type=product&target_id=%d", product.ID)
+	response := listAuditEvents(t, r, adminToken, target)
+	assert.Equal(t, 3, response.Total)
+	if assert.Len(t, response.Events, 3) {
+		deleted, updated, created := response.Events[0], response.Events[1], response.Events[2]
+
+		assert.Equal(t, "product.create", created.Action)
+		assert.Equal(t, 1, *created.ActorID)
+		assert.Nil(t, created.ImpersonatorID)
+		assert.Equal(t, createRequestID, created.RequestID)
+		assert.Equal(t, "Lamp", created.Changes["name"].After)
+
+		// Only the changed fields are kept
+		assert.Equal(t, "product.update", updated.Action)
+		assert.Equal(t, "client-req-1", updated.RequestID)
+		assert.Equal(t, models.AuditChange{
+			Before: map[string]interface{}{"amount": "25.00", "currency": "USD"},
+			After:  map[string]interface{}{"amount": "30.00", "currency": "USD"},
+		}, updated.Changes["price"])
+		assert.NotContains(t, updated.Changes, "name")
+
+		assert.Equal(t, "product.delete", deleted.Action)
+		assert.Equal(t, "Lamp", deleted.Changes["name"].Before)
+		assert.Nil(t, deleted.Changes["name"].After)
+	}
+
+	response = listAuditEvents(t, r, adminToken, target+"&action=product.update")
+	assert.Equal(t, 1, response.Total)
+
+	response = listAuditEvents(t, r, adminToken, "?request_id=client-req-1")
+	assert.Equal(t, 1, response.Total)
+
+	response = listAuditEvents(t, r, adminToken, "?actor_id=2")
+	assert.Equal(t, 0, response.Total)
+}
+
+func TestAuditHandler_ListAuditEvents_Filters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	r := newAuditRouter("test-secret")
+	adminToken, _ := seedTokens(t, "test-secret")
+	userToken, err := middleware.GenerateToken(models.User{ID: 2, Username: "user", Email: "user@test.com", Role: models.RoleUser}, "test-secret")
+	assert.NoError(t, err)
+
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, action := range []string{"user.update", "product.update", "product.delete"} {
+		_, err := database.DB.Exec(
+			"INSERT INTO audit_events (actor_id, action, target_type, target_id, created_at) VALUES (?, ?, ?, ?, ?)",
+			i%2+1, action, "product", "7", base.Add(time.Duration(i)*time.Hour),
+		)
+		assert.NoError(t, err)
+	}
+
+	w := performJSON(r, "GET", "/admin/audit", userToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{"all events newest first", "", []string{"product.delete", "product.update", "user.update"}},
+		{"by actor", "?actor_id=2", []string{"product.update"}},
+		{"from is inclusive", "?from=2026-01-01T13:00:00Z", []string{"product.delete", "product.update"}},
+		{"to is exclusive", "?to=2026-01-01T13:00:00Z", []string{"user.update"}},
+		{"time zones are converted", "?from=2026-01-01T14:00:00%2B02:00&to=2026-01-01T15:30:00%2B02:00", []string{"product.update", "user.update"}},
+		{"by target", "?target_type=product&target_id=8", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := listAuditEvents(t, r, adminToken, tt.query)
+			actions := []string{}
+			for _, event := range response.Events {
+				actions = append(actions, event.Action)
+			}
+			assert.Equal(t, tt.expected, actions)
+			assert.Equal(t, len(tt.expected), response.Total)
+		})
+	}
+
+	for _, query := range []string{"?actor_id=abc", "?from=yesterday", "?to=2026-01-01"} {
+		w := performJSON(r, "GET", "/admin/audit"+query, adminToken, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestAuditHandler_ExportAuditEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	r := newAuditRouter("test-secret")
+	adminToken, _ := seedTokens(t, "test-secret")
+
+	for _, action := range []string{"role.create", "role.update", "settings.update"} {
+		_, err := database.DB.Exec(
+			"INSERT INTO audit_events (actor_id, action, target_type, target_id, changes, created_at) VALUES (1, ?, 'role', 'support', '{\"name\":{\"after\":\"support\"}}', ?)",
+			action, time.Now().UTC(),
+		)
+		assert.NoError(t, err)
+	}
+
+	w := performJSON(r, "GET", "/admin/audit/export?target_type=role", adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	// One event per line, oldest first
+	actions := []string{}
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var event models.AuditEvent
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		assert.Equal(t, "support", event.Changes["name"].After)
+		actions = append(actions, event.Action)
+	}
+	assert.Equal(t, []string{"role.create", "role.update", "settings.update"}, actions)
+
+	w = performJSON(r, "GET", "/admin/audit/export?from=soon", adminToken, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAuditEvents_AppendOnly(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	_, err := database.DB.Exec(
+		"INSERT INTO audit_events (action, target_type, target_id, created_at) VALUES ('user.update', 'user', '1', ?)",
+		time.Now().UTC(),
+	)
+	assert.NoError(t, err)
+
+	_, err = database.DB.Exec("UPDATE audit_events SET action = 'user.delete'")
+	assert.ErrorContains(t, err, "append-only")
+
+	_, err = database.DB.Exec("DELETE FROM audit_events")
+	assert.ErrorContains(t, err, "append-only")
+
+	var count int
+	assert.NoError(t, database.DB.QueryRow("SELECT COUNT(*) FROM audit_events").Scan(&count))
+	assert.Equal(t, 1, count)
+}
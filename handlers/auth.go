@@ -2,29 +2,75 @@ package handlers
 
 import (
 	"database/sql"
+	"io"
+	"math"
 	"net/http"
 	"smarapp-api/database"
+	"smarapp-api/mailer"
 	"smarapp-api/middleware"
 	"smarapp-api/models"
+	"smarapp-api/oidc"
+	"smarapp-api/password"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthHandler struct {
-	JWTSecret string
+	JWTSecret            string
+	Keys                 *middleware.KeySet // Signs and verifies tokens, HS256 with JWTSecret by default
+	AccessTokenTTL       time.Duration
+	RefreshTokenTTL      time.Duration
+	Mailer               mailer.Mailer // Emails are not sent when nil
+	PublicURL            string        // Base URL of this API, used in verification links
+	PasswordResetURL     string        // Optional frontend page receiving ?token=
+	PasswordResetTTL     time.Duration
+	EmailVerificationTTL time.Duration
+	TOTPIssuer           string // Shown in authenticator apps
+	AccountLoginLimit    LoginLimit
+	IPLoginLimit         LoginLimit
+	OIDCProviders        map[string]*oidc.Provider // External login providers by name
+	OIDCStateTTL         time.Duration             // Time allowed to complete an external login
+	ImpersonationTTL     time.Duration             // Lifetime of impersonation tokens
+	Passwords            password.Hasher           // Argon2id for new passwords, bcrypt hashes are still accepted
+	PasswordPolicy       *password.Policy          // Applies to new passwords
 }
 
 func NewAuthHandler(jwtSecret string) *AuthHandler {
 	return &AuthHandler{
-		JWTSecret: jwtSecret,
+		JWTSecret:            jwtSecret,
+		Keys:                 middleware.NewHMACKeySet(jwtSecret),
+		AccessTokenTTL:       middleware.DefaultAccessTokenTTL,
+		RefreshTokenTTL:      7 * 24 * time.Hour,
+		PublicURL:            "http://localhost:8080",
+		PasswordResetTTL:     time.Hour,
+		EmailVerificationTTL: 48 * time.Hour,
+		TOTPIssuer:           "SmarApp",
+		OIDCProviders:        map[string]*oidc.Provider{},
+		OIDCStateTTL:         10 * time.Minute,
+		ImpersonationTTL:     10 * time.Minute,
+		Passwords:            password.Default(),
+		PasswordPolicy:       password.DefaultPolicy(),
+		AccountLoginLimit: LoginLimit{
+			MaxFailures:   5,
+			BaseLockout:   30 * time.Second,
+			MaxLockout:    time.Hour,
+			FailureWindow: time.Hour,
+		},
+		// Higher limit since many users can share an IP
+		IPLoginLimit: LoginLimit{
+			MaxFailures:   20,
+			BaseLockout:   30 * time.Second,
+			MaxLockout:    time.Hour,
+			FailureWindow: time.Hour,
+		},
 	}
 }
 
 // Register godoc
 // @Summary Register a new user
-// @Description Register a new user with username, email, password and optional role
+// @Description Register a new user with username, email and password. An optional invite code grants the role bound to the invite.
 // @Tags Authentication
 // @Accept json
 // @Produce json
@@ -41,36 +87,55 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// Set default role if not provided
-	if req.Role == "" {
-		req.Role = models.RoleUser
-	}
-
-	// Validate role
-	if req.Role != models.RoleUser && req.Role != models.RoleAdmin {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+	if err := h.PasswordPolicy.Check(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := h.Passwords.Hash(req.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
 	}
 
+	// Start transaction so the user and the invite redemption are stored together
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
 	// Check if user already exists
 	var existingID int
-	err = database.DB.QueryRow("SELECT id FROM users WHERE email = ? OR username = ?", req.Email, req.Username).Scan(&existingID)
+	err = tx.QueryRow("SELECT id FROM users WHERE email = ? OR username = ?", req.Email, req.Username).Scan(&existingID)
 	if err != sql.ErrNoRows {
 		c.JSON(http.StatusConflict, gin.H{"error": "User with this email or username already exists"})
 		return
 	}
 
+	// Self-service accounts always get the default role, other roles require an invite
+	role := models.RoleUser
+	var invite *models.Invite
+	if req.InviteCode != "" {
+		invite, err = findRedeemableInvite(tx, req.InviteCode, req.Email)
+		if err == errInvalidInvite {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invite code"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		role = invite.Role
+	}
+
 	// Insert user
-	result, err := database.DB.Exec(
+	now := time.Now()
+	result, err := tx.Exec(
 		"INSERT INTO users (username, email, password, role, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
-		req.Username, req.Email, string(hashedPassword), req.Role, time.Now(), time.Now(),
+		req.Username, req.Email, hashedPassword, role, now, now,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
@@ -79,31 +144,50 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	userID, _ := result.LastInsertId()
 
+	if invite != nil {
+		if err := redeemInvite(tx, invite.ID, int(userID)); err == errInvalidInvite {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invite code"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem invite"})
+			return
+		}
+	}
+
 	user := models.User{
 		ID:        int(userID),
 		Username:  req.Username,
 		Email:     req.Email,
-		Role:      req.Role,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		Role:      role,
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
 
-	// Generate token
-	token, err := middleware.GenerateToken(user, h.JWTSecret)
+	if err := recordAudit(c, tx, "user.register", auditTargetUser, user.ID, nil, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	h.trySendVerificationEmail(user.ID, user.Email)
+
+	// Generate tokens
+	response, err := h.issueTokens(c, user, false)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, models.LoginResponse{
-		Token: token,
-		User:  user,
-	})
+	c.JSON(http.StatusCreated, response)
 }
 
 // Login godoc
 // @Summary Login user
-// @Description Authenticate user with email and password
+// @Description Authenticate user with email and password. When the account has two-factor authentication enabled, a models.TwoFactorChallengeResponse is returned instead and the tokens are issued by POST /auth/2fa/verify.
 // @Tags Authentication
 // @Accept json
 // @Produce json
@@ -111,6 +195,8 @@ func (h *AuthHandler) Register(c *gin.Context) {
 // @Success 200 {object} models.LoginResponse
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 429 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -120,14 +206,31 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// Locked accounts and IPs are rejected before spending time on hashing
+	ip := c.ClientIP()
+	wait, err := h.checkLoginThrottle(req.Email, ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if wait > 0 {
+		respondTooManyAttempts(c, wait)
+		return
+	}
+
 	var user models.User
 	var hashedPassword string
-	err := database.DB.QueryRow(
-		"SELECT id, username, email, password, role, created_at, updated_at FROM users WHERE email = ?",
+	var suspendedAt sql.NullTime
+	err = database.DB.QueryRow(
+		"SELECT id, username, email, password, role, suspended_at, totp_enabled_at IS NOT NULL, created_at, updated_at FROM users WHERE email = ? AND deleted_at IS NULL",
 		req.Email,
-	).Scan(&user.ID, &user.Username, &user.Email, &hashedPassword, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	).Scan(&user.ID, &user.Username, &user.Email, &hashedPassword, &user.Role, &suspendedAt, &user.TwoFactorEnabled, &user.CreatedAt, &user.UpdatedAt)
 
 	if err == sql.ErrNoRows {
+		if err := h.recordLoginFailure(req.Email, ip, nil, loginFailureUnknownEmail, true); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
@@ -137,24 +240,267 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Check password
-	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)); err != nil {
+	if !h.Passwords.Verify(hashedPassword, req.Password) {
+		if err := h.recordLoginFailure(req.Email, ip, &user.ID, loginFailureInvalidPassword, true); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	// Generate token
-	token, err := middleware.GenerateToken(user, h.JWTSecret)
+	if suspendedAt.Valid {
+		if err := h.recordLoginFailure(req.Email, ip, &user.ID, loginFailureSuspended, false); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account suspended"})
+		return
+	}
+
+	// The plain password is only known now, so upgrade outdated hashes
+	if h.Passwords.NeedsRehash(hashedPassword) {
+		h.rehashPassword(user.ID, hashedPassword, req.Password)
+	}
+
+	// The password alone is not enough, the client has to complete the challenge
+	if user.TwoFactorEnabled {
+		h.respondWithTwoFactorChallenge(c, user)
+		return
+	}
+
+	if err := recordLoginSuccess(user.Email, ip, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Generate tokens
+	response, err := h.issueTokens(c, user, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// respondWithTwoFactorChallenge answers a successful first login step of an
+// account with two-factor authentication enabled
+func (h *AuthHandler) respondWithTwoFactorChallenge(c *gin.Context, user models.User) {
+	challenge, err := h.issueAccountToken(user.ID, user.Email, purposeTwoFactorChallenge, twoFactorChallengeTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    challenge,
+		ExpiresIn:         int64(twoFactorChallengeTTL.Seconds()),
+	})
+}
+
+func respondTooManyAttempts(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later"})
+}
+
+// Refresh godoc
+// @Summary Refresh access token
+// @Description Exchange a refresh token for a new access token and a rotated refresh token. Reusing an already rotated refresh token revokes the whole token family.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param token body models.RefreshRequest true "Refresh token"
+// @Success 200 {object} models.LoginResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/refresh [post]
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var tokenID int64
+	var userID int
+	var familyID string
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	var mfa bool
+	err := database.DB.QueryRow(
+		"SELECT id, user_id, family_id, expires_at, revoked_at, mfa FROM refresh_tokens WHERE token_hash = ?",
+		hashToken(req.RefreshToken),
+	).Scan(&tokenID, &userID, &familyID, &expiresAt, &revokedAt, &mfa)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// A revoked token being presented again means it was stolen or replayed
+	if revokedAt.Valid {
+		if err := revokeRefreshFamily(familyID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has been revoked"})
+		return
+	}
+
+	if time.Now().After(expiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token expired"})
+		return
+	}
+
+	var user models.User
+	var suspendedAt sql.NullTime
+	err = database.DB.QueryRow(
+		"SELECT id, username, email, role, suspended_at, created_at, updated_at FROM users WHERE id = ? AND deleted_at IS NULL",
+		userID,
+	).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &suspendedAt, &user.CreatedAt, &user.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if suspendedAt.Valid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account suspended"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	refreshToken, newTokenID, err := insertRefreshToken(tx, user.ID, familyID, mfa, h.RefreshTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	if err := saveSession(tx, c, user.ID, familyID, mfa, time.Now().Add(h.RefreshTokenTTL)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update session"})
+		return
+	}
+
+	// Only one concurrent refresh may consume the token
+	result, err := tx.Exec(
+		"UPDATE refresh_tokens SET revoked_at = ?, replaced_by = ? WHERE id = ? AND revoked_at IS NULL",
+		time.Now(), newTokenID, tokenID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate token"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		tx.Rollback()
+		if err := revokeRefreshFamily(familyID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has been revoked"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	accessToken, err := h.generateAccessToken(user, mfa, familyID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, models.LoginResponse{
-		Token: token,
-		User:  user,
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(h.AccessTokenTTL.Seconds()),
+		User:         user,
 	})
 }
 
+// Logout godoc
+// @Summary Logout user
+// @Description Sign out the current session and revoke the access token and, when given, the refresh token family
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param token body models.LogoutRequest false "Refresh token to revoke"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/logout [post]
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req models.LogoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	if req.RefreshToken != "" {
+		var familyID string
+		err := database.DB.QueryRow(
+			"SELECT family_id FROM refresh_tokens WHERE token_hash = ? AND user_id = ?",
+			hashToken(req.RefreshToken), userID,
+		).Scan(&familyID)
+
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if err == nil {
+			if err := revokeRefreshFamily(familyID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+				return
+			}
+		}
+	}
+
+	// The session the access token was issued for ends as well
+	if sessionID := c.GetString("session_id"); sessionID != "" {
+		if err := revokeRefreshFamily(sessionID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+			return
+		}
+	}
+
+	jti, _ := c.Get("jti")
+	if jti, ok := jti.(string); ok && jti != "" {
+		expiresAt, exists := c.Get("token_expires_at")
+		if !exists {
+			expiresAt = time.Now().Add(h.AccessTokenTTL)
+		}
+		if err := middleware.RevokeToken(jti, userID.(int), expiresAt.(time.Time)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
 // GetProfile godoc
 // @Summary Get user profile
 // @Description Get the profile of the authenticated user
@@ -168,16 +514,17 @@ func (h *AuthHandler) Login(c *gin.Context) {
 func (h *AuthHandler) GetProfile(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	
-	var user models.User
-	err := database.DB.QueryRow(
-		"SELECT id, username, email, role, created_at, updated_at FROM users WHERE id = ?",
-		userID,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.CreatedAt, &user.UpdatedAt)
-
+	user, err := fetchUser(userID.(int))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
+	user.Permissions, err = database.RolePermissions(user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
 	c.JSON(http.StatusOK, user)
 }
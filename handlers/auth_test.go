@@ -2,15 +2,22 @@ package handlers
 
 import (
 	"bytes"
+	"crypto/sha1"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"smarapp-api/database"
+	"smarapp-api/middleware"
 	"smarapp-api/models"
+	"smarapp-api/password"
 	"smarapp-api/testutil"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestAuthHandler_Register(t *testing.T) {
@@ -32,28 +39,6 @@ func TestAuthHandler_Register(t *testing.T) {
 				Username: "newuser",
 				Email:    "newuser@test.com",
 				Password: "password123",
-				Role:     models.RoleUser,
-			},
-			expectedStatus: http.StatusCreated,
-			expectToken:    true,
-		},
-		{
-			name: "valid admin registration",
-			requestBody: models.RegisterRequest{
-				Username: "newadmin",
-				Email:    "newadmin@test.com",
-				Password: "password123",
-				Role:     models.RoleAdmin,
-			},
-			expectedStatus: http.StatusCreated,
-			expectToken:    true,
-		},
-		{
-			name: "registration without role (defaults to user)",
-			requestBody: models.RegisterRequest{
-				Username: "defaultuser",
-				Email:    "defaultuser@test.com",
-				Password: "password123",
 			},
 			expectedStatus: http.StatusCreated,
 			expectToken:    true,
@@ -79,12 +64,12 @@ func TestAuthHandler_Register(t *testing.T) {
 			expectToken:    false,
 		},
 		{
-			name: "invalid role",
+			name: "invalid invite code",
 			requestBody: models.RegisterRequest{
-				Username: "testuser",
-				Email:    "test@test.com",
-				Password: "password123",
-				Role:     "invalid",
+				Username:   "testuser",
+				Email:      "test@test.com",
+				Password:   "password123",
+				InviteCode: "invalid",
 			},
 			expectedStatus: http.StatusBadRequest,
 			expectToken:    false,
@@ -115,17 +100,37 @@ func TestAuthHandler_Register(t *testing.T) {
 				assert.Equal(t, tt.requestBody.Username, response.User.Username)
 				assert.Equal(t, tt.requestBody.Email, response.User.Email)
 				
-				// Check role default
-				expectedRole := tt.requestBody.Role
-				if expectedRole == "" {
-					expectedRole = models.RoleUser
-				}
-				assert.Equal(t, expectedRole, response.User.Role)
+				// Self-service registration always gets the default role
+				assert.Equal(t, models.RoleUser, response.User.Role)
 			}
 		})
 	}
 }
 
+func TestAuthHandler_Register_IgnoresRequestedRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+
+	body := `{"username": "sneaky", "email": "sneaky@test.com", "password": "password123", "role": "admin"}`
+	req := httptest.NewRequest("POST", "/register", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	r := gin.New()
+	r.POST("/register", handler.Register)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response models.LoginResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleUser, response.User.Role)
+}
+
 func TestAuthHandler_Register_DuplicateUser(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	cleanup := testutil.SetupTestDBWithData(t)
@@ -184,7 +189,6 @@ func TestAuthHandler_Login(t *testing.T) {
 		Username: "testuser",
 		Email:    "test@test.com",
 		Password: "password123",
-		Role:     models.RoleUser,
 	}
 	jsonBody, _ := json.Marshal(registerReq)
 	req := httptest.NewRequest("POST", "/register", bytes.NewBuffer(jsonBody))
@@ -266,6 +270,101 @@ func TestAuthHandler_Login(t *testing.T) {
 	}
 }
 
+func TestAuthHandler_Login_SuspendedUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+	registered := registerTestUser(t, handler, models.RegisterRequest{
+		Username: "testuser",
+		Email:    "test@test.com",
+		Password: "password123",
+	})
+
+	_, err := database.DB.Exec("UPDATE users SET suspended_at = ? WHERE id = ?", time.Now(), registered.User.ID)
+	assert.NoError(t, err)
+
+	jsonBody, _ := json.Marshal(models.LoginRequest{Email: "test@test.com", Password: "password123"})
+	req := httptest.NewRequest("POST", "/login", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	r := gin.New()
+	r.POST("/login", handler.Login)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Account suspended")
+}
+
+func TestAuthHandler_Login_RehashesOutdatedPasswords(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	// Accounts created before the switch to Argon2id have bcrypt hashes
+	legacy, err := password.Bcrypt{Cost: bcrypt.MinCost}.Hash("password123")
+	assert.NoError(t, err)
+	_, err = database.DB.Exec(
+		"INSERT INTO users (id, username, email, password, role) VALUES (1, 'legacy', 'legacy@test.com', ?, 'user')",
+		legacy,
+	)
+	assert.NoError(t, err)
+
+	handler := NewAuthHandler("test-secret")
+	r := gin.New()
+	r.POST("/login", handler.Login)
+
+	storedHash := func() string {
+		var hash string
+		assert.NoError(t, database.DB.QueryRow("SELECT password FROM users WHERE id = 1").Scan(&hash))
+		return hash
+	}
+
+	// A failed login leaves the hash alone
+	w := performJSON(r, "POST", "/login", "", models.LoginRequest{Email: "legacy@test.com", Password: "wrongpassword"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, legacy, storedHash())
+
+	w = performJSON(r, "POST", "/login", "", models.LoginRequest{Email: "legacy@test.com", Password: "password123"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	upgraded := storedHash()
+	assert.True(t, strings.HasPrefix(upgraded, "$argon2id$"))
+	assert.False(t, handler.Passwords.NeedsRehash(upgraded))
+
+	// The new hash works and is kept on the next login
+	w = performJSON(r, "POST", "/login", "", models.LoginRequest{Email: "legacy@test.com", Password: "password123"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, upgraded, storedHash())
+}
+
+func TestAuthHandler_Register_PasswordPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+	handler.PasswordPolicy.Breached = map[[sha1.Size]byte]struct{}{sha1.Sum([]byte("qwertyuiop")): {}}
+	r := gin.New()
+	r.POST("/register", handler.Register)
+
+	w := performJSON(r, "POST", "/register", "", models.RegisterRequest{Username: "newuser", Email: "new@test.com", Password: "short1"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "at least 8 characters")
+
+	w = performJSON(r, "POST", "/register", "", models.RegisterRequest{Username: "newuser", Email: "new@test.com", Password: "qwertyuiop"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "data breach")
+
+	w = performJSON(r, "POST", "/register", "", models.RegisterRequest{Username: "newuser", Email: "new@test.com", Password: "password123"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var hash string
+	assert.NoError(t, database.DB.QueryRow("SELECT password FROM users WHERE email = 'new@test.com'").Scan(&hash))
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$"))
+}
+
 func TestAuthHandler_GetProfile(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	cleanup := testutil.SetupTestDBWithData(t)
@@ -316,3 +415,121 @@ func TestAuthHandler_GetProfile(t *testing.T) {
 		})
 	}
 }
+
+// registerTestUser registers a user through the handler and returns the login response
+func registerTestUser(t *testing.T, handler *AuthHandler, registerReq models.RegisterRequest) models.LoginResponse {
+	jsonBody, _ := json.Marshal(registerReq)
+	req := httptest.NewRequest("POST", "/register", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	r := gin.New()
+	r.POST("/register", handler.Register)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response models.LoginResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	return response
+}
+
+func TestAuthHandler_Refresh(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+
+	registered := registerTestUser(t, handler, models.RegisterRequest{
+		Username: "testuser",
+		Email:    "test@test.com",
+		Password: "password123",
+	})
+	assert.NotEmpty(t, registered.RefreshToken)
+
+	refresh := func(token string) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(models.RefreshRequest{RefreshToken: token})
+		req := httptest.NewRequest("POST", "/refresh", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		r := gin.New()
+		r.POST("/refresh", handler.Refresh)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Rotation returns a new refresh token
+	w := refresh(registered.RefreshToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var rotated models.LoginResponse
+	err := json.Unmarshal(w.Body.Bytes(), &rotated)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, rotated.Token)
+	assert.NotEmpty(t, rotated.RefreshToken)
+	assert.NotEqual(t, registered.RefreshToken, rotated.RefreshToken)
+	assert.Equal(t, "testuser", rotated.User.Username)
+
+	// Reusing the rotated token is rejected and revokes the family
+	w = refresh(registered.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "revoked")
+
+	w = refresh(rotated.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Unknown and missing tokens
+	w = refresh("not-a-real-token")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = refresh("")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAuthHandler_Logout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+
+	registered := registerTestUser(t, handler, models.RegisterRequest{
+		Username: "testuser",
+		Email:    "test@test.com",
+		Password: "password123",
+	})
+
+	r := gin.New()
+	r.POST("/refresh", handler.Refresh)
+	authorized := r.Group("/")
+	authorized.Use(middleware.AuthMiddleware("test-secret"))
+	authorized.POST("/logout", handler.Logout)
+	authorized.GET("/profile", handler.GetProfile)
+
+	jsonBody, _ := json.Marshal(models.LogoutRequest{RefreshToken: registered.RefreshToken})
+	req := httptest.NewRequest("POST", "/logout", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+registered.Token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Logged out successfully")
+
+	// The access token is denylisted
+	req = httptest.NewRequest("GET", "/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+registered.Token)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// The refresh token family is revoked
+	jsonBody, _ = json.Marshal(models.RefreshRequest{RefreshToken: registered.RefreshToken})
+	req = httptest.NewRequest("POST", "/refresh", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,464 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CategoryHandler struct{}
+
+func NewCategoryHandler() *CategoryHandler {
+	return &CategoryHandler{}
+}
+
+// ListCategories godoc
+// @Summary List categories
+// @Description Get the category tree. Top-level categories and the children of each category are ordered by sort order and name.
+// @Tags Categories
+// @Produce json
+// @Success 200 {array} models.CategoryTree
+// @Failure 500 {object} map[string]string
+// @Router /categories [get]
+func (h *CategoryHandler) ListCategories(c *gin.Context) {
+	rows, err := database.DB.Query("SELECT " + categoryColumns + " FROM categories ORDER BY sort_order, name, id")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan category"})
+			return
+		}
+		categories = append(categories, category)
+	}
+
+	jsonWithWeakETag(c, categoryTree(categories, nil))
+}
+
+// GetCategoryProducts godoc
+// @Summary List the products of a category
+// @Description Get a page of the products in a category or any of its subcategories. Paging, sorting and filters work like the product listing.
+// @Tags Categories
+// @Produce json
+// @Param slug path string true "Category slug"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "created_at, price, name or stock, prefixed with - for descending order (default -created_at)"
+// @Param currency query string false "Only products priced in this ISO 4217 currency"
+// @Param min_price query string false "Minimum price as a decimal, in currency (default USD)"
+// @Param max_price query string false "Maximum price as a decimal, in currency (default USD)"
+// @Param in_stock query bool false "Only products with stock left"
+// @Param created_by query int false "Filter by creator"
+// @Param tag query string false "Filter by tag"
+// @Success 200 {object} models.ProductListResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /categories/{slug}/products [get]
+func (h *CategoryHandler) GetCategoryProducts(c *gin.Context) {
+	var categoryID int
+	err := database.DB.QueryRow("SELECT id FROM categories WHERE slug = ?", c.Param("slug")).Scan(&categoryID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	listProducts(c, " AND id IN (SELECT product_id FROM product_categories WHERE category_id IN ("+categorySubtree+"))", []interface{}{categoryID})
+}
+
+// CreateCategory godoc
+// @Summary Create a category (Admin only)
+// @Description Create a category, optionally below a parent category. The slug is derived from the name unless given.
+// @Tags Categories
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param category body models.CreateCategoryRequest true "Category data"
+// @Success 201 {object} models.Category
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/categories [post]
+func (h *CategoryHandler) CreateCategory(c *gin.Context) {
+	var req models.CreateCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	slug := req.Slug
+	if slug == "" {
+		slug = slugify(req.Name)
+	}
+	if !models.IsValidCategorySlug(slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Slugs must contain only lowercase letters and digits separated by single hyphens"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if req.ParentID != nil && !categoryExists(c, tx, *req.ParentID) {
+		return
+	}
+	if slugTaken(c, tx, slug, 0) {
+		return
+	}
+
+	now := time.Now()
+	result, err := tx.Exec(
+		"INSERT INTO categories (name, slug, parent_id, sort_order, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		req.Name, slug, req.ParentID, req.SortOrder, now, now,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category"})
+		return
+	}
+
+	categoryID, _ := result.LastInsertId()
+
+	category := models.Category{
+		ID:        int(categoryID),
+		Name:      req.Name,
+		Slug:      slug,
+		ParentID:  req.ParentID,
+		SortOrder: req.SortOrder,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := recordAudit(c, tx, "category.create", auditTargetCategory, category.ID, nil, category); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, category)
+}
+
+// UpdateCategory godoc
+// @Summary Update a category (Admin only)
+// @Description Rename a category, change its slug or sort order, or move it below another parent. A parent_id of 0 moves it to the top level. A category cannot be moved below itself or one of its subcategories.
+// @Tags Categories
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Category ID"
+// @Param category body models.UpdateCategoryRequest true "Fields to change"
+// @Success 200 {object} models.Category
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/categories/{id} [put]
+func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
+
+	var req models.UpdateCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Slug != nil && !models.IsValidCategorySlug(*req.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Slugs must contain only lowercase letters and digits separated by single hyphens"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := scanCategory(tx.QueryRow("SELECT "+categoryColumns+" FROM categories WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	category := before
+	if req.Name != nil {
+		category.Name = *req.Name
+	}
+	if req.Slug != nil && *req.Slug != category.Slug {
+		if slugTaken(c, tx, *req.Slug, id) {
+			return
+		}
+		category.Slug = *req.Slug
+	}
+	if req.SortOrder != nil {
+		category.SortOrder = *req.SortOrder
+	}
+	if req.ParentID != nil {
+		if *req.ParentID == 0 {
+			category.ParentID = nil
+		} else {
+			if !categoryExists(c, tx, *req.ParentID) {
+				return
+			}
+
+			var inSubtree bool
+			err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM ("+categorySubtree+") WHERE id = ?)", id, *req.ParentID).Scan(&inSubtree)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
+			}
+			if inSubtree {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "A category cannot be moved below itself or one of its subcategories"})
+				return
+			}
+			category.ParentID = req.ParentID
+		}
+	}
+
+	category.UpdatedAt = time.Now()
+	_, err = tx.Exec(
+		"UPDATE categories SET name = ?, slug = ?, parent_id = ?, sort_order = ?, updated_at = ? WHERE id = ?",
+		category.Name, category.Slug, category.ParentID, category.SortOrder, category.UpdatedAt, id,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "category.update", auditTargetCategory, id, before, category); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// DeleteCategory godoc
+// @Summary Delete a category (Admin only)
+// @Description Delete a category without subcategories. Its products stay in the catalog and only lose the assignment.
+// @Tags Categories
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Category ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/categories/{id} [delete]
+func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	category, err := scanCategory(tx.QueryRow("SELECT "+categoryColumns+" FROM categories WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var children int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM categories WHERE parent_id = ?", id).Scan(&children); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if children > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Category has subcategories, move or delete them first"})
+		return
+	}
+
+	if err := bumpProductVersions(tx, "SELECT product_id FROM product_categories WHERE category_id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM categories WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "category.delete", auditTargetCategory, id, category, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+}
+
+// categoryColumns is the column list read by scanCategory
+const categoryColumns = "id, name, slug, parent_id, sort_order, created_at, updated_at"
+
+// categorySubtree selects the IDs of a category, given as its only
+// argument, and all of its descendants
+const categorySubtree = `
+	WITH RECURSIVE subtree(id) AS (
+		SELECT ?
+		UNION
+		SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+	)
+	SELECT id FROM subtree`
+
+func scanCategory(row rowScanner) (models.Category, error) {
+	var category models.Category
+	var parentID sql.NullInt64
+	err := row.Scan(
+		&category.ID, &category.Name, &category.Slug, &parentID,
+		&category.SortOrder, &category.CreatedAt, &category.UpdatedAt,
+	)
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		category.ParentID = &id
+	}
+	return category, err
+}
+
+// categoryTree nests the categories below parent. categories must already
+// be in display order.
+func categoryTree(categories []models.Category, parent *int) []models.CategoryTree {
+	tree := []models.CategoryTree{}
+	for _, category := range categories {
+		if (parent == nil) != (category.ParentID == nil) || (parent != nil && *parent != *category.ParentID) {
+			continue
+		}
+		id := category.ID
+		tree = append(tree, models.CategoryTree{Category: category, Children: categoryTree(categories, &id)})
+	}
+	return tree
+}
+
+// slugify derives a slug from a name: lowercase letters and digits with
+// every other run of characters replaced by a single hyphen
+func slugify(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return r > unicode.MaxASCII || !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "-")
+}
+
+// categoryExists responds with 400 and returns false if there is no category
+// with the given ID
+func categoryExists(c *gin.Context, tx *sql.Tx, id int) bool {
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM categories WHERE id = ?)", id).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Category %d does not exist", id)})
+	}
+	return exists
+}
+
+// slugTaken responds with 409 and returns true if another category than
+// exceptID uses slug
+func slugTaken(c *gin.Context, tx *sql.Tx, slug string, exceptID int) bool {
+	var taken bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM categories WHERE slug = ? AND id != ?)", slug, exceptID).Scan(&taken); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return true
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "Category with this slug already exists"})
+	}
+	return taken
+}
+
+// validateCategoryIDs checks that every category of a product exists and
+// returns the IDs sorted and without duplicates
+func validateCategoryIDs(c *gin.Context, ids []int) ([]int, bool) {
+	unique := []int{}
+	seen := map[int]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		var exists bool
+		if err := database.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM categories WHERE id = ?)", id).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return nil, false
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Category %d does not exist", id)})
+			return nil, false
+		}
+		unique = append(unique, id)
+	}
+	sort.Ints(unique)
+	return unique, true
+}
+
+// setProductCategories replaces the categories of a product
+func setProductCategories(tx *sql.Tx, productID int, categoryIDs []int) error {
+	if _, err := tx.Exec("DELETE FROM product_categories WHERE product_id = ?", productID); err != nil {
+		return err
+	}
+	for _, categoryID := range categoryIDs {
+		if _, err := tx.Exec("INSERT INTO product_categories (product_id, category_id) VALUES (?, ?)", productID, categoryID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
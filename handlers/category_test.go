@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"smarapp-api/middleware"
+	"smarapp-api/models"
+	"smarapp-api/testutil"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newCatalogRouter wires the product, category and tag routes behind the real middleware, as in main.go
+func newCatalogRouter(jwtSecret string) *gin.Engine {
+	productHandler := NewProductHandler()
+	categoryHandler := NewCategoryHandler()
+	tagHandler := NewTagHandler()
+
+	r := newTestRouter(jwtSecret)
+	r.GET("/products", productHandler.GetProducts)
+	r.GET("/products/:id", productHandler.GetProduct)
+	r.GET("/categories", categoryHandler.ListCategories)
+	r.GET("/categories/:slug/products", categoryHandler.GetCategoryProducts)
+	r.GET("/tags", tagHandler.ListTags)
+
+	products := r.Require("/products", models.PermissionProductsWrite)
+	products.POST("", productHandler.CreateProduct)
+	products.PATCH("/:id", productHandler.PatchProduct)
+
+	catalog := r.Require("/admin", models.PermissionProductsWrite)
+	catalog.POST("/categories", categoryHandler.CreateCategory)
+	catalog.PUT("/categories/:id", categoryHandler.UpdateCategory)
+	catalog.DELETE("/categories/:id", categoryHandler.DeleteCategory)
+	catalog.POST("/tags", tagHandler.CreateTag)
+	catalog.PUT("/tags/:id", tagHandler.UpdateTag)
+	catalog.DELETE("/tags/:id", tagHandler.DeleteTag)
+	return r.Engine
+}
+
+func createCategory(t *testing.T, r *gin.Engine, token string, req models.CreateCategoryRequest) models.Category {
+	w := performJSON(r, "POST", "/admin/categories", token, req)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var category models.Category
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &category))
+	return category
+}
+
+func productNames(t *testing.T, r *gin.Engine, path string) []string {
+	w := performJSON(r, "GET", path, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response models.ProductListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	names := []string{}
+	for _, product := range response.Products {
+		names = append(names, product.Name)
+	}
+	return names
+}
+
+func TestCategoryHandler_CategoryTree(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	jwtSecret := "test-secret"
+	r := newCatalogRouter(jwtSecret)
+
+	adminToken, _ := seedTokens(t, jwtSecret)
+	userToken, err := middleware.GenerateToken(models.User{ID: 2, Username: "user", Email: "user@test.com", Role: models.RoleUser}, jwtSecret)
+	assert.NoError(t, err)
+
+	w := performJSON(r, "POST", "/admin/categories", userToken, models.CreateCategoryRequest{Name: "Home"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	home := createCategory(t, r, adminToken, models.CreateCategoryRequest{Name: "Home & Garden", SortOrder: 2})
+	assert.Equal(t, "home-garden", home.Slug)
+	assert.Nil(t, home.ParentID)
+	office := createCategory(t, r, adminToken, models.CreateCategoryRequest{Name: "Office", SortOrder: 1})
+	lighting := createCategory(t, r, adminToken, models.CreateCategoryRequest{Name: "Lighting", ParentID: &home.ID})
+	lamps := createCategory(t, r, adminToken, models.CreateCategoryRequest{Name: "Lamps", Slug: "desk-lamps", ParentID: &lighting.ID})
+	assert.Equal(t, home.ID, *lighting.ParentID)
+
+	// Invalid slugs, unknown parents and duplicate slugs
+	w = performJSON(r, "POST", "/admin/categories", adminToken, models.CreateCategoryRequest{Name: "Lamps", Slug: "Desk Lamps"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	missing := 999
+	w = performJSON(r, "POST", "/admin/categories", adminToken, models.CreateCategoryRequest{Name: "Lamps", ParentID: &missing})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performJSON(r, "POST", "/admin/categories", adminToken, models.CreateCategoryRequest{Name: "Office"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = performJSON(r, "GET", "/categories", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tree []models.CategoryTree
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tree))
+	if assert.Len(t, tree, 2) {
+		assert.Equal(t, "office", tree[0].Slug, "sorted by sort order")
+		assert.Empty(t, tree[0].Children)
+		assert.Equal(t, "home-garden", tree[1].Slug)
+		if assert.Len(t, tree[1].Children, 1) {
+			assert.Equal(t, "lighting", tree[1].Children[0].Slug)
+			assert.Len(t, tree[1].Children[0].Children, 1)
+		}
+	}
+
+	// Products are listed with the products of subcategories
+	w = performJSON(r, "PATCH", "/products/1", adminToken, models.PatchProductRequest{CategoryIDs: []int{lamps.ID}})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = performJSON(r, "PATCH", "/products/2", adminToken, models.PatchProductRequest{CategoryIDs: []int{home.ID, office.ID, home.ID}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var product models.Product
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &product))
+	assert.Equal(t, []int{home.ID, office.ID}, product.CategoryIDs)
+
+	assert.ElementsMatch(t, []string{"Test Product 1", "Test Product 2"}, productNames(t, r, "/categories/home-garden/products"))
+	assert.Equal(t, []string{"Test Product 1"}, productNames(t, r, "/categories/lighting/products"))
+	assert.Equal(t, []string{"Test Product 2"}, productNames(t, r, "/categories/office/products"))
+	assert.Equal(t, []string{"Test Product 2"}, productNames(t, r, "/categories/home-garden/products?sort=price&min_price=100"))
+	w = performJSON(r, "GET", "/categories/garden/products", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = performJSON(r, "PATCH", "/products/1", adminToken, models.PatchProductRequest{CategoryIDs: []int{missing}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// A category cannot move below itself or its descendants
+	for _, parent := range []int{home.ID, lamps.ID} {
+		w = performJSON(r, "PUT", fmt.Sprintf("/admin/categories/%d", home.ID), adminToken, models.UpdateCategoryRequest{ParentID: &parent})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+
+	// Moving a subtree changes which products a category lists
+	w = performJSON(r, "PUT", fmt.Sprintf("/admin/categories/%d", lighting.ID), adminToken, models.UpdateCategoryRequest{ParentID: &office.ID})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.ElementsMatch(t, []string{"Test Product 1", "Test Product 2"}, productNames(t, r, "/categories/office/products"))
+	assert.Equal(t, []string{"Test Product 2"}, productNames(t, r, "/categories/home-garden/products"))
+
+	top := 0
+	w = performJSON(r, "PUT", fmt.Sprintf("/admin/categories/%d", lighting.ID), adminToken, models.UpdateCategoryRequest{ParentID: &top})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var moved models.Category
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &moved))
+	assert.Nil(t, moved.ParentID)
+
+	slug := "office"
+	w = performJSON(r, "PUT", fmt.Sprintf("/admin/categories/%d", lighting.ID), adminToken, models.UpdateCategoryRequest{Slug: &slug})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Categories with subcategories cannot be deleted; deleting a leaf keeps its products
+	w = performJSON(r, "DELETE", fmt.Sprintf("/admin/categories/%d", lighting.ID), adminToken, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = performJSON(r, "DELETE", fmt.Sprintf("/admin/categories/%d", lamps.ID), adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performJSON(r, "GET", "/products/1", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &product))
+	assert.Empty(t, product.CategoryIDs)
+}
+
+func TestTagHandler_Tags(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	jwtSecret := "test-secret"
+	r := newCatalogRouter(jwtSecret)
+
+	adminToken, _ := seedTokens(t, jwtSecret)
+
+	// Tags are normalized and created on first use
+	w := performJSON(r, "POST", "/products", adminToken, models.CreateProductRequest{
+		Name: "Lamp", Description: "A lamp", Price: usd(2000), Stock: 3,
+		Tags: []string{"  Summer   Sale ", "new", "summer sale"},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var lamp models.Product
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &lamp))
+	assert.Equal(t, []string{"new", "summer sale"}, lamp.Tags)
+	assert.Equal(t, []int{}, lamp.CategoryIDs)
+
+	w = performJSON(r, "POST", "/products", adminToken, models.CreateProductRequest{
+		Name: "Lamp", Description: "A lamp", Price: usd(2000), Stock: 3, Tags: []string{" "},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performJSON(r, "POST", "/admin/tags", adminToken, models.TagRequest{Name: "Clearance"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var clearance models.Tag
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &clearance))
+	assert.Equal(t, "clearance", clearance.Name)
+	w = performJSON(r, "POST", "/admin/tags", adminToken, models.TagRequest{Name: "NEW"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = performJSON(r, "PATCH", "/products/1", adminToken, models.PatchProductRequest{Tags: []string{"new"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.ElementsMatch(t, []string{"Lamp", "Test Product 1"}, productNames(t, r, "/products?tag=New"))
+	assert.Equal(t, []string{"Lamp"}, productNames(t, r, "/products?tag=summer+sale"))
+
+	w = performJSON(r, "GET", "/tags", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tags []models.Tag
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tags))
+	if assert.Len(t, tags, 3) {
+		assert.Equal(t, "clearance", tags[0].Name)
+		assert.Equal(t, 0, tags[0].Products)
+		assert.Equal(t, "new", tags[1].Name)
+		assert.Equal(t, 2, tags[1].Products)
+	}
+	newTag := tags[1]
+
+	// Renaming applies to every product and cannot merge tags
+	w = performJSON(r, "PUT", fmt.Sprintf("/admin/tags/%d", newTag.ID), adminToken, models.TagRequest{Name: "clearance"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = performJSON(r, "PUT", fmt.Sprintf("/admin/tags/%d", newTag.ID), adminToken, models.TagRequest{Name: "Fresh"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performJSON(r, "GET", fmt.Sprintf("/products/%d", lamp.ID), "", nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &lamp))
+	assert.Equal(t, []string{"fresh", "summer sale"}, lamp.Tags)
+
+	// Omitting tags keeps them, an empty list or null removes them
+	stock := 3
+	w = performJSON(r, "PATCH", fmt.Sprintf("/products/%d", lamp.ID), adminToken, models.PatchProductRequest{Stock: &stock})
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &lamp))
+	assert.Equal(t, []string{"fresh", "summer sale"}, lamp.Tags)
+	w = performJSON(r, "PATCH", fmt.Sprintf("/products/%d", lamp.ID), adminToken, map[string]interface{}{"tags": []string{}})
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &lamp))
+	assert.Empty(t, lamp.Tags)
+	w = performJSON(r, "PATCH", "/products/1", adminToken, map[string]interface{}{"tags": nil})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, productNames(t, r, "/products?tag=fresh"), "Test Product 1")
+
+	w = performJSON(r, "DELETE", fmt.Sprintf("/admin/tags/%d", newTag.ID), adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, productNames(t, r, "/products?tag=fresh"))
+	w = performJSON(r, "DELETE", fmt.Sprintf("/admin/tags/%d", newTag.ID), adminToken, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"database/sql"
 	"net/http"
 	"smarapp-api/database"
+	"smarapp-api/middleware"
 	"smarapp-api/models"
 	"smarapp-api/websocket"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -32,7 +35,8 @@ func (h *ChatHandler) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
-	websocket.ServeWS(h.Hub, c.Writer, c.Request, userID.(int), username.(string))
+	// Admins impersonating a user can follow the chat but not post as them
+	websocket.ServeWS(h.Hub, c.Writer, c.Request, userID.(int), username.(string), middleware.IsImpersonating(c))
 }
 
 func (h *ChatHandler) GetChatHistory(c *gin.Context) {
@@ -67,3 +71,58 @@ func (h *ChatHandler) GetChatHistory(c *gin.Context) {
 
 	c.JSON(http.StatusOK, messages)
 }
+
+// DeleteMessage godoc
+// @Summary Delete a chat message (Moderators only)
+// @Description Remove a message from the chat history. Requires the chat:moderate permission.
+// @Tags Chat
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Message ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /chat/messages/{id} [delete]
+func (h *ChatHandler) DeleteMessage(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var message models.ChatMessage
+	err = tx.QueryRow(
+		"DELETE FROM chat_messages WHERE id = ? RETURNING id, user_id, username, message, created_at",
+		id,
+	).Scan(&message.ID, &message.UserID, &message.Username, &message.Message, &message.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete message"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "chat_message.delete", auditTargetChatMessage, message.ID, message, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message deleted successfully"})
+}
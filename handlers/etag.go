@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// versionETag is the strong ETag of a product or order, taken from its
+// version column
+func versionETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatch reports whether a change may go ahead under the request's If-Match
+// header. Without the header every version matches. Weak tags never match,
+// as RFC 9110 requires strong comparison for If-Match.
+func ifMatch(c *gin.Context, etag string) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the ETag of a response and, when it matches the request's
+// If-None-Match header, answers 304 Not Modified. Tags are compared weakly.
+func notModified(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+
+	header := c.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// jsonWithWeakETag writes a 200 response with a weak ETag hashed from the
+// body, or 304 if the client already has it. Listings have no single version
+// to go by, so they are tagged by content.
+func jsonWithWeakETag(c *gin.Context, obj interface{}) {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode response"})
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	if notModified(c, `W/"`+hex.EncodeToString(sum[:16])+`"`) {
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
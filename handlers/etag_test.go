@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"smarapp-api/middleware"
+	"smarapp-api/models"
+	"smarapp-api/testutil"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newETagRouter wires the product and order routes behind the real middleware, as in main.go
+func newETagRouter(jwtSecret string) *gin.Engine {
+	productHandler := NewProductHandler()
+	orderHandler := NewOrderHandler()
+	tagHandler := NewTagHandler()
+
+	r := newTestRouter(jwtSecret)
+	r.GET("/products", productHandler.GetProducts)
+	r.GET("/products/:id", productHandler.GetProduct)
+	r.Protected.POST("/orders", orderHandler.CreateOrder)
+	r.Protected.GET("/orders", orderHandler.GetUserOrders)
+	r.Protected.GET("/orders/:id", orderHandler.GetOrder)
+
+	products := r.Require("/products", models.PermissionProductsWrite)
+	products.PUT("/:id", productHandler.UpdateProduct)
+	products.PATCH("/:id", productHandler.PatchProduct)
+	products.DELETE("/:id", productHandler.DeleteProduct)
+
+	tags := r.Require("/admin/tags", models.PermissionProductsWrite)
+	tags.PUT("/:id", tagHandler.UpdateTag)
+	return r.Engine
+}
+
+// performConditional sends a JSON request with a conditional header
+func performConditional(r *gin.Engine, method, path, token, header, etag, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set(header, etag)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestProductHandler_ETags(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	jwtSecret := "test-secret"
+	r := newETagRouter(jwtSecret)
+	adminToken, _ := seedTokens(t, jwtSecret)
+
+	w := performJSON(r, "GET", "/products/1", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, `"1"`, etag)
+
+	w = performConditional(r, "GET", "/products/1", "", "If-None-Match", `"7", `+etag, "")
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	w = performConditional(r, "GET", "/products/1", "", "If-None-Match", "W/"+etag, "")
+	assert.Equal(t, http.StatusNotModified, w.Code, "If-None-Match compares weakly")
+
+	// The first writer wins, the second one is told to reload
+	w = performConditional(r, "PATCH", "/products/1", adminToken, "If-Match", etag, `{"price": {"amount": "89.99", "currency": "USD"}}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	updated := w.Header().Get("ETag")
+	assert.Equal(t, `"2"`, updated)
+	var product models.Product
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &product))
+	assert.Equal(t, 2, product.Version)
+
+	w = performConditional(r, "PATCH", "/products/1", adminToken, "If-Match", etag, `{"price": {"amount": "79.99", "currency": "USD"}}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = performConditional(r, "PUT", "/products/1", adminToken, "If-Match", etag,
+		`{"name": "Lamp", "description": "Desk lamp", "price": {"amount": "79.99", "currency": "USD"}, "stock": 1}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = performConditional(r, "PATCH", "/products/1", adminToken, "If-Match", "W/"+updated, `{"price": {"amount": "79.99", "currency": "USD"}}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code, "If-Match compares strongly")
+	w = performConditional(r, "DELETE", "/products/2", adminToken, "If-Match", `"5"`, "")
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = performConditional(r, "GET", "/products/1", "", "If-None-Match", etag, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &product))
+	assert.Equal(t, *usd(8999), product.Price)
+
+	// Stock taken by an order is a change as well
+	userToken, err := middleware.GenerateToken(models.User{ID: 2, Username: "user", Email: "user@test.com", Role: models.RoleUser}, jwtSecret)
+	assert.NoError(t, err)
+	w = performJSON(r, "POST", "/orders", userToken, models.CreateOrderRequest{ProductID: 1, Quantity: 1})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var order models.OrderResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &order))
+	assert.Equal(t, 3, order.Product.Version)
+	w = performConditional(r, "PATCH", "/products/1", adminToken, "If-Match", updated, `{"price": {"amount": "79.99", "currency": "USD"}}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	// Orders are tagged by their content, which includes the product name
+	path := fmt.Sprintf("/orders/%d", order.Order.ID)
+	w = performJSON(r, "GET", path, userToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	orderETag := w.Header().Get("ETag")
+	assert.True(t, strings.HasPrefix(orderETag, `W/"`), orderETag)
+	w = performConditional(r, "GET", path, userToken, "If-None-Match", orderETag, "")
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	w = performConditional(r, "PATCH", "/products/1", adminToken, "If-Match", "", `{"name": "Renamed Product"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performConditional(r, "GET", path, userToken, "If-None-Match", orderETag, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Renamed Product")
+
+	w = performConditional(r, "DELETE", "/products/2", adminToken, "If-Match", `"1"`, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestProductHandler_ListingETags(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	jwtSecret := "test-secret"
+	r := newETagRouter(jwtSecret)
+	adminToken, _ := seedTokens(t, jwtSecret)
+
+	w := performJSON(r, "GET", "/products", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.True(t, strings.HasPrefix(etag, `W/"`), etag)
+	var page models.ProductListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, 2, page.Total)
+
+	w = performConditional(r, "GET", "/products", "", "If-None-Match", etag, "")
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	w = performConditional(r, "GET", "/products?sort=price", "", "If-None-Match", etag, "")
+	assert.Equal(t, http.StatusOK, w.Code, "another page has another tag")
+
+	// Renaming a tag changes the products carrying it
+	w = performJSON(r, "PATCH", "/products/2", adminToken, models.PatchProductRequest{Tags: []string{"sale"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performConditional(r, "GET", "/products", "", "If-None-Match", etag, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag = w.Header().Get("ETag")
+	product := performJSON(r, "GET", "/products/2", "", nil).Header().Get("ETag")
+
+	w = performJSON(r, "PUT", "/admin/tags/1", adminToken, models.TagRequest{Name: "clearance"})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = performConditional(r, "GET", "/products", "", "If-None-Match", etag, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performConditional(r, "GET", "/products/2", "", "If-None-Match", product, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
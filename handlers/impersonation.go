@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/middleware"
+	"smarapp-api/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImpersonateUser godoc
+// @Summary Impersonate a user (Admin only)
+// @Description Get a short-lived token acting as a user, to reproduce what they see. The token carries the admin in an "act" claim, cannot be refreshed and cannot reach admin or account credential endpoints. It is tied to a session of the user, so signing out the user's sessions ends it. The start and every request made with it are audited.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} models.ImpersonationResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/users/{id}/impersonate [post]
+func (h *AuthHandler) ImpersonateUser(c *gin.Context) {
+	id, ok := targetUserID(c, "impersonate")
+	if !ok {
+		return
+	}
+
+	adminID := c.GetInt("user_id")
+	admin, err := fetchUser(adminID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	user, err := fetchUser(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if user.SuspendedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account suspended"})
+		return
+	}
+
+	// Impersonation is for reproducing what customers see, not for borrowing
+	// another admin's privileges
+	permissions, err := database.RolePermissions(user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if len(permissions) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Users with admin permissions cannot be impersonated"})
+		return
+	}
+
+	claims, err := middleware.NewClaims(user, h.ImpersonationTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	claims.Actor = &middleware.Actor{UserID: admin.ID, Username: admin.Username}
+
+	// The token gets a session of the user, so that signing out their
+	// sessions ends the impersonation as well
+	claims.SessionID, err = middleware.NewTokenID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	token, err := h.Keys.Sign(claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := saveSession(tx, c, user.ID, claims.SessionID, false, claims.ExpiresAt.Time); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	if err := middleware.RecordImpersonationEvent(tx, c, admin.ID, user.ID, middleware.ImpersonationActionStart, http.StatusOK); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record impersonation"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "user.impersonate", auditTargetUser, user.ID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ImpersonationResponse{
+		Token:        token,
+		ExpiresIn:    int64(h.ImpersonationTTL.Seconds()),
+		User:         user,
+		Impersonator: admin,
+	})
+}
+
+// ListImpersonationEvents godoc
+// @Summary List impersonation events (Admin only)
+// @Description Get a paginated audit log of impersonations, newest first: when each one started and every request made while impersonating
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number (default 1)"
+// @Param page_size query int false "Page size (default 20, max 100)"
+// @Param admin_id query int false "Filter by impersonating admin"
+// @Param user_id query int false "Filter by impersonated user"
+// @Success 200 {object} models.ImpersonationEventListResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/impersonation-events [get]
+func (h *UserHandler) ListImpersonationEvents(c *gin.Context) {
+	page, pageSize, err := parsePagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	where := " WHERE 1 = 1"
+	args := []interface{}{}
+
+	for _, filter := range []string{"admin_id", "user_id"} {
+		value := c.Query(filter)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + filter})
+			return
+		}
+		where += " AND " + filter + " = ?"
+		args = append(args, id)
+	}
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM impersonation_events"+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count impersonation events"})
+		return
+	}
+
+	rows, err := database.DB.Query(
+		"SELECT id, admin_id, user_id, action, method, path, status, ip_address, created_at FROM impersonation_events"+where+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, pageSize, (page-1)*pageSize)...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch impersonation events"})
+		return
+	}
+	defer rows.Close()
+
+	events := []models.ImpersonationEvent{}
+	for rows.Next() {
+		var event models.ImpersonationEvent
+		err := rows.Scan(
+			&event.ID, &event.AdminID, &event.UserID, &event.Action, &event.Method,
+			&event.Path, &event.Status, &event.IPAddress, &event.CreatedAt,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan impersonation event"})
+			return
+		}
+		events = append(events, event)
+	}
+
+	c.JSON(http.StatusOK, models.ImpersonationEventListResponse{
+		Events:   events,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	})
+}
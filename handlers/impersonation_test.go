@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/middleware"
+	"smarapp-api/models"
+	"smarapp-api/testutil"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newImpersonationRouter wires the impersonation routes behind the real middleware, as in main.go
+func newImpersonationRouter(handler *AuthHandler) *gin.Engine {
+	userHandler := NewUserHandler()
+	orderHandler := NewOrderHandler()
+
+	r := newTestRouter(handler.JWTSecret)
+	r.Protected.GET("/orders", orderHandler.GetUserOrders)
+
+	account := r.Protected.Group("/profile")
+	account.Use(middleware.SessionOnly())
+	account.POST("/password", handler.ChangePassword)
+
+	users := r.Require("/admin/users", models.PermissionUsersRead)
+	users.GET("", userHandler.ListUsers)
+	users.POST("/:id/impersonate", middleware.RequirePermission(models.PermissionUsersImpersonate), handler.ImpersonateUser)
+	users.DELETE("/:id/sessions", middleware.RequirePermission(models.PermissionUsersWrite), userHandler.RevokeUserSessions)
+
+	events := r.Require("/admin/impersonation-events", models.PermissionUsersRead)
+	events.GET("", userHandler.ListImpersonationEvents)
+	return r.Engine
+}
+
+func TestAuthHandler_ImpersonateUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+	r := newImpersonationRouter(handler)
+
+	adminToken, _ := seedTokens(t, handler.JWTSecret)
+	userToken, err := middleware.GenerateToken(models.User{ID: 2, Username: "user", Email: "user@test.com", Role: models.RoleUser}, handler.JWTSecret)
+	assert.NoError(t, err)
+
+	// Only admins may impersonate, and never other admins or themselves
+	w := performJSON(r, "POST", "/admin/users/1/impersonate", userToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performJSON(r, "POST", "/admin/users/1/impersonate", adminToken, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	_, err = database.DB.Exec(
+		"INSERT INTO users (id, username, email, password, role) VALUES (3, 'other_admin', 'other@test.com', '', 'admin')",
+	)
+	assert.NoError(t, err)
+	w = performJSON(r, "POST", "/admin/users/3/impersonate", adminToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performJSON(r, "POST", "/admin/users/999/impersonate", adminToken, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = performJSON(r, "POST", "/admin/users/2/impersonate", adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response models.ImpersonationResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 2, response.User.ID)
+	assert.Equal(t, 1, response.Impersonator.ID)
+	assert.Equal(t, int64(handler.ImpersonationTTL.Seconds()), response.ExpiresIn)
+
+	// The token carries the admin as actor
+	claims := &middleware.Claims{}
+	assert.NoError(t, handler.Keys.Parse(response.Token, claims))
+	assert.Equal(t, 2, claims.UserID)
+	if assert.NotNil(t, claims.Actor) {
+		assert.Equal(t, 1, claims.Actor.UserID)
+	}
+
+	// The admin sees what the user sees
+	w = performJSON(r, "GET", "/orders", response.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var orders []models.Order
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &orders))
+	assert.Len(t, orders, 1)
+
+	// Sensitive actions are blocked
+	w = performJSON(r, "POST", "/profile/password", response.Token, models.ChangePasswordRequest{
+		CurrentPassword: "password123",
+		NewPassword:     "newpassword123",
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "impersonating")
+
+	w = performJSON(r, "GET", "/admin/users", response.Token, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "impersonating")
+
+	// The start and every request are audited
+	w = performJSON(r, "GET", "/admin/impersonation-events?user_id=2", adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var events models.ImpersonationEventListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+	assert.Equal(t, 4, events.Total)
+	if assert.Len(t, events.Events, 4) {
+		assert.Equal(t, "/admin/users", events.Events[0].Path)
+		assert.Equal(t, http.StatusForbidden, events.Events[0].Status)
+		assert.Equal(t, "/orders", events.Events[2].Path)
+		assert.Equal(t, http.StatusOK, events.Events[2].Status)
+		assert.Equal(t, "start", events.Events[3].Action)
+		assert.Equal(t, 1, events.Events[3].AdminID)
+	}
+
+	// Signing out the user's sessions ends the impersonation
+	assert.NotEmpty(t, claims.SessionID)
+	w = performJSON(r, "DELETE", "/admin/users/2/sessions", adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var revoked bool
+	err = database.DB.QueryRow("SELECT revoked_at IS NOT NULL FROM sessions WHERE id = ? AND user_id = 2", claims.SessionID).Scan(&revoked)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+	w = performJSON(r, "GET", "/orders", response.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Impersonation ends when the admin loses the permission
+	w = performJSON(r, "POST", "/admin/users/2/impersonate", adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	w = performJSON(r, "GET", "/orders", response.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, err = database.DB.Exec("UPDATE users SET role = 'user' WHERE id = 1")
+	assert.NoError(t, err)
+	w = performJSON(r, "GET", "/orders", response.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetProductInventory godoc
+// @Summary Get the inventory ledger of a product (Admin only)
+// @Description Get a paginated list of a product's stock movements, newest first: receipts, sales, adjustments and returns with their reason and actor. ledger_stock is the sum of all movements and matches stock unless they drifted apart.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Param variant_id query int false "Only movements of this variant"
+// @Param page query int false "Page number (default 1)"
+// @Param page_size query int false "Page size (default 20, max 100)"
+// @Success 200 {object} models.InventoryResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/products/{id}/inventory [get]
+func (h *ProductHandler) GetProductInventory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	page, pageSize, err := parsePagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := models.InventoryResponse{ProductID: id, Page: page, PageSize: pageSize}
+	err = database.DB.QueryRow(
+		"SELECT stock, (SELECT COALESCE(SUM(quantity), 0) FROM inventory_movements WHERE product_id = products.id) FROM products WHERE id = ?", id,
+	).Scan(&response.Stock, &response.LedgerStock)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	where := " WHERE product_id = ?"
+	args := []interface{}{id}
+	if value := c.Query("variant_id"); value != "" {
+		variantID, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+			return
+		}
+		where += " AND variant_id = ?"
+		args = append(args, variantID)
+	}
+
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM inventory_movements"+where, args...).Scan(&response.Total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count movements"})
+		return
+	}
+
+	rows, err := database.DB.Query(
+		"SELECT "+movementColumns+" FROM inventory_movements"+where+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, pageSize, (page-1)*pageSize)...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch movements"})
+		return
+	}
+	defer rows.Close()
+
+	response.Movements = []models.InventoryMovement{}
+	for rows.Next() {
+		movement, err := scanMovement(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan movement"})
+			return
+		}
+		response.Movements = append(response.Movements, movement)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RecordInventoryMovement godoc
+// @Summary Record a stock movement (Admin only)
+// @Description Record stock received, returned or corrected by hand. Receipts and returns take a positive quantity, adjustments a positive or negative one. Products with variants take movements per variant. Stock cannot go below zero.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Param movement body models.CreateInventoryMovementRequest true "Movement"
+// @Success 201 {object} models.InventoryMovement
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/products/{id}/inventory [post]
+func (h *ProductHandler) RecordInventoryMovement(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req models.CreateInventoryMovementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Kind != models.MovementAdjustment && req.Quantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Receipts and returns take a positive quantity"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	product, err := loadProduct(tx, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var hasVariants bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM product_variants WHERE product_id = ?)", id).Scan(&hasVariants); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	stock := product.Stock
+	switch {
+	case hasVariants && req.VariantID == nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "variant_id is required for products with variants"})
+		return
+	case hasVariants:
+		variant, err := loadVariant(tx, id, *req.VariantID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		stock = variant.Stock
+	case req.VariantID != nil:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+	if stock+req.Quantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock cannot go below zero"})
+		return
+	}
+
+	movement := models.InventoryMovement{
+		ProductID: id,
+		VariantID: req.VariantID,
+		Kind:      req.Kind,
+		Quantity:  req.Quantity,
+		Reason:    req.Reason,
+	}
+	if err := recordMovement(c, tx, &movement); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record movement"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "product.inventory_movement", auditTargetProduct, id, nil, movement); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, movement)
+}
+
+// recordMovement adds a movement to the inventory ledger, which applies it to
+// the stock of the product or variant. The acting user is taken from the
+// request.
+func recordMovement(c *gin.Context, tx *sql.Tx, movement *models.InventoryMovement) error {
+	if userID, ok := c.Get("user_id"); ok {
+		actorID := userID.(int)
+		movement.ActorID = &actorID
+	}
+	movement.CreatedAt = time.Now()
+
+	return tx.QueryRow(`
+		INSERT INTO inventory_movements (product_id, variant_id, kind, quantity, reason, actor_id, order_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`,
+		movement.ProductID, movement.VariantID, movement.Kind, movement.Quantity, movement.Reason,
+		movement.ActorID, movement.OrderID, movement.CreatedAt,
+	).Scan(&movement.ID)
+}
+
+// movementColumns is the column list read by scanMovement
+const movementColumns = "id, product_id, variant_id, kind, quantity, reason, actor_id, order_id, created_at"
+
+func scanMovement(row rowScanner) (models.InventoryMovement, error) {
+	var movement models.InventoryMovement
+	err := row.Scan(
+		&movement.ID, &movement.ProductID, &movement.VariantID, &movement.Kind, &movement.Quantity,
+		&movement.Reason, &movement.ActorID, &movement.OrderID, &movement.CreatedAt,
+	)
+	return movement, err
+}
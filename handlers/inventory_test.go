@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/middleware"
+	"smarapp-api/models"
+	"smarapp-api/testutil"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newInventoryRouter wires the inventory, product and order routes behind the real middleware, as in main.go
+func newInventoryRouter(jwtSecret string) *gin.Engine {
+	productHandler := NewProductHandler()
+	orderHandler := NewOrderHandler()
+
+	r := newTestRouter(jwtSecret)
+	r.Protected.POST("/orders", orderHandler.CreateOrder)
+
+	products := r.Require("/products", models.PermissionProductsWrite)
+	products.POST("", productHandler.CreateProduct)
+	products.PATCH("/:id", productHandler.PatchProduct)
+	products.PUT("/:id/options", productHandler.SetProductOptions)
+	products.POST("/:id/variants", productHandler.CreateVariant)
+	products.PUT("/:id/variants/:variant_id", productHandler.UpdateVariant)
+	products.DELETE("/:id/variants/:variant_id", productHandler.DeleteVariant)
+
+	admin := r.Require("/admin", models.PermissionProductsWrite)
+	admin.GET("/products/:id/inventory", productHandler.GetProductInventory)
+	admin.POST("/products/:id/inventory", productHandler.RecordInventoryMovement)
+	return r.Engine
+}
+
+func getInventory(t *testing.T, r *gin.Engine, token string, productID int) models.InventoryResponse {
+	w := performJSON(r, "GET", fmt.Sprintf("/admin/products/%d/inventory", productID), token, nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response models.InventoryResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func TestProductHandler_InventoryLedger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	jwtSecret := "test-secret"
+	r := newInventoryRouter(jwtSecret)
+	adminToken, _ := seedTokens(t, jwtSecret)
+	userToken, err := middleware.GenerateToken(models.User{ID: 2, Username: "user", Email: "user@test.com", Role: models.RoleUser}, jwtSecret)
+	assert.NoError(t, err)
+
+	// Existing stock is carried over as an opening balance
+	inventory := getInventory(t, r, adminToken, 1)
+	assert.Equal(t, 10, inventory.Stock)
+	assert.Equal(t, 10, inventory.LedgerStock)
+	if assert.Len(t, inventory.Movements, 1) {
+		assert.Equal(t, models.MovementOpening, inventory.Movements[0].Kind)
+		assert.Nil(t, inventory.Movements[0].ActorID)
+	}
+
+	w := performJSON(r, "POST", "/orders", userToken, models.CreateOrderRequest{ProductID: 1, Quantity: 3})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var order models.OrderResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &order))
+
+	stock := 12
+	w = performJSON(r, "PATCH", "/products/1", adminToken, models.PatchProductRequest{Stock: &stock})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	for _, tt := range []struct {
+		req    models.CreateInventoryMovementRequest
+		status int
+	}{
+		{models.CreateInventoryMovementRequest{Kind: models.MovementReceipt, Quantity: 5, Reason: "Delivery 42"}, http.StatusCreated},
+		{models.CreateInventoryMovementRequest{Kind: models.MovementReturn, Quantity: 1, Reason: "Customer return"}, http.StatusCreated},
+		{models.CreateInventoryMovementRequest{Kind: models.MovementAdjustment, Quantity: -2, Reason: "Damaged"}, http.StatusCreated},
+		{models.CreateInventoryMovementRequest{Kind: models.MovementAdjustment, Quantity: -100, Reason: "Lost"}, http.StatusBadRequest},
+		{models.CreateInventoryMovementRequest{Kind: models.MovementReceipt, Quantity: -1, Reason: "Delivery 43"}, http.StatusBadRequest},
+		{models.CreateInventoryMovementRequest{Kind: models.MovementSale, Quantity: -1, Reason: "Sold in store"}, http.StatusBadRequest},
+		{models.CreateInventoryMovementRequest{Kind: models.MovementReceipt, Quantity: 1}, http.StatusBadRequest},
+	} {
+		w = performJSON(r, "POST", "/admin/products/1/inventory", adminToken, tt.req)
+		assert.Equal(t, tt.status, w.Code, tt.req.Reason)
+	}
+	w = performJSON(r, "POST", "/admin/products/1/inventory", userToken, models.CreateInventoryMovementRequest{Kind: models.MovementReceipt, Quantity: 1, Reason: "Delivery"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	inventory = getInventory(t, r, adminToken, 1)
+	assert.Equal(t, 16, inventory.Stock)
+	assert.Equal(t, 16, inventory.LedgerStock)
+	assert.Equal(t, 6, inventory.Total)
+	if assert.Len(t, inventory.Movements, 6) {
+		damaged, sale, update := inventory.Movements[0], inventory.Movements[4], inventory.Movements[3]
+		assert.Equal(t, -2, damaged.Quantity)
+		assert.Equal(t, "Damaged", damaged.Reason)
+		assert.Equal(t, 1, *damaged.ActorID)
+
+		assert.Equal(t, models.MovementSale, sale.Kind)
+		assert.Equal(t, -3, sale.Quantity)
+		assert.Equal(t, order.Order.ID, *sale.OrderID)
+		assert.Equal(t, 2, *sale.ActorID)
+
+		assert.Equal(t, models.MovementAdjustment, update.Kind)
+		assert.Equal(t, 5, update.Quantity, "setting 12 over 7 adds 5")
+	}
+
+	// New products book their initial stock as a receipt
+	w = performJSON(r, "POST", "/products", adminToken, models.CreateProductRequest{Name: "Lamp", Description: "Desk lamp", Price: usd(2500), Stock: 4})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var lamp models.Product
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &lamp))
+	assert.Equal(t, 4, lamp.Stock)
+	inventory = getInventory(t, r, adminToken, lamp.ID)
+	if assert.Len(t, inventory.Movements, 1) {
+		assert.Equal(t, models.MovementReceipt, inventory.Movements[0].Kind)
+	}
+
+	drift, err := database.InventoryDrift()
+	assert.NoError(t, err)
+	assert.Empty(t, drift)
+}
+
+func TestProductHandler_InventoryLedgerWithVariants(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	jwtSecret := "test-secret"
+	r := newInventoryRouter(jwtSecret)
+	adminToken, _ := seedTokens(t, jwtSecret)
+
+	w := performJSON(r, "PUT", "/products/1/options", adminToken, models.SetProductOptionsRequest{Options: []models.ProductOption{
+		{Name: "Size", Values: []string{"S", "M"}},
+	}})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var variants []models.ProductVariant
+	for _, size := range []string{"S", "M"} {
+		w = performJSON(r, "POST", "/products/1/variants", adminToken, models.CreateVariantRequest{
+			SKU: "TS-" + size, Options: map[string]string{"Size": size}, Stock: 3,
+		})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var variant models.ProductVariant
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &variant))
+		variants = append(variants, variant)
+	}
+	assert.Equal(t, 6, productStock(t, 1))
+
+	// Movements of a product with variants name the variant
+	w = performJSON(r, "POST", "/admin/products/1/inventory", adminToken, models.CreateInventoryMovementRequest{Kind: models.MovementReceipt, Quantity: 2, Reason: "Delivery"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performJSON(r, "POST", "/admin/products/1/inventory", adminToken, models.CreateInventoryMovementRequest{
+		Kind: models.MovementReceipt, Quantity: 2, VariantID: &variants[0].ID, Reason: "Delivery",
+	})
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = performJSON(r, "POST", "/admin/products/2/inventory", adminToken, models.CreateInventoryMovementRequest{
+		Kind: models.MovementReceipt, Quantity: 2, VariantID: &variants[0].ID, Reason: "Delivery",
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	stock := 1
+	w = performJSON(r, "PUT", fmt.Sprintf("/products/1/variants/%d", variants[1].ID), adminToken, models.UpdateVariantRequest{Stock: &stock})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 6, productStock(t, 1))
+
+	w = performJSON(r, "GET", fmt.Sprintf("/admin/products/1/inventory?variant_id=%d", variants[0].ID), adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var inventory models.InventoryResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &inventory))
+	assert.Equal(t, 2, inventory.Total)
+
+	w = performJSON(r, "DELETE", fmt.Sprintf("/products/1/variants/%d", variants[0].ID), adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, productStock(t, 1))
+
+	// The product's own stock moved to the variants, and the deleted
+	// variant's stock was written off
+	inventory = getInventory(t, r, adminToken, 1)
+	assert.Equal(t, 1, inventory.LedgerStock)
+	reasons := []string{}
+	for _, movement := range inventory.Movements {
+		reasons = append(reasons, movement.Reason)
+	}
+	assert.Equal(t, []string{
+		"Variant deleted", "Stock set by variant update", "Delivery",
+		"Initial stock", "Initial stock", "Stock moved to variants", "Opening balance",
+	}, reasons)
+
+	drift, err := database.InventoryDrift()
+	assert.NoError(t, err)
+	assert.Empty(t, drift)
+
+	// Stock written around the ledger is reported and can be reset
+	_, err = database.DB.Exec("UPDATE products SET stock = 40 WHERE id = 2")
+	assert.NoError(t, err)
+	_, err = database.DB.Exec("UPDATE product_variants SET stock = 7 WHERE id = ?", variants[1].ID)
+	assert.NoError(t, err)
+	drift, err = database.InventoryDrift()
+	assert.NoError(t, err)
+	if assert.Len(t, drift, 3) {
+		assert.Equal(t, database.StockDrift{ProductID: 1, Name: "Test Product 1", Stock: 7, LedgerStock: 1}, drift[0])
+		assert.Equal(t, variants[1].ID, *drift[1].VariantID)
+		assert.Equal(t, "TS-M", drift[1].Name)
+		assert.Equal(t, database.StockDrift{ProductID: 2, Name: "Test Product 2", Stock: 40, LedgerStock: 5}, drift[2])
+	}
+
+	assert.NoError(t, database.FixInventoryDrift())
+	drift, err = database.InventoryDrift()
+	assert.NoError(t, err)
+	assert.Empty(t, drift)
+	assert.Equal(t, 1, productStock(t, 1))
+	assert.Equal(t, 5, productStock(t, 2))
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultInviteTTL = 72 * time.Hour
+
+var errInvalidInvite = errors.New("invalid or expired invite")
+
+type InviteHandler struct{}
+
+func NewInviteHandler() *InviteHandler {
+	return &InviteHandler{}
+}
+
+// CreateInvite godoc
+// @Summary Create an invite (Admin only)
+// @Description Create a single-use, expiring invite code bound to a role. The code is only returned once.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param invite body models.CreateInviteRequest true "Invite data"
+// @Success 201 {object} models.CreateInviteResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/invites [post]
+func (h *InviteHandler) CreateInvite(c *gin.Context) {
+	var req models.CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkGrantableRole(c, req.Role) {
+		return
+	}
+
+	ttl := defaultInviteTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+
+	code, err := generateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invite code"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO invites (code_hash, role, email, created_by, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		hashToken(code), req.Role, req.Email, userID, expiresAt, now,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+
+	inviteID, _ := result.LastInsertId()
+	invite := models.Invite{
+		ID:        int(inviteID),
+		Role:      req.Role,
+		Email:     req.Email,
+		CreatedBy: userID.(int),
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	}
+
+	if err := recordAudit(c, tx, "invite.create", auditTargetInvite, invite.ID, nil, invite); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.CreateInviteResponse{
+		Code:   code,
+		Invite: invite,
+	})
+}
+
+// GetInvites godoc
+// @Summary List invites (Admin only)
+// @Description Get all invites, newest first. Codes are never returned.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Invite
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/invites [get]
+func (h *InviteHandler) GetInvites(c *gin.Context) {
+	rows, err := database.DB.Query(`
+		SELECT id, role, COALESCE(email, ''), created_by, expires_at, used_at, used_by, created_at
+		FROM invites
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invites"})
+		return
+	}
+	defer rows.Close()
+
+	invites := []models.Invite{}
+	for rows.Next() {
+		var invite models.Invite
+		var usedAt sql.NullTime
+		var usedBy sql.NullInt64
+		err := rows.Scan(
+			&invite.ID, &invite.Role, &invite.Email, &invite.CreatedBy,
+			&invite.ExpiresAt, &usedAt, &usedBy, &invite.CreatedAt,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan invite"})
+			return
+		}
+		if usedAt.Valid {
+			invite.UsedAt = &usedAt.Time
+		}
+		if usedBy.Valid {
+			id := int(usedBy.Int64)
+			invite.UsedBy = &id
+		}
+		invites = append(invites, invite)
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// DeleteInvite godoc
+// @Summary Revoke an invite (Admin only)
+// @Description Delete an invite that has not been redeemed yet
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Invite ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/invites/{id} [delete]
+func (h *InviteHandler) DeleteInvite(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invite ID"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var invite models.Invite
+	err = tx.QueryRow(
+		"DELETE FROM invites WHERE id = ? AND used_at IS NULL RETURNING id, role, COALESCE(email, ''), created_by, expires_at, created_at",
+		id,
+	).Scan(&invite.ID, &invite.Role, &invite.Email, &invite.CreatedBy, &invite.ExpiresAt, &invite.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete invite"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "invite.delete", auditTargetInvite, id, invite, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite deleted successfully"})
+}
+
+// findRedeemableInvite looks up an unused, unexpired invite for the given code.
+// Invites bound to an email can only be redeemed with that email.
+func findRedeemableInvite(tx *sql.Tx, code, email string) (*models.Invite, error) {
+	var invite models.Invite
+	var usedAt sql.NullTime
+	err := tx.QueryRow(
+		"SELECT id, role, COALESCE(email, ''), created_by, expires_at, used_at, created_at FROM invites WHERE code_hash = ?",
+		hashToken(code),
+	).Scan(&invite.ID, &invite.Role, &invite.Email, &invite.CreatedBy, &invite.ExpiresAt, &usedAt, &invite.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, errInvalidInvite
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if usedAt.Valid || time.Now().After(invite.ExpiresAt) {
+		return nil, errInvalidInvite
+	}
+	if invite.Email != "" && !strings.EqualFold(invite.Email, email) {
+		return nil, errInvalidInvite
+	}
+
+	return &invite, nil
+}
+
+// redeemInvite marks an invite as used by the given user
+func redeemInvite(tx *sql.Tx, inviteID, userID int) error {
+	result, err := tx.Exec(
+		"UPDATE invites SET used_at = ?, used_by = ? WHERE id = ? AND used_at IS NULL",
+		time.Now(), userID, inviteID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return errInvalidInvite
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"smarapp-api/testutil"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestInvite creates an invite as the seeded admin and returns the response
+func createTestInvite(t *testing.T, handler *InviteHandler, request models.CreateInviteRequest) models.CreateInviteResponse {
+	jsonBody, _ := json.Marshal(request)
+	req := httptest.NewRequest("POST", "/admin/invites", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", 1)
+		c.Set("permissions", models.AllPermissions)
+		c.Next()
+	})
+	r.POST("/admin/invites", handler.CreateInvite)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response models.CreateInviteResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	return response
+}
+
+func TestInviteHandler_CreateInvite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	handler := NewInviteHandler()
+
+	tests := []struct {
+		name           string
+		requestBody    models.CreateInviteRequest
+		expectedStatus int
+	}{
+		{
+			name:           "valid admin invite",
+			requestBody:    models.CreateInviteRequest{Role: models.RoleAdmin},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "valid invite bound to email",
+			requestBody: models.CreateInviteRequest{
+				Role:           models.RoleAdmin,
+				Email:          "invited@test.com",
+				ExpiresInHours: 1,
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "invalid role",
+			requestBody:    models.CreateInviteRequest{Role: "superuser"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing role",
+			requestBody:    models.CreateInviteRequest{},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonBody, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", "/admin/invites", bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				c.Set("user_id", 1)
+				c.Set("permissions", models.AllPermissions)
+				c.Next()
+			})
+			r.POST("/admin/invites", handler.CreateInvite)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedStatus == http.StatusCreated {
+				var response models.CreateInviteResponse
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.NoError(t, err)
+				assert.NotEmpty(t, response.Code)
+				assert.Equal(t, tt.requestBody.Role, response.Invite.Role)
+				assert.True(t, response.Invite.ExpiresAt.After(time.Now()))
+			}
+		})
+	}
+}
+
+func TestInviteHandler_RegisterWithInvite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	inviteHandler := NewInviteHandler()
+	authHandler := NewAuthHandler("test-secret")
+
+	register := func(request models.RegisterRequest) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(request)
+		req := httptest.NewRequest("POST", "/register", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		r := gin.New()
+		r.POST("/register", authHandler.Register)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	invite := createTestInvite(t, inviteHandler, models.CreateInviteRequest{Role: models.RoleAdmin})
+
+	// Redeeming the invite grants its role
+	w := register(models.RegisterRequest{
+		Username:   "newadmin",
+		Email:      "newadmin@test.com",
+		Password:   "password123",
+		InviteCode: invite.Code,
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response models.LoginResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, response.User.Role)
+
+	// Invites are single-use
+	w = register(models.RegisterRequest{
+		Username:   "secondadmin",
+		Email:      "secondadmin@test.com",
+		Password:   "password123",
+		InviteCode: invite.Code,
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid or expired invite code")
+
+	// Invites bound to an email cannot be redeemed by someone else
+	bound := createTestInvite(t, inviteHandler, models.CreateInviteRequest{Role: models.RoleAdmin, Email: "invited@test.com"})
+	w = register(models.RegisterRequest{
+		Username:   "intruder",
+		Email:      "intruder@test.com",
+		Password:   "password123",
+		InviteCode: bound.Code,
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Expired invites are rejected
+	expired := createTestInvite(t, inviteHandler, models.CreateInviteRequest{Role: models.RoleAdmin})
+	_, err = database.DB.Exec("UPDATE invites SET expires_at = ? WHERE id = ?", time.Now().Add(-time.Hour), expired.Invite.ID)
+	assert.NoError(t, err)
+	w = register(models.RegisterRequest{
+		Username:   "lateadmin",
+		Email:      "lateadmin@test.com",
+		Password:   "password123",
+		InviteCode: expired.Code,
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, 0, countUsersByEmail(t, "lateadmin@test.com"))
+}
+
+func TestInviteHandler_GetInvites(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	handler := NewInviteHandler()
+	createTestInvite(t, handler, models.CreateInviteRequest{Role: models.RoleAdmin})
+	createTestInvite(t, handler, models.CreateInviteRequest{Role: models.RoleUser})
+
+	req := httptest.NewRequest("GET", "/admin/invites", nil)
+	w := httptest.NewRecorder()
+
+	r := gin.New()
+	r.GET("/admin/invites", handler.GetInvites)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "code")
+
+	var invites []models.Invite
+	err := json.Unmarshal(w.Body.Bytes(), &invites)
+	assert.NoError(t, err)
+	assert.Len(t, invites, 2)
+}
+
+func TestInviteHandler_DeleteInvite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	handler := NewInviteHandler()
+	invite := createTestInvite(t, handler, models.CreateInviteRequest{Role: models.RoleAdmin})
+
+	tests := []struct {
+		name           string
+		inviteID       string
+		expectedStatus int
+	}{
+		{
+			name:           "valid deletion",
+			inviteID:       "1",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "already deleted",
+			inviteID:       "1",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "invalid invite ID",
+			inviteID:       "abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	assert.Equal(t, 1, invite.Invite.ID)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("DELETE", "/admin/invites/"+tt.inviteID, nil)
+			w := httptest.NewRecorder()
+
+			r := gin.New()
+			r.DELETE("/admin/invites/:id", handler.DeleteInvite)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func countUsersByEmail(t *testing.T, email string) int {
+	var count int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM users WHERE email = ?", email).Scan(&count)
+	assert.NoError(t, err)
+	return count
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListLoginAttempts godoc
+// @Summary List login attempts (Admin only)
+// @Description Get a paginated list of login attempts, newest first, optionally filtered by email, IP, user or outcome
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number (default 1)"
+// @Param page_size query int false "Page size (default 20, max 100)"
+// @Param email query string false "Filter by email"
+// @Param ip query string false "Filter by client IP"
+// @Param user_id query int false "Filter by user ID"
+// @Param success query bool false "Filter by outcome"
+// @Success 200 {object} models.LoginAttemptListResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/login-attempts [get]
+func (h *UserHandler) ListLoginAttempts(c *gin.Context) {
+	page, pageSize, err := parsePagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	where := " WHERE 1 = 1"
+	args := []interface{}{}
+
+	if email := strings.TrimSpace(c.Query("email")); email != "" {
+		where += " AND email = ?"
+		args = append(args, strings.ToLower(email))
+	}
+	if ip := c.Query("ip"); ip != "" {
+		where += " AND ip_address = ?"
+		args = append(args, ip)
+	}
+	if value := c.Query("user_id"); value != "" {
+		userID, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+		where += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	if value := c.Query("success"); value != "" {
+		success, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid success"})
+			return
+		}
+		where += " AND success = ?"
+		args = append(args, success)
+	}
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM login_attempts"+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count login attempts"})
+		return
+	}
+
+	rows, err := database.DB.Query(
+		"SELECT id, email, ip_address, user_id, success, reason, created_at FROM login_attempts"+where+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, pageSize, (page-1)*pageSize)...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch login attempts"})
+		return
+	}
+	defer rows.Close()
+
+	attempts := []models.LoginAttempt{}
+	for rows.Next() {
+		var attempt models.LoginAttempt
+		var userID sql.NullInt64
+		var reason sql.NullString
+		err := rows.Scan(&attempt.ID, &attempt.Email, &attempt.IPAddress, &userID, &attempt.Success, &reason, &attempt.CreatedAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan login attempt"})
+			return
+		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			attempt.UserID = &id
+		}
+		attempt.Reason = reason.String
+		attempts = append(attempts, attempt)
+	}
+
+	c.JSON(http.StatusOK, models.LoginAttemptListResponse{
+		Attempts: attempts,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	})
+}
+
+// UnlockUser godoc
+// @Summary Unlock a user (Admin only)
+// @Description Clear the login lockout and failed attempt count of a user's account
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/users/{id}/unlock [post]
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	id, ok := targetUserID(c, "unlock")
+	if !ok || !checkManageableUser(c, id) {
+		return
+	}
+
+	user, err := fetchUser(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := unlockAccount(tx, user.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "user.unlock", auditTargetUser, user.ID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully"})
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"database/sql"
+	"math"
+	"smarapp-api/database"
+	"strings"
+	"time"
+)
+
+// Reasons recorded for failed login attempts
+const (
+	loginFailureUnknownEmail    = "unknown_email"
+	loginFailureInvalidPassword = "invalid_password"
+	loginFailureSuspended       = "account_suspended"
+	loginFailureInvalid2FACode  = "invalid_2fa_code"
+)
+
+// LoginLimit configures the exponential back-off applied to one throttle key
+// (an account or a client IP)
+type LoginLimit struct {
+	MaxFailures   int           // Consecutive failures allowed before locking
+	BaseLockout   time.Duration // Lockout after MaxFailures, doubled for every further failure
+	MaxLockout    time.Duration
+	FailureWindow time.Duration // Failures older than this are forgotten
+}
+
+// lockoutFor returns how long to lock after the given number of consecutive failures
+func (l LoginLimit) lockoutFor(failures int) time.Duration {
+	if failures < l.MaxFailures {
+		return 0
+	}
+
+	lockout := float64(l.BaseLockout) * math.Pow(2, float64(failures-l.MaxFailures))
+	if lockout > float64(l.MaxLockout) {
+		return l.MaxLockout
+	}
+	return time.Duration(lockout)
+}
+
+type throttleKey struct {
+	key   string
+	limit LoginLimit
+}
+
+func accountThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func (h *AuthHandler) loginThrottleKeys(email, ip string) []throttleKey {
+	return []throttleKey{
+		{key: accountThrottleKey(email), limit: h.AccountLoginLimit},
+		{key: "ip:" + ip, limit: h.IPLoginLimit},
+	}
+}
+
+// checkLoginThrottle returns how long the caller has to wait before trying
+// again, or zero if neither the account nor the IP is locked
+func (h *AuthHandler) checkLoginThrottle(email, ip string) (time.Duration, error) {
+	var wait time.Duration
+	now := time.Now()
+
+	for _, k := range h.loginThrottleKeys(email, ip) {
+		var lockedUntil sql.NullTime
+		err := database.DB.QueryRow("SELECT locked_until FROM login_throttles WHERE key = ?", k.key).Scan(&lockedUntil)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if lockedUntil.Valid && lockedUntil.Time.After(now) && lockedUntil.Time.Sub(now) > wait {
+			wait = lockedUntil.Time.Sub(now)
+		}
+	}
+
+	return wait, nil
+}
+
+// recordLoginFailure stores a failed attempt and, if throttled is set,
+// counts it towards the lockout of the account and the IP
+func (h *AuthHandler) recordLoginFailure(email, ip string, userID *int, reason string, throttled bool) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertLoginAttempt(tx, email, ip, userID, false, reason); err != nil {
+		return err
+	}
+
+	if throttled {
+		now := time.Now()
+		for _, k := range h.loginThrottleKeys(email, ip) {
+			if err := incrementThrottle(tx, k, now); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// recordLoginSuccess stores a successful attempt and clears the account's
+// failure count. The IP count is left alone so that one valid account cannot
+// be used to keep resetting it.
+func recordLoginSuccess(email, ip string, userID int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertLoginAttempt(tx, email, ip, &userID, true, ""); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM login_throttles WHERE key = ?", accountThrottleKey(email)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// unlockAccount removes the lockout and failure count of an account
+func unlockAccount(tx *sql.Tx, email string) error {
+	_, err := tx.Exec("DELETE FROM login_throttles WHERE key = ?", accountThrottleKey(email))
+	return err
+}
+
+func insertLoginAttempt(tx *sql.Tx, email, ip string, userID *int, success bool, reason string) error {
+	_, err := tx.Exec(
+		"INSERT INTO login_attempts (email, ip_address, user_id, success, reason, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		strings.ToLower(strings.TrimSpace(email)), ip, userID, success, reason, time.Now(),
+	)
+	return err
+}
+
+func incrementThrottle(tx *sql.Tx, k throttleKey, now time.Time) error {
+	var failures int
+	var lastFailureAt time.Time
+	err := tx.QueryRow("SELECT failures, last_failure_at FROM login_throttles WHERE key = ?", k.key).Scan(&failures, &lastFailureAt)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	if err == sql.ErrNoRows || now.Sub(lastFailureAt) > k.limit.FailureWindow {
+		failures = 0
+	}
+	failures++
+
+	var lockedUntil *time.Time
+	if lockout := k.limit.lockoutFor(failures); lockout > 0 {
+		until := now.Add(lockout)
+		lockedUntil = &until
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO login_throttles (key, failures, last_failure_at, locked_until) VALUES (?, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET failures = excluded.failures, last_failure_at = excluded.last_failure_at, locked_until = excluded.locked_until`,
+		k.key, failures, now, lockedUntil,
+	)
+	return err
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"smarapp-api/testutil"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func loginFrom(r *gin.Engine, ip, email, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.LoginRequest{Email: email, Password: password})
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":12345"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestLoginLimit_LockoutFor(t *testing.T) {
+	limit := LoginLimit{MaxFailures: 5, BaseLockout: 30 * time.Second, MaxLockout: 5 * time.Minute}
+
+	assert.Equal(t, time.Duration(0), limit.lockoutFor(4))
+	assert.Equal(t, 30*time.Second, limit.lockoutFor(5))
+	assert.Equal(t, time.Minute, limit.lockoutFor(6))
+	assert.Equal(t, 2*time.Minute, limit.lockoutFor(7))
+	assert.Equal(t, 5*time.Minute, limit.lockoutFor(12))
+}
+
+func TestAuthHandler_Login_AccountLockout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+	registerTestUser(t, handler, models.RegisterRequest{
+		Username: "testuser",
+		Email:    "test@test.com",
+		Password: "password123",
+	})
+
+	r := gin.New()
+	r.POST("/login", handler.Login)
+
+	for i := 0; i < handler.AccountLoginLimit.MaxFailures; i++ {
+		w := loginFrom(r, "10.0.0.1", "test@test.com", "wrongpassword")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// Locked, even with the right password and from another IP
+	w := loginFrom(r, "10.0.0.2", "TEST@test.com", "password123")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	assert.NoError(t, err)
+	assert.InDelta(t, 30, retryAfter, 1)
+
+	// Failures were recorded for review
+	admin := newAdminUserRouter(NewUserHandler())
+	w = performJSON(admin, "GET", "/admin/login-attempts?email=test@test.com&success=false", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var attempts models.LoginAttemptListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &attempts))
+	assert.Equal(t, handler.AccountLoginLimit.MaxFailures, attempts.Total)
+	assert.Equal(t, loginFailureInvalidPassword, attempts.Attempts[0].Reason)
+	assert.Equal(t, "10.0.0.1", attempts.Attempts[0].IPAddress)
+	assert.NotNil(t, attempts.Attempts[0].UserID)
+
+	// An admin can lift the lockout
+	w = performJSON(admin, "POST", "/admin/users/"+strconv.Itoa(*attempts.Attempts[0].UserID)+"/unlock", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = loginFrom(r, "10.0.0.2", "test@test.com", "password123")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performJSON(admin, "GET", "/admin/login-attempts?success=true", "", nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &attempts))
+	assert.Equal(t, 1, attempts.Total)
+
+	// A success clears the account's failure count
+	var throttles int
+	err = database.DB.QueryRow("SELECT COUNT(*) FROM login_throttles WHERE key = ?", accountThrottleKey("test@test.com")).Scan(&throttles)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, throttles)
+}
+
+func TestAuthHandler_Login_IPLockout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+	handler.IPLoginLimit.MaxFailures = 3
+	registerTestUser(t, handler, models.RegisterRequest{
+		Username: "testuser",
+		Email:    "test@test.com",
+		Password: "password123",
+	})
+
+	r := gin.New()
+	r.POST("/login", handler.Login)
+
+	// Spraying different (unknown) accounts from one IP
+	for i := 0; i < 3; i++ {
+		w := loginFrom(r, "10.0.0.1", "unknown"+strconv.Itoa(i)+"@test.com", "password123")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	w := loginFrom(r, "10.0.0.1", "test@test.com", "password123")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// Other clients are not affected
+	w = loginFrom(r, "10.0.0.2", "test@test.com", "password123")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAuthHandler_Login_FailureWindow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+	r := gin.New()
+	r.POST("/login", handler.Login)
+
+	for i := 0; i < handler.AccountLoginLimit.MaxFailures-1; i++ {
+		loginFrom(r, "10.0.0.1", "test@test.com", "wrongpassword")
+	}
+
+	// Failures older than the window are forgotten
+	_, err := database.DB.Exec("UPDATE login_throttles SET last_failure_at = ?", time.Now().Add(-2*handler.AccountLoginLimit.FailureWindow))
+	assert.NoError(t, err)
+
+	w := loginFrom(r, "10.0.0.1", "test@test.com", "wrongpassword")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = loginFrom(r, "10.0.0.1", "test@test.com", "wrongpassword")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"smarapp-api/oidc"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errUnverifiedOIDCEmail = errors.New("identity provider did not return a verified email")
+
+// OIDCLogin godoc
+// @Summary Start an external login
+// @Description Redirect to an OpenID Connect provider. The provider redirects back to /auth/oidc/callback.
+// @Tags Authentication
+// @Param provider query string false "Provider name, optional when only one provider is configured"
+// @Success 302
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Router /auth/oidc/login [get]
+func (h *AuthHandler) OIDCLogin(c *gin.Context) {
+	name := c.Query("provider")
+	if name == "" && len(h.OIDCProviders) == 1 {
+		for only := range h.OIDCProviders {
+			name = only
+		}
+	}
+
+	provider, ok := h.OIDCProviders[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+		return
+	}
+
+	state, err := generateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	nonce, err := generateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Login provider is unavailable"})
+		return
+	}
+
+	// Abandoned logins are cleaned up whenever a new one starts
+	now := time.Now()
+	if _, err := database.DB.Exec("DELETE FROM oidc_states WHERE expires_at < ?", now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	_, err = database.DB.Exec(
+		"INSERT INTO oidc_states (state_hash, provider, nonce, code_verifier, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		hashToken(state), name, nonce, verifier, now.Add(h.OIDCStateTTL), now,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback godoc
+// @Summary Complete an external login
+// @Description Redirect target of the OpenID Connect provider. Links the external account to the local user with the same verified email, or creates a new user, and returns tokens like a password login.
+// @Tags Authentication
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State from the login redirect"
+// @Success 200 {object} models.LoginResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/oidc/callback [get]
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	if providerError := c.Query("error"); providerError != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login was not completed: " + providerError})
+		return
+	}
+
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code and state are required"})
+		return
+	}
+
+	// States are single use
+	var name, nonce, verifier string
+	var expiresAt time.Time
+	err := database.DB.QueryRow(
+		"DELETE FROM oidc_states WHERE state_hash = ? RETURNING provider, nonce, code_verifier, expires_at",
+		hashToken(state),
+	).Scan(&name, &nonce, &verifier, &expiresAt)
+	if err == sql.ErrNoRows || (err == nil && time.Now().After(expiresAt)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	provider, ok := h.OIDCProviders[name]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown login provider"})
+		return
+	}
+
+	claims, err := provider.Exchange(c.Request.Context(), code, verifier, nonce)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login provider rejected the login"})
+		return
+	}
+
+	userID, err := linkOIDCIdentity(c, name, claims)
+	if err == errUnverifiedOIDCEmail {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The login provider did not confirm the email address"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link account"})
+		return
+	}
+
+	var user models.User
+	var suspendedAt sql.NullTime
+	err = database.DB.QueryRow(
+		"SELECT id, username, email, role, suspended_at, totp_enabled_at IS NOT NULL, created_at, updated_at FROM users WHERE id = ? AND deleted_at IS NULL",
+		userID,
+	).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &suspendedAt, &user.TwoFactorEnabled, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if suspendedAt.Valid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account suspended"})
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		h.respondWithTwoFactorChallenge(c, user)
+		return
+	}
+
+	response, err := h.issueTokens(c, user, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// linkOIDCIdentity returns the local user of an external account. Unknown
+// accounts are linked to the user with the same email, or get a new user
+// without a password, but only if the provider verified the email.
+func linkOIDCIdentity(c *gin.Context, provider string, claims *oidc.Claims) (int, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var userID int
+	err = tx.QueryRow(
+		"SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?",
+		provider, claims.Subject,
+	).Scan(&userID)
+	if err == nil {
+		if _, err := tx.Exec("UPDATE user_identities SET last_login_at = ? WHERE provider = ? AND subject = ?", now, provider, claims.Subject); err != nil {
+			return 0, err
+		}
+		return userID, tx.Commit()
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return 0, errUnverifiedOIDCEmail
+	}
+
+	err = tx.QueryRow("SELECT id FROM users WHERE email = ? AND deleted_at IS NULL", claims.Email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		var user models.User
+		user, err = provisionOIDCUser(tx, claims)
+		if err == nil {
+			userID = user.ID
+			err = recordAudit(c, tx, "user.register", auditTargetUser, user.ID, nil, user)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// The provider vouches for the address
+	if _, err := tx.Exec("UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?) WHERE id = ?", now, userID); err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO user_identities (user_id, provider, subject, email, last_login_at, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, provider, claims.Subject, claims.Email, now, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	identity := gin.H{"provider": provider, "subject": claims.Subject, "email": claims.Email}
+	if err := recordAudit(c, tx, "user.identity_link", auditTargetUser, userID, nil, identity); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// provisionOIDCUser creates a regular user without a password, named after
+// the external account
+func provisionOIDCUser(tx *sql.Tx, claims *oidc.Claims) (models.User, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+
+	for attempt := 1; attempt <= 100; attempt++ {
+		username := base
+		if attempt > 1 {
+			username = fmt.Sprintf("%s%d", base, attempt)
+		}
+
+		var exists int
+		err := tx.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", username).Scan(&exists)
+		if err != nil {
+			return models.User{}, err
+		}
+		if exists > 0 {
+			continue
+		}
+
+		now := time.Now()
+		result, err := tx.Exec(
+			"INSERT INTO users (username, email, password, role, created_at, updated_at) VALUES (?, ?, '', ?, ?, ?)",
+			username, claims.Email, models.RoleUser, now, now,
+		)
+		if err != nil {
+			return models.User{}, err
+		}
+		id, err := result.LastInsertId()
+		return models.User{
+			ID:        int(id),
+			Username:  username,
+			Email:     claims.Email,
+			Role:      models.RoleUser,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}, err
+	}
+
+	return models.User{}, fmt.Errorf("no free username for %q", base)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"smarapp-api/oidc/oidctest"
+	"smarapp-api/testutil"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newOIDCRouter(handler *AuthHandler) *gin.Engine {
+	r := gin.New()
+	r.GET("/auth/oidc/login", handler.OIDCLogin)
+	r.GET("/auth/oidc/callback", handler.OIDCCallback)
+	return r
+}
+
+// oidcLogin runs the whole login flow against the fake provider and returns
+// the response of the callback
+func oidcLogin(t *testing.T, r *gin.Engine, fake *oidctest.Provider) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	callback := fake.Authorize(t, w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", callback.RequestURI(), nil))
+	return w
+}
+
+func TestAuthHandler_OIDCLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	fake := oidctest.NewProvider(t)
+	handler := NewAuthHandler("test-secret")
+	handler.OIDCProviders["corp"] = fake.Client("corp", "http://localhost/auth/oidc/callback")
+	r := newOIDCRouter(handler)
+
+	// Unknown external accounts get a new user without a password
+	w := oidcLogin(t, r, fake)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var first models.LoginResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+	assert.NotEmpty(t, first.Token)
+	assert.NotEmpty(t, first.RefreshToken)
+	assert.Equal(t, "sso", first.User.Username)
+	assert.Equal(t, "sso@example.com", first.User.Email)
+	assert.Equal(t, models.RoleUser, first.User.Role)
+
+	var password string
+	var verifiedAt *time.Time
+	err := database.DB.QueryRow("SELECT password, email_verified_at FROM users WHERE id = ?", first.User.ID).Scan(&password, &verifiedAt)
+	assert.NoError(t, err)
+	assert.Empty(t, password)
+	assert.NotNil(t, verifiedAt)
+
+	// The same external account logs into the same user
+	w = oidcLogin(t, r, fake)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var second models.LoginResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &second))
+	assert.Equal(t, first.User.ID, second.User.ID)
+
+	// Another external account with the email of a local user is linked to it
+	registered := registerTestUser(t, handler, models.RegisterRequest{
+		Username: "local",
+		Email:    "local@example.com",
+		Password: "password123",
+	})
+	fake.User = oidctest.User{Subject: "local-subject", Email: "local@example.com", EmailVerified: true}
+	w = oidcLogin(t, r, fake)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var linked models.LoginResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &linked))
+	assert.Equal(t, registered.User.ID, linked.User.ID)
+
+	var identities int
+	err = database.DB.QueryRow("SELECT COUNT(*) FROM user_identities").Scan(&identities)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, identities)
+
+	// Usernames are made unique
+	fake.User = oidctest.User{Subject: "clash-subject", Email: "local@other.example.com", EmailVerified: true}
+	w = oidcLogin(t, r, fake)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"username":"local2"`)
+
+	// Unverified emails are neither linked nor provisioned
+	fake.User = oidctest.User{Subject: "unverified-subject", Email: "local@example.com", EmailVerified: false}
+	w = oidcLogin(t, r, fake)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Suspended users cannot log in through the provider either
+	_, err = database.DB.Exec("UPDATE users SET suspended_at = ? WHERE id = ?", time.Now(), first.User.ID)
+	assert.NoError(t, err)
+	fake.User = oidctest.User{Subject: "fake-subject", Email: "sso@example.com", EmailVerified: true}
+	w = oidcLogin(t, r, fake)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAuthHandler_OIDCCallback_InvalidState(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	fake := oidctest.NewProvider(t)
+	handler := NewAuthHandler("test-secret")
+	handler.OIDCProviders["corp"] = fake.Client("corp", "http://localhost/auth/oidc/callback")
+	r := newOIDCRouter(handler)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/auth/oidc/login?provider=other", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/auth/oidc/login?provider=corp", nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+	callback := fake.Authorize(t, w.Header().Get("Location"))
+
+	// A forged state is rejected
+	forged := *callback
+	query := forged.Query()
+	query.Set("state", "forged")
+	forged.RawQuery = query.Encode()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", forged.RequestURI(), nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", callback.RequestURI(), nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// States cannot be replayed
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", callback.RequestURI(), nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/auth/oidc/callback?error=access_denied", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "access_denied")
+}
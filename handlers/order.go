@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"net/http"
 	"smarapp-api/database"
+	"smarapp-api/middleware"
 	"smarapp-api/models"
 	"strconv"
 	"time"
@@ -11,7 +12,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-type OrderHandler struct{}
+type OrderHandler struct {
+	RequireVerifiedEmail bool // Reject orders from accounts with an unverified email
+}
 
 func NewOrderHandler() *OrderHandler {
 	return &OrderHandler{}
@@ -19,7 +22,7 @@ func NewOrderHandler() *OrderHandler {
 
 // CreateOrder godoc
 // @Summary Create a new order (Buy a product)
-// @Description Create a new order to purchase a product, automatically reduces stock
+// @Description Create a new order to purchase a product, automatically reduces stock. Products with variants are bought per variant, at the variant's price and from its stock.
 // @Tags Orders
 // @Accept json
 // @Produce json
@@ -28,6 +31,7 @@ func NewOrderHandler() *OrderHandler {
 // @Success 201 {object} models.OrderResponse
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /orders [post]
@@ -40,6 +44,18 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 
 	userID, _ := c.Get("user_id")
 
+	if h.RequireVerifiedEmail {
+		var emailVerifiedAt sql.NullTime
+		if err := database.DB.QueryRow("SELECT email_verified_at FROM users WHERE id = ?", userID).Scan(&emailVerifiedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !emailVerifiedAt.Valid {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Email address must be verified before placing orders"})
+			return
+		}
+	}
+
 	// Start transaction
 	tx, err := database.DB.Begin()
 	if err != nil {
@@ -49,15 +65,7 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	defer tx.Rollback()
 
 	// Get product and check stock
-	var product models.Product
-	err = tx.QueryRow(
-		"SELECT id, name, description, price, stock, created_by, created_at, updated_at FROM products WHERE id = ?",
-		req.ProductID,
-	).Scan(
-		&product.ID, &product.Name, &product.Description, &product.Price,
-		&product.Stock, &product.CreatedBy, &product.CreatedAt, &product.UpdatedAt,
-	)
-
+	product, err := loadProduct(tx, req.ProductID)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
@@ -67,19 +75,60 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		return
 	}
 
+	// Products with variants are sold per variant, with the variant's stock
+	// and price
+	var variant *models.ProductVariant
+	if req.VariantID != 0 {
+		found, err := loadVariant(tx, product.ID, req.VariantID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		variant = &found
+	} else {
+		var hasVariants bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM product_variants WHERE product_id = ?)", product.ID).Scan(&hasVariants); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if hasVariants {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Product has variants, choose one with variant_id"})
+			return
+		}
+	}
+
+	price, stock := product.Price, product.Stock
+	var variantID *int
+	sku := ""
+	if variant != nil {
+		stock = variant.Stock
+		if variant.Price != nil {
+			price = *variant.Price
+		}
+		variantID, sku = &variant.ID, variant.SKU
+	}
+
 	// Check if enough stock
-	if product.Stock < req.Quantity {
+	if stock < req.Quantity {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient stock"})
 		return
 	}
 
-	// Calculate total
-	total := product.Price * float64(req.Quantity)
+	// Calculate total, exactly in minor units
+	total, err := price.Mul(req.Quantity)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order total is too large"})
+		return
+	}
 
 	// Create order
 	result, err := tx.Exec(
-		"INSERT INTO orders (user_id, product_id, quantity, price, total, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
-		userID, req.ProductID, req.Quantity, product.Price, total, models.OrderStatusPending, time.Now(), time.Now(),
+		"INSERT INTO orders (user_id, product_id, quantity, price, total, currency, status, variant_id, sku, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		userID, req.ProductID, req.Quantity, price.Amount, total.Amount, price.Currency, models.OrderStatusPending, variantID, sku, time.Now(), time.Now(),
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
@@ -88,12 +137,16 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 
 	orderID, _ := result.LastInsertId()
 
-	// Update product stock
-	_, err = tx.Exec(
-		"UPDATE products SET stock = stock - ?, updated_at = ? WHERE id = ?",
-		req.Quantity, time.Now(), req.ProductID,
-	)
-	if err != nil {
+	// Book the sale, which takes the stock of the product or variant
+	id := int(orderID)
+	movement := models.InventoryMovement{
+		ProductID: req.ProductID,
+		VariantID: variantID,
+		Kind:      models.MovementSale,
+		Quantity:  -req.Quantity,
+		OrderID:   &id,
+	}
+	if err := recordMovement(c, tx, &movement); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
 		return
 	}
@@ -108,30 +161,50 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		return
 	}
 
-	// Commit transaction
-	if err = tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
-		return
-	}
-
 	order := models.Order{
 		ID:        int(orderID),
 		UserID:    userID.(int),
 		ProductID: req.ProductID,
 		Quantity:  req.Quantity,
-		Price:     product.Price,
+		Price:     price,
 		Total:     total,
 		Status:    models.OrderStatusCompleted,
+		VariantID: variantID,
+		SKU:       sku,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
+	// Completing the order and taking the stock moved both versions on
+	err = tx.QueryRow(
+		"SELECT o.version, p.version FROM orders o JOIN products p ON p.id = o.product_id WHERE o.id = ?", orderID,
+	).Scan(&order.Version, &product.Version)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "order.create", auditTargetOrder, order.ID, nil, order); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
 	// Update product stock for response
 	product.Stock -= req.Quantity
+	if variant != nil {
+		variant.Stock -= req.Quantity
+	}
 
 	c.JSON(http.StatusCreated, models.OrderResponse{
 		Order:   order,
 		Product: product,
+		Variant: variant,
 	})
 }
 
@@ -139,7 +212,7 @@ func (h *OrderHandler) GetUserOrders(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
 	rows, err := database.DB.Query(`
-		SELECT o.id, o.user_id, o.product_id, o.quantity, o.price, o.total, o.status, o.created_at, o.updated_at,
+		SELECT o.id, o.user_id, o.product_id, o.quantity, o.price, o.currency, o.total, o.currency, o.status, o.variant_id, o.sku, o.version, o.created_at, o.updated_at,
 		       p.name as product_name
 		FROM orders o
 		JOIN products p ON o.product_id = p.id
@@ -158,7 +231,7 @@ func (h *OrderHandler) GetUserOrders(c *gin.Context) {
 		var order models.OrderWithDetails
 		err := rows.Scan(
 			&order.ID, &order.UserID, &order.ProductID, &order.Quantity,
-			&order.Price, &order.Total, &order.Status, &order.CreatedAt, &order.UpdatedAt,
+			&order.Price.Amount, &order.Price.Currency, &order.Total.Amount, &order.Total.Currency, &order.Status, &order.VariantID, &order.SKU, &order.Version, &order.CreatedAt, &order.UpdatedAt,
 			&order.ProductName,
 		)
 		if err != nil {
@@ -168,12 +241,12 @@ func (h *OrderHandler) GetUserOrders(c *gin.Context) {
 		orders = append(orders, order)
 	}
 
-	c.JSON(http.StatusOK, orders)
+	jsonWithWeakETag(c, orders)
 }
 
 func (h *OrderHandler) GetAllOrders(c *gin.Context) {
 	rows, err := database.DB.Query(`
-		SELECT o.id, o.user_id, o.product_id, o.quantity, o.price, o.total, o.status, o.created_at, o.updated_at,
+		SELECT o.id, o.user_id, o.product_id, o.quantity, o.price, o.currency, o.total, o.currency, o.status, o.variant_id, o.sku, o.version, o.created_at, o.updated_at,
 		       p.name as product_name, u.username
 		FROM orders o
 		JOIN products p ON o.product_id = p.id
@@ -192,7 +265,7 @@ func (h *OrderHandler) GetAllOrders(c *gin.Context) {
 		var order models.OrderWithDetails
 		err := rows.Scan(
 			&order.ID, &order.UserID, &order.ProductID, &order.Quantity,
-			&order.Price, &order.Total, &order.Status, &order.CreatedAt, &order.UpdatedAt,
+			&order.Price.Amount, &order.Price.Currency, &order.Total.Amount, &order.Total.Currency, &order.Status, &order.VariantID, &order.SKU, &order.Version, &order.CreatedAt, &order.UpdatedAt,
 			&order.ProductName, &order.Username,
 		)
 		if err != nil {
@@ -202,7 +275,7 @@ func (h *OrderHandler) GetAllOrders(c *gin.Context) {
 		orders = append(orders, order)
 	}
 
-	c.JSON(http.StatusOK, orders)
+	jsonWithWeakETag(c, orders)
 }
 
 func (h *OrderHandler) GetOrder(c *gin.Context) {
@@ -214,10 +287,9 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 	}
 
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	query := `
-		SELECT o.id, o.user_id, o.product_id, o.quantity, o.price, o.total, o.status, o.created_at, o.updated_at,
+		SELECT o.id, o.user_id, o.product_id, o.quantity, o.price, o.currency, o.total, o.currency, o.status, o.variant_id, o.sku, o.version, o.created_at, o.updated_at,
 		       p.name as product_name
 		FROM orders o
 		JOIN products p ON o.product_id = p.id
@@ -225,8 +297,8 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 
 	args := []interface{}{id}
 
-	// If not admin, only show user's own orders
-	if role != models.RoleAdmin {
+	// Without orders:read_all, only show user's own orders
+	if !middleware.HasPermission(c, models.PermissionOrdersReadAll) {
 		query += " AND o.user_id = ?"
 		args = append(args, userID)
 	}
@@ -234,7 +306,7 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 	var order models.OrderWithDetails
 	err = database.DB.QueryRow(query, args...).Scan(
 		&order.ID, &order.UserID, &order.ProductID, &order.Quantity,
-		&order.Price, &order.Total, &order.Status, &order.CreatedAt, &order.UpdatedAt,
+		&order.Price.Amount, &order.Price.Currency, &order.Total.Amount, &order.Total.Currency, &order.Status, &order.VariantID, &order.SKU, &order.Version, &order.CreatedAt, &order.UpdatedAt,
 		&order.ProductName,
 	)
 
@@ -247,5 +319,6 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, order)
+	// The order's version does not cover the product name shown with it
+	jsonWithWeakETag(c, order)
 }
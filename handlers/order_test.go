@@ -89,7 +89,7 @@ func TestOrderHandler_CreateOrder(t *testing.T) {
 				assert.Equal(t, tt.requestBody.Quantity, response.Order.Quantity)
 				assert.Equal(t, tt.userID, response.Order.UserID)
 				assert.Equal(t, models.OrderStatusCompleted, response.Order.Status)
-				assert.Greater(t, response.Order.Total, 0.0)
+				assert.Greater(t, response.Order.Total.Amount, int64(0))
 			}
 		})
 	}
@@ -187,6 +187,7 @@ func TestOrderHandler_GetOrder(t *testing.T) {
 			r.Use(func(c *gin.Context) {
 				c.Set("user_id", tt.userID)
 				c.Set("role", tt.role)
+				c.Set("permissions", models.DefaultRolePermissions[tt.role])
 				c.Next()
 			})
 			r.GET("/orders/:id", handler.GetOrder)
@@ -199,7 +200,7 @@ func TestOrderHandler_GetOrder(t *testing.T) {
 				err := json.Unmarshal(w.Body.Bytes(), &order)
 				assert.NoError(t, err)
 				assert.NotEmpty(t, order.ProductName)
-				assert.Greater(t, order.Total, 0.0)
+				assert.Greater(t, order.Total.Amount, int64(0))
 			}
 		})
 	}
@@ -265,6 +266,9 @@ func TestOrderHandler_StockReduction(t *testing.T) {
 
 	assert.Equal(t, http.StatusCreated, w.Code)
 
+	// Totals are exact, 99.99 * 3 as floats would be 299.96999999999997
+	assert.Contains(t, w.Body.String(), `"total":{"amount":"299.97","currency":"USD"}`)
+
 	// Check that stock was reduced
 	updatedProduct, err := testutil.GetTestProduct(t, 1)
 	assert.NoError(t, err)
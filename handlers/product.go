@@ -2,24 +2,35 @@ package handlers
 
 import (
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"smarapp-api/audit"
 	"smarapp-api/database"
 	"smarapp-api/models"
+	"smarapp-api/storage"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
-type ProductHandler struct{}
+type ProductHandler struct {
+	Images       storage.BlobStore // Nil disables image uploads
+	MaxImageSize int64             // Bytes
+}
 
 func NewProductHandler() *ProductHandler {
-	return &ProductHandler{}
+	return &ProductHandler{MaxImageSize: defaultMaxImageSize}
 }
 
 // CreateProduct godoc
 // @Summary Create a new product (Admin only)
-// @Description Create a new product with name, description, price and stock
+// @Description Create a new product with name, description, price and stock. The currency of the price is the product's currency.
 // @Tags Products
 // @Accept json
 // @Produce json
@@ -38,11 +49,32 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 
+	if !validatePrice(c, *req.Price, "") {
+		return
+	}
+	categoryIDs, ok := validateCategoryIDs(c, req.CategoryIDs)
+	if !ok {
+		return
+	}
+	tags, ok := normalizeTags(c, req.Tags)
+	if !ok {
+		return
+	}
+
 	userID, _ := c.Get("user_id")
 
-	result, err := database.DB.Exec(
-		"INSERT INTO products (name, description, price, stock, created_by, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
-		req.Name, req.Description, req.Price, req.Stock, userID, time.Now(), time.Now(),
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// The initial stock is booked as a receipt
+	now := time.Now()
+	result, err := tx.Exec(
+		"INSERT INTO products (name, description, price, currency, stock, created_by, created_at, updated_at) VALUES (?, ?, ?, ?, 0, ?, ?, ?)",
+		req.Name, req.Description, req.Price.Amount, req.Price.Currency, userID, now, now,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
@@ -51,31 +83,140 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 
 	productID, _ := result.LastInsertId()
 
+	if req.Stock > 0 {
+		movement := models.InventoryMovement{
+			ProductID: int(productID),
+			Kind:      models.MovementReceipt,
+			Quantity:  req.Stock,
+			Reason:    "Initial stock",
+		}
+		if err := recordMovement(c, tx, &movement); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record stock"})
+			return
+		}
+	}
+
+	if err := setProductCategories(tx, int(productID), categoryIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign categories"})
+		return
+	}
+	if err := setProductTags(tx, int(productID), tags); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign tags"})
+		return
+	}
+
 	product := models.Product{
 		ID:          int(productID),
 		Name:        req.Name,
 		Description: req.Description,
-		Price:       req.Price,
+		Price:       *req.Price,
 		Stock:       req.Stock,
 		CreatedBy:   userID.(int),
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		CategoryIDs: categoryIDs,
+		Tags:        tags,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := tx.QueryRow("SELECT version FROM products WHERE id = ?", productID).Scan(&product.Version); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "product.create", auditTargetProduct, product.ID, nil, product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
 	}
 
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.Header("ETag", versionETag(product.Version))
 	c.JSON(http.StatusCreated, product)
 }
 
 // GetProducts godoc
-// @Summary Get all products
-// @Description Get a list of all products
+// @Summary List products
+// @Description Get a page of products. Pages are cursor based: pass the next_cursor of a response as cursor, with the same sort and filters, to get the following page. The total counts every product matching the filters.
 // @Tags Products
 // @Produce json
-// @Success 200 {array} models.Product
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "created_at, price, name or stock, prefixed with - for descending order (default -created_at)"
+// @Param currency query string false "Only products priced in this ISO 4217 currency"
+// @Param min_price query string false "Minimum price as a decimal, in currency (default USD)"
+// @Param max_price query string false "Maximum price as a decimal, in currency (default USD)"
+// @Param in_stock query bool false "Only products with stock left"
+// @Param created_by query int false "Filter by creator"
+// @Param tag query string false "Filter by tag"
+// @Success 200 {object} models.ProductListResponse
+// @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /products [get]
 func (h *ProductHandler) GetProducts(c *gin.Context) {
+	listProducts(c, "", nil)
+}
+
+// listProducts responds with a page of the products matching the query
+// filters. scope is an extra condition, starting with " AND", that the
+// products have to meet.
+func listProducts(c *gin.Context, scope string, scopeArgs []interface{}) {
+	limit := defaultPageSize
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid limit (must be between 1 and %d)", maxPageSize)})
+			return
+		}
+		limit = parsed
+	}
+
+	sortParam := c.DefaultQuery("sort", "-created_at")
+	field, descending := strings.CutPrefix(sortParam, "-")
+	sort, ok := productSorts[field]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort (use created_at, price, name or stock, optionally prefixed with -)"})
+		return
+	}
+
+	where, args, err := productFilters(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	where += scope
+	args = append(args, scopeArgs...)
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM products"+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count products"})
+		return
+	}
+
+	// Keyset pagination: continue after the last row of the previous page,
+	// with the ID breaking ties between equal sort keys
+	order, comparison := "ASC", ">"
+	if descending {
+		order, comparison = "DESC", "<"
+	}
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodeProductCursor(value)
+		if err != nil || cursor.Sort != sortParam {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		where += fmt.Sprintf(" AND (%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", sort.column, comparison)
+		args = append(args, cursor.Key, cursor.Key, cursor.ID)
+	}
+
+	// One extra row tells whether there is a next page
 	rows, err := database.DB.Query(
-		"SELECT id, name, description, price, stock, created_by, created_at, updated_at FROM products ORDER BY created_at DESC",
+		fmt.Sprintf(
+			"SELECT %s, %s FROM products%s ORDER BY %s %s, id %s LIMIT ?",
+			productColumns, sort.key, where, sort.column, order, order,
+		),
+		append(args, limit+1)...,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
@@ -83,21 +224,47 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 	}
 	defer rows.Close()
 
-	var products []models.Product
+	products := []models.Product{}
+	keys := []interface{}{}
 	for rows.Next() {
 		var product models.Product
+		var key interface{}
 		err := rows.Scan(
-			&product.ID, &product.Name, &product.Description, &product.Price,
-			&product.Stock, &product.CreatedBy, &product.CreatedAt, &product.UpdatedAt,
+			&product.ID, &product.Name, &product.Description, &product.Price.Amount, &product.Price.Currency,
+			&product.Stock, &product.CreatedBy, &product.Version, &product.CreatedAt, &product.UpdatedAt, &product.DeletedAt, &key,
 		)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan product"})
 			return
 		}
 		products = append(products, product)
+		keys = append(keys, key)
 	}
+	rows.Close()
 
-	c.JSON(http.StatusOK, products)
+	if len(products) > limit {
+		products = products[:limit]
+	}
+	page := make([]*models.Product, len(products))
+	for i := range products {
+		page[i] = &products[i]
+	}
+	if err := loadProductRelations(database.DB, page...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+		return
+	}
+
+	response := models.ProductListResponse{Products: products, Total: total}
+	if len(keys) > limit {
+		last := response.Products[limit-1]
+		response.NextCursor, err = encodeProductCursor(productCursor{Sort: sortParam, Key: keys[limit-1], ID: last.ID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode cursor"})
+			return
+		}
+	}
+
+	jsonWithWeakETag(c, response)
 }
 
 func (h *ProductHandler) GetProduct(c *gin.Context) {
@@ -108,15 +275,7 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 		return
 	}
 
-	var product models.Product
-	err = database.DB.QueryRow(
-		"SELECT id, name, description, price, stock, created_by, created_at, updated_at FROM products WHERE id = ?",
-		id,
-	).Scan(
-		&product.ID, &product.Name, &product.Description, &product.Price,
-		&product.Stock, &product.CreatedBy, &product.CreatedAt, &product.UpdatedAt,
-	)
-
+	product, err := loadProduct(database.DB, id)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
@@ -126,12 +285,33 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 		return
 	}
 
+	if notModified(c, versionETag(product.Version)) {
+		return
+	}
 	c.JSON(http.StatusOK, product)
 }
 
+// UpdateProduct godoc
+// @Summary Replace a product (Admin only)
+// @Description Replace every field of a product. Omitted category_ids or tags remove the assignments. Use PATCH to change single fields.
+// @Tags Products
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Param If-Match header string false "ETag the change is based on"
+// @Param product body models.UpdateProductRequest true "Product"
+// @Success 200 {object} models.Product
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /products/{id} [put]
 func (h *ProductHandler) UpdateProduct(c *gin.Context) {
-	idParam := c.Param("id")
-	id, err := strconv.Atoi(idParam)
+	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
 		return
@@ -143,48 +323,246 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 		return
 	}
 
-	// Check if product exists
-	var existingProduct models.Product
-	err = database.DB.QueryRow("SELECT id FROM products WHERE id = ?", id).Scan(&existingProduct.ID)
+	// A replacement without lists clears them
+	patch := models.PatchProductRequest{
+		Name:        &req.Name,
+		Description: &req.Description,
+		Price:       req.Price,
+		Stock:       req.Stock,
+		CategoryIDs: req.CategoryIDs,
+		Tags:        req.Tags,
+	}
+	if patch.CategoryIDs == nil {
+		patch.CategoryIDs = []int{}
+	}
+	if patch.Tags == nil {
+		patch.Tags = []string{}
+	}
+
+	h.updateProduct(c, id, patch, true)
+}
+
+// PatchProduct godoc
+// @Summary Update fields of a product (Admin only)
+// @Description Apply a JSON merge patch (RFC 7396) to a product. Omitted fields are kept. category_ids and tags replace the lists, an empty list or null removes every assignment. The other fields cannot be null.
+// @Tags Products
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Param If-Match header string false "ETag the change is based on"
+// @Param product body models.PatchProductRequest true "Changed fields"
+// @Success 200 {object} models.Product
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /products/{id} [patch]
+func (h *ProductHandler) PatchProduct(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	// Nulls are only visible in the raw document, the struct cannot tell
+	// them from omitted fields
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request body must be a JSON object"})
+		return
+	}
+	var req models.PatchProductRequest
+	if err := binding.JSON.BindBody(body, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for name, value := range fields {
+		if string(value) != "null" {
+			continue
+		}
+		switch name {
+		case "category_ids":
+			req.CategoryIDs = []int{}
+		case "tags":
+			req.Tags = []string{}
+		case "name", "description", "price", "stock":
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s cannot be null", name)})
+			return
+		}
+	}
+
+	h.updateProduct(c, id, req, false)
+}
+
+// updateProduct writes the non-nil fields of a patch. When replacing, a stock
+// equal to the current one is accepted for products with variants, so a
+// product can be written back as it was read.
+func (h *ProductHandler) updateProduct(c *gin.Context, id int, req models.PatchProductRequest, replace bool) {
+	if req.Price != nil && !validatePrice(c, *req.Price, "") {
+		return
+	}
+	categoryIDs, ok := validateCategoryIDs(c, req.CategoryIDs)
+	if !ok {
+		return
+	}
+	tags, ok := normalizeTags(c, req.Tags)
+	if !ok {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := loadProduct(tx, id)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !ifMatch(c, versionETag(before.Version)) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Product has been modified, reload it and try again"})
+		return
+	}
+
+	// The stock of a product with variants is the sum of the variants' stock
+	if req.Stock != nil {
+		var hasVariants bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM product_variants WHERE product_id = ?)", id).Scan(&hasVariants); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if hasVariants {
+			if !replace || *req.Stock != before.Stock {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Stock of a product with variants is set per variant"})
+				return
+			}
+			req.Stock = nil
+		}
+	}
+
+	// Variant prices are amounts in the product's currency, they would change
+	// value with it
+	if req.Price != nil && req.Price.Currency != before.Price.Currency {
+		var overridden bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM product_variants WHERE product_id = ? AND price IS NOT NULL)", id).Scan(&overridden); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if overridden {
+			c.JSON(http.StatusConflict, gin.H{"error": "Remove the variant prices before changing the currency"})
+			return
+		}
+	}
 
-	// Build dynamic update query
 	query := "UPDATE products SET updated_at = ?"
 	args := []interface{}{time.Now()}
 
-	if req.Name != "" {
+	if req.Name != nil {
 		query += ", name = ?"
-		args = append(args, req.Name)
+		args = append(args, *req.Name)
 	}
-	if req.Description != "" {
+	if req.Description != nil {
 		query += ", description = ?"
-		args = append(args, req.Description)
+		args = append(args, *req.Description)
 	}
-	if req.Price > 0 {
-		query += ", price = ?"
-		args = append(args, req.Price)
+	if req.Price != nil {
+		query += ", price = ?, currency = ?"
+		args = append(args, req.Price.Amount, req.Price.Currency)
 	}
-	if req.Stock >= 0 {
-		query += ", stock = ?"
-		args = append(args, req.Stock)
+	// Only the version that was checked is overwritten
+	query += " WHERE id = ? AND version = ?"
+	args = append(args, id, before.Version)
+
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Product has been modified, reload it and try again"})
+		return
 	}
 
-	query += " WHERE id = ?"
-	args = append(args, id)
+	// Setting the stock books the difference as an adjustment
+	if req.Stock != nil && *req.Stock != before.Stock {
+		movement := models.InventoryMovement{
+			ProductID: id,
+			Kind:      models.MovementAdjustment,
+			Quantity:  *req.Stock - before.Stock,
+			Reason:    "Stock set by product update",
+		}
+		if err := recordMovement(c, tx, &movement); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+			return
+		}
+	}
 
-	_, err = database.DB.Exec(query, args...)
+	// Omitted lists are kept, empty lists remove every assignment
+	if req.CategoryIDs != nil {
+		if err := setProductCategories(tx, id, categoryIDs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign categories"})
+			return
+		}
+	}
+	if req.Tags != nil {
+		if err := setProductTags(tx, id, tags); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign tags"})
+			return
+		}
+	}
+
+	product, err := loadProduct(tx, id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
-	// Fetch updated product
-	h.GetProduct(c)
+	if err := recordAudit(c, tx, "product.update", auditTargetProduct, id, before, product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.Header("ETag", versionETag(product.Version))
+	c.JSON(http.StatusOK, product)
 }
 
+// DeleteProduct godoc
+// @Summary Move a product to the trash (Admin only)
+// @Description Hide a product from listings, search and ordering. Its orders keep referring to it, and it can be restored until it is purged.
+// @Tags Products
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Param If-Match header string false "ETag the change is based on"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /products/{id} [delete]
 func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
@@ -193,17 +571,443 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	result, err := database.DB.Exec("DELETE FROM products WHERE id = ?", id)
+	tx, err := database.DB.Begin()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
 		return
 	}
+	defer tx.Rollback()
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	product, err := loadProduct(tx, id)
+	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !ifMatch(c, versionETag(product.Version)) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Product has been modified, reload it and try again"})
+		return
+	}
+
+	// Images, variants and the rest stay with the product until it is
+	// purged. deleted_at is in UTC so that purges can compare it in SQL.
+	result, err := tx.Exec(
+		"UPDATE products SET deleted_at = ?, updated_at = ? WHERE id = ? AND version = ?",
+		time.Now().UTC(), time.Now(), id, product.Version,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Product has been modified, reload it and try again"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "product.delete", auditTargetProduct, id, product, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
 }
+
+// RestoreProduct godoc
+// @Summary Restore a product from the trash (Admin only)
+// @Description Bring back a deleted product as it was before it was deleted.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Param If-Match header string false "ETag the change is based on"
+// @Success 200 {object} models.Product
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/products/{id}/restore [post]
+func (h *ProductHandler) RestoreProduct(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := loadAnyProduct(tx, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if before.DeletedAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Product is not deleted"})
+		return
+	}
+	if !ifMatch(c, versionETag(before.Version)) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Product has been modified, reload it and try again"})
+		return
+	}
+
+	result, err := tx.Exec(
+		"UPDATE products SET deleted_at = NULL, updated_at = ? WHERE id = ? AND version = ?",
+		time.Now(), id, before.Version,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore product"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Product has been modified, reload it and try again"})
+		return
+	}
+
+	product, err := loadProduct(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "product.restore", auditTargetProduct, id, before, product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.Header("ETag", versionETag(product.Version))
+	c.JSON(http.StatusOK, product)
+}
+
+// PurgeDeletedProducts removes the products deleted before a cutoff for
+// good, with their images. Products that were ordered stay in the trash so
+// that order history keeps showing them.
+func (h *ProductHandler) PurgeDeletedProducts(before time.Time) (int, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		"SELECT "+productColumns+" FROM products WHERE deleted_at < ? "+
+			"AND NOT EXISTS (SELECT 1 FROM orders WHERE orders.product_id = products.id) ORDER BY id",
+		before.UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	var products []*models.Product
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		products = append(products, &product)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(products) == 0 {
+		return 0, nil
+	}
+	if err := loadProductRelations(tx, products...); err != nil {
+		return 0, err
+	}
+
+	var imageKeys [][2]string
+	for _, product := range products {
+		keys, err := productImageKeys(tx, product.ID)
+		if err != nil {
+			return 0, err
+		}
+		imageKeys = append(imageKeys, keys...)
+
+		if _, err := tx.Exec("DELETE FROM products WHERE id = ?", product.ID); err != nil {
+			return 0, err
+		}
+		err = audit.Record(tx, audit.Event{
+			Action:     "product.purge",
+			TargetType: auditTargetProduct,
+			TargetID:   strconv.Itoa(product.ID),
+			Before:     product,
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	for _, keys := range imageKeys {
+		h.deleteImageBlobs(keys[0], keys[1])
+	}
+	return len(products), nil
+}
+
+// bumpProductVersions moves on the version of the products selected by a
+// query, for changes that show in a product but are stored in other tables
+func bumpProductVersions(tx *sql.Tx, productIDs string, args ...interface{}) error {
+	_, err := tx.Exec("UPDATE products SET version = version + 1 WHERE id IN ("+productIDs+")", args...)
+	return err
+}
+
+// productColumns is the column list read by scanProduct
+const productColumns = "id, name, description, price, currency, stock, created_by, version, created_at, updated_at, deleted_at"
+
+func scanProduct(row rowScanner) (models.Product, error) {
+	var product models.Product
+	err := row.Scan(
+		&product.ID, &product.Name, &product.Description, &product.Price.Amount, &product.Price.Currency,
+		&product.Stock, &product.CreatedBy, &product.Version, &product.CreatedAt, &product.UpdatedAt, &product.DeletedAt,
+	)
+	return product, err
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// loadProduct reads a product with its categories and tags. Products in the
+// trash are not found, so they can neither be viewed nor changed.
+func loadProduct(q queryer, id int) (models.Product, error) {
+	return readProduct(q, "id = ? AND deleted_at IS NULL", id)
+}
+
+// loadAnyProduct is loadProduct including products in the trash
+func loadAnyProduct(q queryer, id int) (models.Product, error) {
+	return readProduct(q, "id = ?", id)
+}
+
+func readProduct(q queryer, where string, id int) (models.Product, error) {
+	product, err := scanProduct(q.QueryRow("SELECT "+productColumns+" FROM products WHERE "+where, id))
+	if err != nil {
+		return product, err
+	}
+	err = loadProductRelations(q, &product)
+	return product, err
+}
+
+// loadProductRelations fills in the category IDs, tags and images of
+// products with one query each for all of them
+func loadProductRelations(q queryer, products ...*models.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	byID := map[int]*models.Product{}
+	placeholders := make([]string, len(products))
+	args := make([]interface{}, len(products))
+	for i, product := range products {
+		product.CategoryIDs = []int{}
+		product.Tags = []string{}
+		product.Images = []models.ProductImage{}
+		byID[product.ID] = product
+		placeholders[i] = "?"
+		args[i] = product.ID
+	}
+	in := strings.Join(placeholders, ", ")
+
+	rows, err := q.Query("SELECT product_id, category_id FROM product_categories WHERE product_id IN ("+in+") ORDER BY category_id", args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var productID, categoryID int
+		if err := rows.Scan(&productID, &categoryID); err != nil {
+			rows.Close()
+			return err
+		}
+		byID[productID].CategoryIDs = append(byID[productID].CategoryIDs, categoryID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = q.Query(
+		"SELECT pt.product_id, t.name FROM product_tags pt JOIN tags t ON t.id = pt.tag_id WHERE pt.product_id IN ("+in+") ORDER BY t.name",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var productID int
+		var tag string
+		if err := rows.Scan(&productID, &tag); err != nil {
+			rows.Close()
+			return err
+		}
+		byID[productID].Tags = append(byID[productID].Tags, tag)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = q.Query("SELECT "+productImageColumns+" FROM product_images WHERE product_id IN ("+in+") ORDER BY position, id", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		image, err := scanProductImage(rows)
+		if err != nil {
+			return err
+		}
+		byID[image.ProductID].Images = append(byID[image.ProductID].Images, image)
+	}
+	return rows.Err()
+}
+
+// productSort is a sort field of GetProducts. key is the expression stored
+// in cursors; timestamps are read as stored text since parsing and
+// formatting them again would not compare equal.
+type productSort struct {
+	column string
+	key    string
+}
+
+var productSorts = map[string]productSort{
+	"created_at": {column: "created_at", key: "CAST(created_at AS TEXT)"},
+	"price":      {column: "price", key: "price"},
+	"name":       {column: "name", key: "name"},
+	"stock":      {column: "stock", key: "stock"},
+}
+
+// validatePrice requires a positive price, in the given currency unless it
+// is empty
+func validatePrice(c *gin.Context, price models.Money, currency models.Currency) bool {
+	if price.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Price must be greater than zero"})
+		return false
+	}
+	if currency != "" && price.Currency != currency {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Price must be in the product currency (%s)", currency)})
+		return false
+	}
+	return true
+}
+
+// productFilters builds the WHERE clause of GetProducts from its filters.
+// Deleted products are never listed.
+func productFilters(c *gin.Context) (string, []interface{}, error) {
+	where := " WHERE deleted_at IS NULL"
+	args := []interface{}{}
+
+	// Prices only compare within a currency, so price bounds also select
+	// the currency, the default one unless given
+	currency := models.Currency(c.Query("currency"))
+	if currency != "" && !currency.Valid() {
+		return "", nil, errors.New("Invalid currency")
+	}
+	if currency == "" && (c.Query("min_price") != "" || c.Query("max_price") != "") {
+		currency = models.DefaultCurrency
+	}
+	if currency != "" {
+		where += " AND currency = ?"
+		args = append(args, currency)
+	}
+
+	for _, bound := range []struct{ param, condition string }{
+		{"min_price", " AND price >= ?"},
+		{"max_price", " AND price <= ?"},
+	} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		price, err := models.ParseMoney(value, currency)
+		if err != nil || price.Amount < 0 {
+			return "", nil, fmt.Errorf("Invalid %s", bound.param)
+		}
+		where += bound.condition
+		args = append(args, price.Amount)
+	}
+
+	if value := c.Query("in_stock"); value != "" {
+		inStock, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", nil, errors.New("Invalid in_stock")
+		}
+		if inStock {
+			where += " AND stock > 0"
+		}
+	}
+
+	if value := c.Query("created_by"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return "", nil, errors.New("Invalid created_by")
+		}
+		where += " AND created_by = ?"
+		args = append(args, id)
+	}
+
+	if value := c.Query("tag"); value != "" {
+		where += " AND id IN (SELECT pt.product_id FROM product_tags pt JOIN tags t ON t.id = pt.tag_id WHERE t.name = ?)"
+		args = append(args, normalizeTag(value))
+	}
+
+	return where, args, nil
+}
+
+// productCursor points at the last product of a page
+type productCursor struct {
+	Sort string      `json:"s"`
+	Key  interface{} `json:"k"`
+	ID   int         `json:"id"`
+}
+
+func encodeProductCursor(cursor productCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeProductCursor(value string) (productCursor, error) {
+	var cursor productCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, err
+	}
+	if cursor.Key == nil {
+		return cursor, errors.New("cursor without key")
+	}
+	return cursor, nil
+}
@@ -0,0 +1,486 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"smarapp-api/database"
+	"smarapp-api/imaging"
+	"smarapp-api/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	_ "image/gif"
+)
+
+const (
+	defaultMaxImageSize = 5 << 20
+	// Decoding allocates about 4 bytes per pixel, so huge dimensions are
+	// refused before decoding
+	maxImagePixels = 40_000_000
+	// Room for the multipart headers around the file
+	multipartOverhead = 1 << 20
+)
+
+// imageTypes maps the accepted content types, as sniffed from the data, to
+// the extension of the original and of its thumbnails
+var imageTypes = map[string]struct{ ext, thumbnailExt string }{
+	"image/jpeg": {"jpg", "jpg"},
+	"image/png":  {"png", "png"},
+	"image/gif":  {"gif", "png"},
+}
+
+// thumbnailSizes are generated for every image, each fitting in a square of
+// the given side
+var thumbnailSizes = []struct {
+	name string
+	side int
+}{
+	{"small", 160},
+	{"medium", 480},
+	{"large", 1200},
+}
+
+// UploadProductImage godoc
+// @Summary Upload a product image (Admin only)
+// @Description Add a JPEG, PNG or GIF image to the end of a product's gallery. The type is detected from the file content. Small, medium and large thumbnails are generated.
+// @Tags Products
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Param image formData file true "Image file"
+// @Success 201 {object} models.ProductImage
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 415 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /products/{id}/images [post]
+func (h *ProductHandler) UploadProductImage(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	if h.Images == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Image storage is not configured"})
+		return
+	}
+
+	var exists bool
+	if err := database.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM products WHERE id = ? AND deleted_at IS NULL)", id).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	tooLarge := fmt.Sprintf("Image is too large (max %d KB)", h.MaxImageSize>>10)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.MaxImageSize+multipartOverhead)
+	fileHeader, err := c.FormFile("image")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": tooLarge})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An image file is required in the \"image\" form field"})
+		return
+	}
+	if fileHeader.Size > h.MaxImageSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": tooLarge})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read image"})
+		return
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read image"})
+		return
+	}
+
+	// The declared content type is not trusted
+	contentType := http.DetectContentType(data)
+	imageType, ok := imageTypes[contentType]
+	if !ok {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported image type, use JPEG, PNG or GIF"})
+		return
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image"})
+		return
+	}
+	if config.Width*config.Height > maxImagePixels {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Image is too large (max %d megapixels)", maxImagePixels/1_000_000)})
+		return
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image"})
+		return
+	}
+
+	// Every upload gets its own directory so keys are never reused
+	token, err := generateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store image"})
+		return
+	}
+	dir := fmt.Sprintf("products/%d/%s", id, token[:22])
+
+	productImage := models.ProductImage{
+		ProductID:   id,
+		Thumbnails:  map[string]string{},
+		ContentType: contentType,
+		Width:       config.Width,
+		Height:      config.Height,
+		Size:        int64(len(data)),
+	}
+	originalKey := dir + "/original." + imageType.ext
+
+	ctx := c.Request.Context()
+	if err := h.Images.Put(ctx, originalKey, data, contentType); err != nil {
+		log.Printf("Failed to store image %s: %v", originalKey, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store image"})
+		return
+	}
+	productImage.URL = h.Images.URL(originalKey)
+
+	for _, size := range thumbnailSizes {
+		key := dir + "/" + size.name + "." + imageType.thumbnailExt
+		thumbnail, thumbnailType, err := encodeThumbnail(decoded, size.side, imageType.thumbnailExt)
+		if err == nil {
+			err = h.Images.Put(ctx, key, thumbnail, thumbnailType)
+		}
+		if err != nil {
+			log.Printf("Failed to store thumbnail %s: %v", key, err)
+			h.deleteImageBlobs(originalKey, imageType.thumbnailExt)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store image"})
+			return
+		}
+		productImage.Thumbnails[size.name] = h.Images.URL(key)
+	}
+
+	// Blobs are only removed again if the image could not be recorded
+	stored := false
+	defer func() {
+		if !stored {
+			h.deleteImageBlobs(originalKey, imageType.thumbnailExt)
+		}
+	}()
+
+	thumbnails, err := json.Marshal(productImage.Thumbnails)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store image"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	productImage.CreatedAt = time.Now()
+	err = tx.QueryRow(`
+		INSERT INTO product_images (product_id, position, original_key, thumbnail_ext, url, thumbnails, content_type, width, height, size, created_at)
+		VALUES (?, (SELECT COALESCE(MAX(position) + 1, 0) FROM product_images WHERE product_id = ?), ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, position`,
+		id, id, originalKey, imageType.thumbnailExt, productImage.URL, string(thumbnails),
+		contentType, productImage.Width, productImage.Height, productImage.Size, productImage.CreatedAt,
+	).Scan(&productImage.ID, &productImage.Position)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE products SET version = version + 1 WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "product.image_add", auditTargetProduct, id, nil, productImage); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	stored = true
+
+	c.JSON(http.StatusCreated, productImage)
+}
+
+// ReorderProductImages godoc
+// @Summary Reorder a product's images (Admin only)
+// @Description Set the display order of a product's gallery. The list must contain every image of the product exactly once.
+// @Tags Products
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Param order body models.ReorderImagesRequest true "Image IDs in the new order"
+// @Success 200 {array} models.ProductImage
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /products/{id}/images/order [put]
+func (h *ProductHandler) ReorderProductImages(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req models.ReorderImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := loadProduct(tx, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	current := map[int]bool{}
+	for _, image := range before.Images {
+		current[image.ID] = true
+	}
+	seen := map[int]bool{}
+	for _, imageID := range req.ImageIDs {
+		if !current[imageID] || seen[imageID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "image_ids must list every image of the product exactly once"})
+			return
+		}
+		seen[imageID] = true
+	}
+	if len(seen) != len(current) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image_ids must list every image of the product exactly once"})
+		return
+	}
+
+	for position, imageID := range req.ImageIDs {
+		if _, err := tx.Exec("UPDATE product_images SET position = ? WHERE id = ?", position, imageID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder images"})
+			return
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE products SET version = version + 1 WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder images"})
+		return
+	}
+
+	after, err := loadProduct(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	err = recordAudit(c, tx, "product.images_reorder", auditTargetProduct, id, gin.H{"image_ids": imageIDs(before.Images)}, gin.H{"image_ids": req.ImageIDs})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, after.Images)
+}
+
+// DeleteProductImage godoc
+// @Summary Delete a product image (Admin only)
+// @Description Remove an image and its thumbnails from a product's gallery
+// @Tags Products
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Param image_id path int true "Image ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /products/{id}/images/{image_id} [delete]
+func (h *ProductHandler) DeleteProductImage(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+	imageID, err := strconv.Atoi(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image ID"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var originalKey, thumbnailExt string
+	productImage, err := scanProductImage(tx.QueryRow(
+		"DELETE FROM product_images WHERE id = ? AND product_id = ? AND product_id IN (SELECT id FROM products WHERE deleted_at IS NULL) "+
+			"RETURNING "+productImageColumns+", original_key, thumbnail_ext",
+		imageID, id,
+	), &originalKey, &thumbnailExt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete image"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE products SET version = version + 1 WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete image"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "product.image_delete", auditTargetProduct, id, productImage, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	h.deleteImageBlobs(originalKey, thumbnailExt)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Image deleted successfully"})
+}
+
+// productImageColumns is the column list read by scanProductImage
+const productImageColumns = "id, product_id, position, url, thumbnails, content_type, width, height, size, created_at"
+
+// scanProductImage reads productImageColumns followed by any extra columns
+// into extra
+func scanProductImage(row rowScanner, extra ...interface{}) (models.ProductImage, error) {
+	var productImage models.ProductImage
+	var thumbnails string
+	dest := append([]interface{}{
+		&productImage.ID, &productImage.ProductID, &productImage.Position, &productImage.URL, &thumbnails,
+		&productImage.ContentType, &productImage.Width, &productImage.Height, &productImage.Size, &productImage.CreatedAt,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return productImage, err
+	}
+	err := json.Unmarshal([]byte(thumbnails), &productImage.Thumbnails)
+	return productImage, err
+}
+
+// encodeThumbnail scales an image to fit in a square of the given side and
+// encodes it as JPEG or PNG
+func encodeThumbnail(src image.Image, side int, ext string) ([]byte, string, error) {
+	thumbnail := imaging.Fit(src, side)
+	var buf bytes.Buffer
+	if ext == "jpg" {
+		err := jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: 85})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	err := png.Encode(&buf, thumbnail)
+	return buf.Bytes(), "image/png", err
+}
+
+// deleteImageBlobs removes an original and its thumbnails from storage.
+// Failures are only logged: the image is already gone from the gallery.
+func (h *ProductHandler) deleteImageBlobs(originalKey, thumbnailExt string) {
+	if h.Images == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	keys := []string{originalKey}
+	for _, size := range thumbnailSizes {
+		keys = append(keys, path.Dir(originalKey)+"/"+size.name+"."+thumbnailExt)
+	}
+	for _, key := range keys {
+		if err := h.Images.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete image %s: %v", key, err)
+		}
+	}
+}
+
+// productImageKeys returns the original key and thumbnail extension of each
+// image of a product
+func productImageKeys(q queryer, productID int) ([][2]string, error) {
+	rows, err := q.Query("SELECT original_key, thumbnail_ext FROM product_images WHERE product_id = ?", productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys [][2]string
+	for rows.Next() {
+		var key [2]string
+		if err := rows.Scan(&key[0], &key[1]); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func imageIDs(images []models.ProductImage) []int {
+	ids := make([]int, len(images))
+	for i, image := range images {
+		ids[i] = image.ID
+	}
+	return ids
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"smarapp-api/middleware"
+	"smarapp-api/models"
+	"smarapp-api/storage"
+	"smarapp-api/testutil"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newImageRouter wires the image routes behind the real middleware, as in main.go
+func newImageRouter(jwtSecret string, productHandler *ProductHandler) *gin.Engine {
+	r := newTestRouter(jwtSecret)
+	r.GET("/products/:id", productHandler.GetProduct)
+
+	products := r.Require("/products", models.PermissionProductsWrite)
+	products.DELETE("/:id", productHandler.DeleteProduct)
+	products.POST("/:id/images", productHandler.UploadProductImage)
+	products.PUT("/:id/images/order", productHandler.ReorderProductImages)
+	products.DELETE("/:id/images/:image_id", productHandler.DeleteProductImage)
+	return r.Engine
+}
+
+func testImage(t *testing.T, format string, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	assert.NoError(t, err)
+	return buf.Bytes()
+}
+
+func uploadImage(r *gin.Engine, productID int, token, filename string, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("image", filename)
+	part.Write(data)
+	form.Close()
+
+	req := httptest.NewRequest("POST", fmt.Sprintf("/products/%d/images", productID), &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// mediaFiles lists the stored blobs relative to the media directory
+func mediaFiles(t *testing.T, dir string) []string {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	return files
+}
+
+func TestProductHandler_Images(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	mediaDir := t.TempDir()
+	productHandler := NewProductHandler()
+	productHandler.Images = storage.NewLocalStore(mediaDir, "http://cdn.test/media")
+	productHandler.MaxImageSize = 64 << 10
+
+	jwtSecret := "test-secret"
+	r := newImageRouter(jwtSecret, productHandler)
+
+	adminToken, _ := seedTokens(t, jwtSecret)
+	userToken, err := middleware.GenerateToken(models.User{ID: 2, Username: "user", Email: "user@test.com", Role: models.RoleUser}, jwtSecret)
+	assert.NoError(t, err)
+
+	w := uploadImage(r, 1, userToken, "photo.png", testImage(t, "png", 10, 10))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = uploadImage(r, 999, adminToken, "photo.png", testImage(t, "png", 10, 10))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// The type is detected from the content, not the file name
+	w = uploadImage(r, 1, adminToken, "photo.png", []byte("GIF? no, just some text"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	w = uploadImage(r, 1, adminToken, "photo.png", append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = uploadImage(r, 1, adminToken, "photo.png", make([]byte, 65<<10))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Empty(t, mediaFiles(t, mediaDir))
+
+	w = uploadImage(r, 1, adminToken, "wide.photo", testImage(t, "jpeg", 600, 300))
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var first models.ProductImage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+	assert.Equal(t, "image/jpeg", first.ContentType)
+	assert.Equal(t, 600, first.Width)
+	assert.Equal(t, 300, first.Height)
+	assert.Equal(t, 0, first.Position)
+	assert.Regexp(t, `^http://cdn\.test/media/products/1/[\w-]+/original\.jpg$`, first.URL)
+	assert.Len(t, first.Thumbnails, 3)
+
+	// Thumbnails fit their size and are never upscaled
+	for name, side := range map[string]int{"small": 160, "medium": 480, "large": 600} {
+		url, ok := first.Thumbnails[name]
+		if !assert.True(t, ok, name) {
+			continue
+		}
+		file, err := os.Open(filepath.Join(mediaDir, url[len("http://cdn.test/media/"):]))
+		if !assert.NoError(t, err) {
+			continue
+		}
+		config, format, err := image.DecodeConfig(file)
+		file.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, "jpeg", format)
+		assert.Equal(t, side, config.Width, name)
+		assert.Equal(t, side/2, config.Height, name)
+	}
+
+	w = uploadImage(r, 1, adminToken, "second.png", testImage(t, "png", 20, 20))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var second models.ProductImage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &second))
+	assert.Equal(t, 1, second.Position)
+	assert.Contains(t, second.Thumbnails["small"], "/small.png")
+	assert.Len(t, mediaFiles(t, mediaDir), 8)
+
+	// Images are listed with the product in gallery order
+	w = performJSON(r, "GET", "/products/1", "", nil)
+	var product models.Product
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &product))
+	if assert.Len(t, product.Images, 2) {
+		assert.Equal(t, first.ID, product.Images[0].ID)
+		assert.Equal(t, first.Thumbnails, product.Images[0].Thumbnails)
+	}
+
+	w = performJSON(r, "PUT", "/products/1/images/order", adminToken, models.ReorderImagesRequest{ImageIDs: []int{second.ID}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performJSON(r, "PUT", "/products/1/images/order", adminToken, models.ReorderImagesRequest{ImageIDs: []int{second.ID, second.ID}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performJSON(r, "PUT", "/products/1/images/order", adminToken, models.ReorderImagesRequest{ImageIDs: []int{second.ID, first.ID}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var images []models.ProductImage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &images))
+	if assert.Len(t, images, 2) {
+		assert.Equal(t, second.ID, images[0].ID)
+		assert.Equal(t, 1, images[1].Position)
+	}
+
+	// Deleting an image removes its blobs
+	w = performJSON(r, "DELETE", fmt.Sprintf("/products/2/images/%d", second.ID), adminToken, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = performJSON(r, "DELETE", fmt.Sprintf("/products/1/images/%d", second.ID), adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, mediaFiles(t, mediaDir), 4)
+
+	// Deleted products keep their images in the trash until they are purged
+	w = uploadImage(r, 2, adminToken, "other.png", testImage(t, "png", 20, 20))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = performJSON(r, "DELETE", "/products/2", adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Len(t, mediaFiles(t, mediaDir), 8)
+	w = uploadImage(r, 2, adminToken, "another.png", testImage(t, "png", 20, 20))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	purged, err := productHandler.PurgeDeletedProducts(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.Len(t, mediaFiles(t, mediaDir), 4)
+}
+
+func TestProductHandler_ImagesWithoutStorage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	jwtSecret := "test-secret"
+	r := newImageRouter(jwtSecret, NewProductHandler())
+	adminToken, _ := seedTokens(t, jwtSecret)
+
+	w := uploadImage(r, 1, adminToken, "photo.png", testImage(t, "png", 10, 10))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxSearchQueryLength = 100
+	maxSearchTerms       = 10
+	searchSnippetWords   = 12
+	searchSort           = "rank"
+)
+
+// Matches are marked with control characters that cannot appear in escaped
+// HTML, then turned into <mark> tags once the text is escaped
+const (
+	matchStart = "\x02"
+	matchEnd   = "\x03"
+)
+
+// SearchProducts godoc
+// @Summary Search products
+// @Description Full-text search over product names and descriptions. Every word of the query has to match the start of a word in the product, e.g. "desk lam" finds "Desk lamp". Results are ranked by relevance, name matches first, and carry the name and a snippet of the description with matches wrapped in <mark> tags; the rest of the text is HTML-escaped. Pages work like the product listing.
+// @Tags Products
+// @Produce json
+// @Param q query string true "Search query"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} models.ProductSearchResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /products/search [get]
+func (h *ProductHandler) SearchProducts(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" || len(query) > maxSearchQueryLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Search query is required (at most %d characters)", maxSearchQueryLength)})
+		return
+	}
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query must contain letters or digits"})
+		return
+	}
+
+	limit := defaultPageSize
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid limit (must be between 1 and %d)", maxPageSize)})
+			return
+		}
+		limit = parsed
+	}
+
+	var after *productCursor
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodeProductCursor(value)
+		if _, isNumber := cursor.Key.(float64); err != nil || cursor.Sort != searchSort || !isNumber {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		after = &cursor
+	}
+
+	search := searchProductsLike
+	if database.ProductSearchFTS {
+		search = searchProductsFTS
+	}
+	response, err := search(terms, after, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search products"})
+		return
+	}
+
+	products := make([]*models.Product, len(response.Results))
+	for i := range response.Results {
+		products[i] = &response.Results[i].Product
+	}
+	if err := loadProductRelations(database.DB, products...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search products"})
+		return
+	}
+
+	jsonWithWeakETag(c, response)
+}
+
+// searchProductsFTS ranks matches with bm25, weighting the name above the
+// description
+func searchProductsFTS(terms []string, after *productCursor, limit int) (models.ProductSearchResponse, error) {
+	// Each term is quoted so user input cannot use the FTS5 query syntax
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+	match := strings.Join(quoted, " ")
+
+	response := models.ProductSearchResponse{Results: []models.ProductSearchResult{}}
+	err := database.DB.QueryRow(
+		"SELECT COUNT(*) FROM products_fts JOIN products p ON p.id = products_fts.rowid WHERE products_fts MATCH ? AND p.deleted_at IS NULL", match,
+	).Scan(&response.Total)
+	if err != nil {
+		return response, err
+	}
+
+	where := ""
+	args := []interface{}{matchStart, matchEnd, matchStart, matchEnd, searchSnippetWords, match}
+	if after != nil {
+		where = " WHERE (score > ? OR (score = ? AND id > ?))"
+		args = append(args, after.Key, after.Key, after.ID)
+	}
+	rows, err := database.DB.Query(`
+		SELECT * FROM (
+			SELECT p.id, p.name, p.description, p.price, p.currency, p.stock, p.created_by, p.version, p.created_at, p.updated_at, p.deleted_at,
+				highlight(products_fts, 0, ?, ?),
+				snippet(products_fts, 1, ?, ?, '…', ?),
+				bm25(products_fts, 10.0, 1.0) AS score
+			FROM products_fts JOIN products p ON p.id = products_fts.rowid
+			WHERE products_fts MATCH ? AND p.deleted_at IS NULL
+		)`+where+" ORDER BY score, id LIMIT ?",
+		append(args, limit+1)...,
+	)
+	if err != nil {
+		return response, err
+	}
+	defer rows.Close()
+
+	ranks := []float64{}
+	for rows.Next() {
+		var result models.ProductSearchResult
+		var rank float64
+		err := rows.Scan(
+			&result.ID, &result.Name, &result.Description, &result.Price.Amount, &result.Price.Currency,
+			&result.Stock, &result.CreatedBy, &result.Version, &result.CreatedAt, &result.UpdatedAt, &result.DeletedAt,
+			&result.NameHighlight, &result.DescriptionSnippet, &rank,
+		)
+		if err != nil {
+			return response, err
+		}
+		result.NameHighlight = markMatches(result.NameHighlight)
+		result.DescriptionSnippet = markMatches(result.DescriptionSnippet)
+		response.Results = append(response.Results, result)
+		ranks = append(ranks, rank)
+	}
+	if err := rows.Err(); err != nil {
+		return response, err
+	}
+
+	return response, paginateSearch(&response, ranks, limit)
+}
+
+// searchProductsLike is used when FTS5 is not available. Every term has to
+// occur in the name or description; products matching all terms in the name
+// come first.
+func searchProductsLike(terms []string, after *productCursor, limit int) (models.ProductSearchResponse, error) {
+	response := models.ProductSearchResponse{Results: []models.ProductSearchResult{}}
+
+	where := " WHERE deleted_at IS NULL"
+	args := []interface{}{}
+	nameMatches := []string{}
+	nameArgs := []interface{}{}
+	for _, term := range terms {
+		pattern := likePattern(term)
+		where += ` AND (name LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\')`
+		args = append(args, pattern, pattern)
+		nameMatches = append(nameMatches, `name LIKE ? ESCAPE '\'`)
+		nameArgs = append(nameArgs, pattern)
+	}
+
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM products"+where, args...).Scan(&response.Total); err != nil {
+		return response, err
+	}
+
+	rankExpr := "CASE WHEN " + strings.Join(nameMatches, " AND ") + " THEN 0.0 ELSE 1.0 END"
+	outer := ""
+	outerArgs := []interface{}{}
+	if after != nil {
+		outer = " WHERE (score > ? OR (score = ? AND id > ?))"
+		outerArgs = append(outerArgs, after.Key, after.Key, after.ID)
+	}
+	query := "SELECT * FROM (SELECT " + productColumns + ", " + rankExpr + " AS score FROM products" + where + ")" +
+		outer + " ORDER BY score, id LIMIT ?"
+	queryArgs := append(append(append(nameArgs, args...), outerArgs...), limit+1)
+
+	rows, err := database.DB.Query(query, queryArgs...)
+	if err != nil {
+		return response, err
+	}
+	defer rows.Close()
+
+	ranks := []float64{}
+	for rows.Next() {
+		var result models.ProductSearchResult
+		var rank float64
+		err := rows.Scan(
+			&result.ID, &result.Name, &result.Description, &result.Price.Amount, &result.Price.Currency,
+			&result.Stock, &result.CreatedBy, &result.Version, &result.CreatedAt, &result.UpdatedAt, &result.DeletedAt, &rank,
+		)
+		if err != nil {
+			return response, err
+		}
+		result.NameHighlight = markMatches(highlightWords(result.Name, terms, 0))
+		result.DescriptionSnippet = markMatches(highlightWords(result.Description, terms, searchSnippetWords))
+		response.Results = append(response.Results, result)
+		ranks = append(ranks, rank)
+	}
+	if err := rows.Err(); err != nil {
+		return response, err
+	}
+
+	return response, paginateSearch(&response, ranks, limit)
+}
+
+// paginateSearch trims the extra row fetched beyond the page and points the
+// next cursor at the last result
+func paginateSearch(response *models.ProductSearchResponse, ranks []float64, limit int) error {
+	if len(response.Results) <= limit {
+		return nil
+	}
+
+	response.Results = response.Results[:limit]
+	cursor, err := encodeProductCursor(productCursor{
+		Sort: searchSort,
+		Key:  ranks[limit-1],
+		ID:   response.Results[limit-1].ID,
+	})
+	response.NextCursor = cursor
+	return err
+}
+
+// searchTerms splits a query into words, dropping punctuation
+func searchTerms(query string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	return terms
+}
+
+// highlightWords marks the words of text containing a term. With maxWords
+// set, only a window of that many words around the first match is kept.
+func highlightWords(text string, terms []string, maxWords int) string {
+	words := strings.Fields(text)
+	first := -1
+	for i, word := range words {
+		lower := strings.ToLower(word)
+		for _, term := range terms {
+			if strings.Contains(lower, term) {
+				words[i] = matchStart + word + matchEnd
+				if first < 0 {
+					first = i
+				}
+				break
+			}
+		}
+	}
+
+	if maxWords <= 0 || len(words) <= maxWords {
+		return strings.Join(words, " ")
+	}
+
+	start := first - maxWords/4
+	if start < 0 {
+		start = 0
+	}
+	if start > len(words)-maxWords {
+		start = len(words) - maxWords
+	}
+	snippet := strings.Join(words[start:start+maxWords], " ")
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if start+maxWords < len(words) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// markMatches escapes text for HTML and turns the match markers into <mark> tags
+func markMatches(text string) string {
+	escaped := html.EscapeString(text)
+	return strings.NewReplacer(matchStart, "<mark>", matchEnd, "</mark>").Replace(escaped)
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"smarapp-api/testutil"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func searchProducts(t *testing.T, r *gin.Engine, query string) models.ProductSearchResponse {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/products/search?"+query, nil))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response models.ProductSearchResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func resultIDs(response models.ProductSearchResponse) []int {
+	ids := []int{}
+	for _, result := range response.Results {
+		ids = append(ids, result.ID)
+	}
+	return ids
+}
+
+// The tests run against FTS5 when built with -tags sqlite_fts5 and against
+// the LIKE fallback otherwise
+func TestProductHandler_SearchProducts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	_, err := database.DB.Exec("INSERT INTO users (id, username, email, password, role) VALUES (1, 'admin', 'admin@test.com', '', 'admin')")
+	assert.NoError(t, err)
+
+	products := [][2]string{
+		{"Desk lamp", "Warm light for late nights at the desk"},
+		{"Floor lamp", "Tall lamp with a linen shade"},
+		{"Office chair", "Ergonomic chair, pairs well with any desk lamp"},
+		{"Bookshelf", "Oak shelf for five rows of books"},
+		{"<b>Lamp</b> & co", "Escaped markup"},
+	}
+	for i, p := range products {
+		_, err := database.DB.Exec(
+			"INSERT INTO products (id, name, description, price, stock, created_by) VALUES (?, ?, ?, 10, 1, 1)",
+			i+1, p[0], p[1],
+		)
+		assert.NoError(t, err)
+	}
+
+	r := gin.New()
+	r.GET("/products/search", NewProductHandler().SearchProducts)
+
+	// Prefix matching, every term has to match
+	response := searchProducts(t, r, "q=desk+lam")
+	assert.Equal(t, 2, response.Total)
+	assert.Equal(t, []int{1, 3}, resultIDs(response), "name matches rank above description matches")
+	assert.Equal(t, "<mark>Desk</mark> <mark>lamp</mark>", response.Results[0].NameHighlight)
+	assert.Contains(t, response.Results[1].DescriptionSnippet, "<mark>desk</mark> <mark>lamp</mark>")
+	assert.Equal(t, "Office chair", response.Results[1].Name)
+
+	response = searchProducts(t, r, "q=BOOK")
+	assert.Equal(t, []int{4}, resultIDs(response))
+
+	// Highlights are HTML-escaped apart from the marks
+	response = searchProducts(t, r, "q=markup")
+	if assert.Len(t, response.Results, 1) {
+		assert.NotContains(t, response.Results[0].NameHighlight, "<b>")
+		assert.Contains(t, response.Results[0].NameHighlight, "&lt;b&gt;")
+		assert.Equal(t, "Escaped <mark>markup</mark>", response.Results[0].DescriptionSnippet)
+	}
+
+	// Query syntax is not interpreted
+	response = searchProducts(t, r, "q="+url.QueryEscape(`lamp" OR "chair`))
+	assert.Equal(t, 0, response.Total)
+	assert.Empty(t, response.Results)
+
+	// Pages follow the ranking
+	all := searchProducts(t, r, "q=lamp")
+	assert.Equal(t, 4, all.Total)
+	ids := []int{}
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		query := "q=lamp&limit=1"
+		if cursor != "" {
+			query += "&cursor=" + cursor
+		}
+		page := searchProducts(t, r, query)
+		assert.Equal(t, 4, page.Total)
+		ids = append(ids, resultIDs(page)...)
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, resultIDs(all), ids)
+
+	// Listing cursors cannot be used for search
+	listing, err := encodeProductCursor(productCursor{Sort: "-created_at", Key: "2026-01-01", ID: 1})
+	assert.NoError(t, err)
+
+	for _, query := range []string{"", "q=", "q=+", "q=%21%3F", "q=lamp&limit=0", "q=lamp&cursor=abc", "q=lamp&cursor=" + listing} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/products/search?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestProductHandler_SearchProducts_FollowsChanges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	r := gin.New()
+	r.GET("/products/search", NewProductHandler().SearchProducts)
+
+	assert.Equal(t, 2, searchProducts(t, r, "q=test+product").Total)
+
+	_, err := database.DB.Exec("UPDATE products SET name = 'Teapot' WHERE id = 1")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1}, resultIDs(searchProducts(t, r, "q=teapot")))
+	assert.Equal(t, 1, searchProducts(t, r, "q=test+product").Total)
+
+	_, err = database.DB.Exec("DELETE FROM orders")
+	assert.NoError(t, err)
+	_, err = database.DB.Exec("DELETE FROM products WHERE id = 1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, searchProducts(t, r, "q=teapot").Total)
+
+	if !database.ProductSearchFTS {
+		assert.ErrorIs(t, database.RebuildProductSearchIndex(), database.ErrSearchIndexUnavailable)
+		return
+	}
+
+	// A rebuild picks up rows changed behind the triggers' back
+	_, err = database.DB.Exec("DROP TRIGGER products_fts_insert")
+	assert.NoError(t, err)
+	_, err = database.DB.Exec("INSERT INTO products (id, name, description, price, stock, created_by) VALUES (9, 'Kettle', 'Steel', 10, 1, 1)")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, searchProducts(t, r, "q=kettle").Total)
+
+	assert.NoError(t, database.RebuildProductSearchIndex())
+	assert.Equal(t, []int{9}, resultIDs(searchProducts(t, r, "q=kettle")))
+}
+
+// Ranking, highlights and snippets need FTS5, which is only compiled in with
+// -tags sqlite_fts5. This fails when search fell back to LIKE matching.
+func TestProductHandler_SearchProducts_UsesFullTextIndex(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	if !database.ProductSearchFTS {
+		t.Fatal("product search fell back to LIKE matching, run the tests with -tags sqlite_fts5")
+	}
+
+	r := gin.New()
+	r.GET("/products/search", NewProductHandler().SearchProducts)
+
+	// Only the FTS5 tokenizer folds diacritics
+	_, err := database.DB.Exec("UPDATE products SET description = 'Torch for crème brûlée' WHERE id = 2")
+	assert.NoError(t, err)
+	response := searchProducts(t, r, "q=creme+brulee")
+	if assert.Equal(t, []int{2}, resultIDs(response)) {
+		assert.Contains(t, response.Results[0].DescriptionSnippet, "<mark>crème</mark> <mark>brûlée</mark>")
+	}
+}
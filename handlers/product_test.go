@@ -5,17 +5,25 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"smarapp-api/database"
 	"smarapp-api/models"
 	"smarapp-api/testutil"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
+// usd is a price in US cents
+func usd(cents int64) *models.Money {
+	return &models.Money{Amount: cents, Currency: "USD"}
+}
+
 func TestProductHandler_CreateProduct(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	cleanup := testutil.SetupTestDB(t)
+	cleanup := testutil.SetupTestDBWithData(t)
 	defer cleanup()
 
 	handler := NewProductHandler()
@@ -31,7 +39,7 @@ func TestProductHandler_CreateProduct(t *testing.T) {
 			requestBody: models.CreateProductRequest{
 				Name:        "Test Product",
 				Description: "Test Description",
-				Price:       99.99,
+				Price:       usd(9999),
 				Stock:       10,
 			},
 			userID:         1,
@@ -42,7 +50,7 @@ func TestProductHandler_CreateProduct(t *testing.T) {
 			requestBody: models.CreateProductRequest{
 				Name:        "",
 				Description: "Test Description",
-				Price:       99.99,
+				Price:       usd(9999),
 				Stock:       10,
 			},
 			userID:         1,
@@ -53,7 +61,7 @@ func TestProductHandler_CreateProduct(t *testing.T) {
 			requestBody: models.CreateProductRequest{
 				Name:        "Test Product",
 				Description: "Test Description",
-				Price:       0,
+				Price:       usd(0),
 				Stock:       10,
 			},
 			userID:         1,
@@ -64,7 +72,7 @@ func TestProductHandler_CreateProduct(t *testing.T) {
 			requestBody: models.CreateProductRequest{
 				Name:        "Test Product",
 				Description: "Test Description",
-				Price:       99.99,
+				Price:       usd(9999),
 				Stock:       -1,
 			},
 			userID:         1,
@@ -95,7 +103,7 @@ func TestProductHandler_CreateProduct(t *testing.T) {
 				assert.NoError(t, err)
 				assert.Equal(t, tt.requestBody.Name, product.Name)
 				assert.Equal(t, tt.requestBody.Description, product.Description)
-				assert.Equal(t, tt.requestBody.Price, product.Price)
+				assert.Equal(t, *tt.requestBody.Price, product.Price)
 				assert.Equal(t, tt.requestBody.Stock, product.Stock)
 				assert.Equal(t, tt.userID, product.CreatedBy)
 			}
@@ -119,10 +127,193 @@ func TestProductHandler_GetProducts(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	var products []models.Product
-	err := json.Unmarshal(w.Body.Bytes(), &products)
+	var response models.ProductListResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
-	assert.GreaterOrEqual(t, len(products), 2) // We have 2 test products
+	assert.GreaterOrEqual(t, len(response.Products), 2) // We have 2 test products
+	assert.Equal(t, len(response.Products), response.Total)
+	assert.Empty(t, response.NextCursor)
+}
+
+// listAllProducts follows next_cursor until the last page and returns the product IDs in order
+func listAllProducts(t *testing.T, r *gin.Engine, query string) ([]int, int) {
+	ids := []int{}
+	total := 0
+	cursor := ""
+	for pages := 0; pages < 20; pages++ {
+		path := "/products?" + query
+		if cursor != "" {
+			path += "&cursor=" + cursor
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+			return ids, total
+		}
+
+		var response models.ProductListResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		for _, product := range response.Products {
+			ids = append(ids, product.ID)
+		}
+		total = response.Total
+		if response.NextCursor == "" {
+			return ids, total
+		}
+		cursor = response.NextCursor
+	}
+	t.Fatal("pagination did not end")
+	return nil, 0
+}
+
+func TestProductHandler_GetProducts_Pagination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	_, err := database.DB.Exec("INSERT INTO users (id, username, email, password, role) VALUES (1, 'admin', 'admin@test.com', '', 'admin'), (2, 'other', 'other@test.com', '', 'admin')")
+	assert.NoError(t, err)
+
+	// Equal prices and creation times make sure ties are broken by ID
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	products := []struct {
+		name      string
+		price     int64 // In cents
+		stock     int
+		createdBy int
+		createdAt time.Time
+	}{
+		{"Lamp", 2000, 5, 1, base},
+		{"Chair", 5000, 0, 1, base},
+		{"Desk", 12000, 2, 2, base.Add(time.Hour)},
+		{"Mug", 850, 40, 1, base.Add(2 * time.Hour)},
+		{"Shelf", 5000, 1, 2, base.Add(3 * time.Hour)},
+		{"Rug", 5000, 0, 1, base.Add(3 * time.Hour)},
+		{"Vase", 1500, 7, 2, base.Add(4 * time.Hour)},
+	}
+	for i, p := range products {
+		_, err := database.DB.Exec(
+			"INSERT INTO products (id, name, description, price, stock, created_by, created_at, updated_at) VALUES (?, ?, 'Test', ?, ?, ?, ?, ?)",
+			i+1, p.name, p.price, p.stock, p.createdBy, p.createdAt, p.createdAt,
+		)
+		assert.NoError(t, err)
+	}
+
+	r := gin.New()
+	r.GET("/products", NewProductHandler().GetProducts)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []int
+	}{
+		{"newest first by default", "limit=2", []int{7, 6, 5, 4, 3, 2, 1}},
+		{"price ascending", "limit=2&sort=price", []int{4, 7, 1, 2, 5, 6, 3}},
+		{"price descending", "limit=3&sort=-price", []int{3, 6, 5, 2, 1, 7, 4}},
+		{"name", "limit=4&sort=name", []int{2, 3, 1, 4, 6, 5, 7}},
+		{"price range", "limit=1&sort=price&min_price=15&max_price=50", []int{7, 1, 2, 5, 6}},
+		{"in stock only", "limit=2&sort=-stock&in_stock=true", []int{4, 7, 1, 3, 5}},
+		{"by creator", "limit=2&created_by=2", []int{7, 5, 3}},
+		{"single page", "limit=100", []int{7, 6, 5, 4, 3, 2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, total := listAllProducts(t, r, tt.query)
+			assert.Equal(t, tt.expected, ids)
+			assert.Equal(t, len(tt.expected), total)
+		})
+	}
+
+	// A page that ends exactly at the last product has no next cursor
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/products?limit=7", nil))
+	var response models.ProductListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Products, 7)
+	assert.Empty(t, response.NextCursor)
+
+	// Cursors only work with the sort they were created for
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/products?limit=2&sort=price", nil))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotEmpty(t, response.NextCursor)
+
+	for _, query := range []string{
+		"limit=0", "limit=101", "limit=abc", "sort=description", "sort=-id",
+		"min_price=cheap", "max_price=-1", "in_stock=maybe", "created_by=me",
+		"cursor=not-a-cursor", "sort=-price&cursor=" + response.NextCursor,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/products?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestProductHandler_Currencies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	handler := NewProductHandler()
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", 1)
+		c.Next()
+	})
+	r.POST("/products", handler.CreateProduct)
+	r.GET("/products", handler.GetProducts)
+
+	for _, tt := range []struct {
+		price  string
+		status int
+	}{
+		{`{"amount": "1500", "currency": "JPY"}`, http.StatusCreated},
+		{`{"amount": 15.5, "currency": "JPY"}`, http.StatusBadRequest},
+		{`{"amount": "15.50", "currency": "XXY"}`, http.StatusBadRequest},
+		{`{"amount": "15.50"}`, http.StatusBadRequest},
+		{`15.50`, http.StatusBadRequest},
+		{`{"amount": "-1", "currency": "EUR"}`, http.StatusBadRequest},
+	} {
+		body := `{"name": "Teapot", "description": "Cast iron", "stock": 1, "price": ` + tt.price + `}`
+		req := httptest.NewRequest("POST", "/products", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, tt.status, w.Code, tt.price)
+		if tt.status == http.StatusCreated {
+			assert.Contains(t, w.Body.String(), `"price":{"amount":"1500","currency":"JPY"}`)
+		}
+	}
+
+	// Price bounds are read in the requested currency, US dollars by default
+	for _, tt := range []struct {
+		query    string
+		expected []int
+	}{
+		{"currency=JPY", []int{3}},
+		{"currency=JPY&min_price=1000", []int{3}},
+		{"min_price=1000", []int{}},
+		{"max_price=100", []int{1}},
+		{"", []int{3, 2, 1}},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/products?sort=-created_at&"+tt.query, nil))
+		assert.Equal(t, http.StatusOK, w.Code, tt.query)
+		var response models.ProductListResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		ids := []int{}
+		for _, product := range response.Products {
+			ids = append(ids, product.ID)
+		}
+		assert.Equal(t, tt.expected, ids, tt.query)
+	}
+
+	for _, query := range []string{"currency=usd", "min_price=1.005", "currency=JPY&max_price=10.5"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/products?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
 }
 
 func TestProductHandler_GetProduct(t *testing.T) {
@@ -170,7 +361,7 @@ func TestProductHandler_GetProduct(t *testing.T) {
 				err := json.Unmarshal(w.Body.Bytes(), &product)
 				assert.NoError(t, err)
 				assert.NotEmpty(t, product.Name)
-				assert.Greater(t, product.Price, 0.0)
+				assert.Greater(t, product.Price.Amount, int64(0))
 			}
 		})
 	}
@@ -186,48 +377,46 @@ func TestProductHandler_UpdateProduct(t *testing.T) {
 	tests := []struct {
 		name           string
 		productID      string
-		requestBody    models.UpdateProductRequest
+		requestBody    string
 		expectedStatus int
+		expected       models.Product
 	}{
 		{
-			name:      "valid update",
-			productID: "1",
-			requestBody: models.UpdateProductRequest{
-				Name:  "Updated Product",
-				Price: 149.99,
-			},
+			name:           "valid replacement",
+			productID:      "1",
+			requestBody:    `{"name": "Updated Product", "description": "Updated Description", "price": {"amount": "149.99", "currency": "USD"}, "stock": 0}`,
 			expectedStatus: http.StatusOK,
+			expected:       models.Product{Name: "Updated Product", Description: "Updated Description", Price: *usd(14999), Stock: 0},
 		},
 		{
-			name:      "partial update",
-			productID: "1",
-			requestBody: models.UpdateProductRequest{
-				Stock: 20,
-			},
-			expectedStatus: http.StatusOK,
+			name:           "missing stock",
+			productID:      "1",
+			requestBody:    `{"name": "Updated Product", "description": "Updated Description", "price": {"amount": "149.99", "currency": "USD"}}`,
+			expectedStatus: http.StatusBadRequest,
 		},
 		{
-			name:      "invalid product ID",
-			productID: "abc",
-			requestBody: models.UpdateProductRequest{
-				Name: "Updated Product",
-			},
+			name:           "partial body",
+			productID:      "1",
+			requestBody:    `{"price": {"amount": "149.99", "currency": "USD"}}`,
 			expectedStatus: http.StatusBadRequest,
 		},
 		{
-			name:      "non-existent product",
-			productID: "999",
-			requestBody: models.UpdateProductRequest{
-				Name: "Updated Product",
-			},
+			name:           "invalid product ID",
+			productID:      "abc",
+			requestBody:    `{"name": "Updated Product", "description": "Updated Description", "price": {"amount": "149.99", "currency": "USD"}, "stock": 1}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "non-existent product",
+			productID:      "999",
+			requestBody:    `{"name": "Updated Product", "description": "Updated Description", "price": {"amount": "149.99", "currency": "USD"}, "stock": 1}`,
 			expectedStatus: http.StatusNotFound,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			jsonBody, _ := json.Marshal(tt.requestBody)
-			req := httptest.NewRequest("PUT", "/products/"+tt.productID, bytes.NewBuffer(jsonBody))
+			req := httptest.NewRequest("PUT", "/products/"+tt.productID, strings.NewReader(tt.requestBody))
 			req.Header.Set("Content-Type", "application/json")
 			w := httptest.NewRecorder()
 
@@ -241,16 +430,116 @@ func TestProductHandler_UpdateProduct(t *testing.T) {
 				var product models.Product
 				err := json.Unmarshal(w.Body.Bytes(), &product)
 				assert.NoError(t, err)
-				
-				if tt.requestBody.Name != "" {
-					assert.Equal(t, tt.requestBody.Name, product.Name)
-				}
-				if tt.requestBody.Price > 0 {
-					assert.Equal(t, tt.requestBody.Price, product.Price)
-				}
-				if tt.requestBody.Stock >= 0 {
-					assert.Equal(t, tt.requestBody.Stock, product.Stock)
-				}
+				assert.Equal(t, tt.expected.Name, product.Name)
+				assert.Equal(t, tt.expected.Description, product.Description)
+				assert.Equal(t, tt.expected.Price, product.Price)
+				assert.Equal(t, tt.expected.Stock, product.Stock)
+			}
+		})
+	}
+}
+
+func TestProductHandler_PatchProduct(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	handler := NewProductHandler()
+
+	// Each case patches the result of the previous ones
+	tests := []struct {
+		name           string
+		productID      string
+		requestBody    string
+		expectedStatus int
+		expected       models.Product
+	}{
+		{
+			name:           "valid update",
+			productID:      "1",
+			requestBody:    `{"name": "Updated Product", "price": {"amount": "149.99", "currency": "USD"}}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.Product{Name: "Updated Product", Description: "Test Description 1", Price: *usd(14999), Stock: 10},
+		},
+		{
+			name:           "omitted stock is kept",
+			productID:      "1",
+			requestBody:    `{"description": "Updated Description"}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.Product{Name: "Updated Product", Description: "Updated Description", Price: *usd(14999), Stock: 10},
+		},
+		{
+			name:           "stock set to zero",
+			productID:      "1",
+			requestBody:    `{"stock": 0}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.Product{Name: "Updated Product", Description: "Updated Description", Price: *usd(14999), Stock: 0},
+		},
+		{
+			name:           "empty patch",
+			productID:      "1",
+			requestBody:    `{}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.Product{Name: "Updated Product", Description: "Updated Description", Price: *usd(14999), Stock: 0},
+		},
+		{
+			name:           "null field",
+			productID:      "1",
+			requestBody:    `{"name": null}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "blank name",
+			productID:      "1",
+			requestBody:    `{"name": ""}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid value",
+			productID:      "1",
+			requestBody:    `{"price": {"amount": "0", "currency": "USD"}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "not an object",
+			productID:      "1",
+			requestBody:    `[{"name": "Updated Product"}]`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid product ID",
+			productID:      "abc",
+			requestBody:    `{"name": "Updated Product"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "non-existent product",
+			productID:      "999",
+			requestBody:    `{"name": "Updated Product"}`,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PATCH", "/products/"+tt.productID, strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/merge-patch+json")
+			w := httptest.NewRecorder()
+
+			r := gin.New()
+			r.PATCH("/products/:id", handler.PatchProduct)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+
+			if tt.expectedStatus == http.StatusOK {
+				var product models.Product
+				err := json.Unmarshal(w.Body.Bytes(), &product)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected.Name, product.Name)
+				assert.Equal(t, tt.expected.Description, product.Description)
+				assert.Equal(t, tt.expected.Price, product.Price)
+				assert.Equal(t, tt.expected.Stock, product.Stock)
 			}
 		})
 	}
@@ -273,6 +562,11 @@ func TestProductHandler_DeleteProduct(t *testing.T) {
 			productID:      "1",
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:           "already deleted",
+			productID:      "1",
+			expectedStatus: http.StatusNotFound,
+		},
 		{
 			name:           "invalid product ID",
 			productID:      "abc",
@@ -302,3 +596,120 @@ func TestProductHandler_DeleteProduct(t *testing.T) {
 		})
 	}
 }
+
+func TestProductHandler_Trash(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	jwtSecret := "test-secret"
+	productHandler := NewProductHandler()
+	tagHandler := NewTagHandler()
+	orderHandler := NewOrderHandler()
+
+	router := newTestRouter(jwtSecret)
+	router.GET("/products", productHandler.GetProducts)
+	router.GET("/products/search", productHandler.SearchProducts)
+	router.GET("/products/:id", productHandler.GetProduct)
+	router.GET("/tags", tagHandler.ListTags)
+	router.Protected.POST("/orders", orderHandler.CreateOrder)
+	router.Protected.GET("/orders/:id", orderHandler.GetOrder)
+	admin := router.Require("/", models.PermissionProductsWrite)
+	admin.PATCH("/products/:id", productHandler.PatchProduct)
+	admin.DELETE("/products/:id", productHandler.DeleteProduct)
+	admin.POST("/admin/products/:id/restore", productHandler.RestoreProduct)
+	r := router.Engine
+
+	adminToken, userToken := seedTokens(t, jwtSecret)
+
+	w := performJSON(r, "PATCH", "/products/1", adminToken, models.PatchProductRequest{Tags: []string{"sale"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performJSON(r, "DELETE", "/products/1", adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Deleted products are gone from the catalog
+	w = performJSON(r, "GET", "/products/1", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = performJSON(r, "GET", "/products", "", nil)
+	var list models.ProductListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, 1, list.Total)
+	if assert.Len(t, list.Products, 1) {
+		assert.Equal(t, 2, list.Products[0].ID)
+	}
+	w = performJSON(r, "GET", "/products/search?q=Test", "", nil)
+	var search models.ProductSearchResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &search))
+	assert.Equal(t, 1, search.Total)
+	w = performJSON(r, "GET", "/tags", "", nil)
+	var tags []models.Tag
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tags))
+	if assert.Len(t, tags, 1) {
+		assert.Equal(t, 0, tags[0].Products)
+	}
+
+	// They cannot be ordered or changed, but their orders stay
+	w = performJSON(r, "POST", "/orders", userToken, models.CreateOrderRequest{ProductID: 1, Quantity: 1})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = performJSON(r, "PATCH", "/products/1", adminToken, models.PatchProductRequest{Name: stringPtr("Renamed")})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = performJSON(r, "GET", "/orders/1", userToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Test Product 1")
+
+	// Restoring brings the product back as it was
+	w = performJSON(r, "POST", "/admin/products/1/restore", userToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = performJSON(r, "POST", "/admin/products/1/restore", adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var restored models.Product
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &restored))
+	assert.Nil(t, restored.DeletedAt)
+	assert.Equal(t, []string{"sale"}, restored.Tags)
+	assert.Equal(t, versionETag(restored.Version), w.Header().Get("ETag"))
+	w = performJSON(r, "GET", "/products/1", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	for _, tt := range []struct {
+		path   string
+		status int
+	}{
+		{"/admin/products/1/restore", http.StatusConflict},
+		{"/admin/products/999/restore", http.StatusNotFound},
+		{"/admin/products/abc/restore", http.StatusBadRequest},
+	} {
+		w = performJSON(r, "POST", tt.path, adminToken, nil)
+		assert.Equal(t, tt.status, w.Code, tt.path)
+	}
+
+	// Purging skips recent deletions and products with orders
+	for _, path := range []string{"/products/1", "/products/2"} {
+		w = performJSON(r, "DELETE", path, adminToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	purged, err := productHandler.PurgeDeletedProducts(time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, purged)
+	purged, err = productHandler.PurgeDeletedProducts(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	var ids []int
+	rows, err := database.DB.Query("SELECT id FROM products ORDER BY id")
+	assert.NoError(t, err)
+	for rows.Next() {
+		var id int
+		assert.NoError(t, rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	rows.Close()
+	assert.Equal(t, []int{1}, ids)
+
+	var purgeEvents int
+	err = database.DB.QueryRow("SELECT COUNT(*) FROM audit_events WHERE action = 'product.purge' AND target_id = '2'").Scan(&purgeEvents)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purgeEvents)
+
+	w = performJSON(r, "POST", "/admin/products/2/restore", adminToken, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
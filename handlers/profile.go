@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateProfile godoc
+// @Summary Update user profile
+// @Description Change the username and/or email of the authenticated user
+// @Tags Profile
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param profile body models.UpdateProfileRequest true "Fields to change"
+// @Success 200 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /profile [patch]
+func (h *AuthHandler) UpdateProfile(c *gin.Context) {
+	var req models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	user, err := scanUser(tx.QueryRow(
+		"SELECT "+userColumns+" FROM users WHERE id = ? AND deleted_at IS NULL",
+		userID,
+	))
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	before := user
+	usernameChanged := req.Username != nil && *req.Username != user.Username
+	emailChanged := req.Email != nil && *req.Email != user.Email
+
+	if usernameChanged {
+		user.Username = *req.Username
+	}
+	if emailChanged {
+		// A new address has to be verified again
+		user.Email = *req.Email
+		user.EmailVerifiedAt = nil
+	}
+
+	// Same uniqueness rules as Register, ignoring the user's own row
+	var existingID int
+	err = tx.QueryRow(
+		"SELECT id FROM users WHERE (email = ? OR username = ?) AND id != ?",
+		user.Email, user.Username, user.ID,
+	).Scan(&existingID)
+	if err != sql.ErrNoRows {
+		c.JSON(http.StatusConflict, gin.H{"error": "User with this email or username already exists"})
+		return
+	}
+
+	user.UpdatedAt = time.Now()
+	_, err = tx.Exec(
+		"UPDATE users SET username = ?, email = ?, email_verified_at = ?, updated_at = ? WHERE id = ?",
+		user.Username, user.Email, user.EmailVerifiedAt, user.UpdatedAt, user.ID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	// Chat messages store the username, keep them in sync
+	if usernameChanged {
+		if _, err := tx.Exec("UPDATE chat_messages SET username = ? WHERE user_id = ?", user.Username, user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update chat messages"})
+			return
+		}
+	}
+
+	if err := recordAudit(c, tx, "user.update", auditTargetUser, user.ID, before, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	if emailChanged {
+		h.trySendVerificationEmail(user.ID, user.Email)
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Change the password of the authenticated user. All existing tokens are invalidated and a new token pair is returned.
+// @Tags Profile
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param password body models.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} models.LoginResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /profile/password [post]
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	var user models.User
+	var hashedPassword string
+	err := database.DB.QueryRow(
+		"SELECT id, username, email, password, role, created_at, updated_at FROM users WHERE id = ? AND deleted_at IS NULL",
+		userID,
+	).Scan(&user.ID, &user.Username, &user.Email, &hashedPassword, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if !h.Passwords.Verify(hashedPassword, req.CurrentPassword) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	if err := h.PasswordPolicy.Check(req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	newHash, err := h.Passwords.Hash(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := setPasswordAndRevokeTokens(tx, user.ID, newHash); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "user.password_change", auditTargetUser, user.ID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	// The new session keeps the two-factor status of the current one
+	response, err := h.issueTokens(c, user, c.GetBool("mfa"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteProfile godoc
+// @Summary Delete own account
+// @Description Delete the authenticated user's account. Chat messages are anonymized and order history is kept for accounting.
+// @Tags Profile
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param confirmation body models.DeleteAccountRequest true "Current password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /profile [delete]
+func (h *AuthHandler) DeleteProfile(c *gin.Context) {
+	var req models.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	var hashedPassword string
+	err := database.DB.QueryRow("SELECT password FROM users WHERE id = ? AND deleted_at IS NULL", userID).Scan(&hashedPassword)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if !h.Passwords.Verify(hashedPassword, req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := scanUser(tx.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := anonymizeUser(tx, userID.(int)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "user.delete", auditTargetUser, before.ID, before, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
+}
+
+// setPasswordAndRevokeTokens stores a new password hash and invalidates every
+// access and refresh token issued so far
+func setPasswordAndRevokeTokens(tx *sql.Tx, userID int, hashedPassword string) error {
+	// JWT issued-at times have second precision, so new tokens issued in the
+	// same second must still be accepted
+	now := time.Now()
+	_, err := tx.Exec(
+		"UPDATE users SET password = ?, tokens_valid_after = ?, updated_at = ? WHERE id = ?",
+		hashedPassword, now.Truncate(time.Second), now, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return revokeUserSessions(tx, userID)
+}
+
+// rehashPassword replaces an outdated password hash after a successful
+// login. The hash is only replaced if the password did not change in the
+// meantime; failures are logged since the old hash keeps working.
+func (h *AuthHandler) rehashPassword(userID int, oldHash, plain string) {
+	newHash, err := h.Passwords.Hash(plain)
+	if err == nil {
+		_, err = database.DB.Exec("UPDATE users SET password = ? WHERE id = ? AND password = ?", newHash, userID, oldHash)
+	}
+	if err != nil {
+		log.Printf("Failed to rehash password of user %d: %v", userID, err)
+	}
+}
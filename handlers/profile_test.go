@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"smarapp-api/testutil"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newProfileRouter wires the profile routes behind the real auth middleware
+func newProfileRouter(handler *AuthHandler) *gin.Engine {
+	r := newTestRouter(handler.JWTSecret)
+	r.POST("/refresh", handler.Refresh)
+	r.Protected.GET("/profile", handler.GetProfile)
+	r.Protected.PATCH("/profile", handler.UpdateProfile)
+	r.Protected.DELETE("/profile", handler.DeleteProfile)
+	r.Protected.POST("/profile/password", handler.ChangePassword)
+	r.Protected.POST("/profile/verify-email", handler.ResendVerification)
+	return r.Engine
+}
+
+func performJSON(r *gin.Engine, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestAuthHandler_UpdateProfile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+	r := newProfileRouter(handler)
+
+	registered := registerTestUser(t, handler, models.RegisterRequest{
+		Username: "testuser",
+		Email:    "test@test.com",
+		Password: "password123",
+	})
+	registerTestUser(t, handler, models.RegisterRequest{
+		Username: "otheruser",
+		Email:    "other@test.com",
+		Password: "password123",
+	})
+
+	_, err := database.DB.Exec(
+		"INSERT INTO chat_messages (user_id, username, message) VALUES (?, 'testuser', 'hello')",
+		registered.User.ID,
+	)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name             string
+		requestBody      models.UpdateProfileRequest
+		expectedStatus   int
+		expectedUsername string
+		expectedEmail    string
+	}{
+		{
+			name:             "change username",
+			requestBody:      models.UpdateProfileRequest{Username: stringPtr("renamed")},
+			expectedStatus:   http.StatusOK,
+			expectedUsername: "renamed",
+			expectedEmail:    "test@test.com",
+		},
+		{
+			name:             "change email",
+			requestBody:      models.UpdateProfileRequest{Email: stringPtr("new@test.com")},
+			expectedStatus:   http.StatusOK,
+			expectedUsername: "renamed",
+			expectedEmail:    "new@test.com",
+		},
+		{
+			name:           "username taken",
+			requestBody:    models.UpdateProfileRequest{Username: stringPtr("otheruser")},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "email taken",
+			requestBody:    models.UpdateProfileRequest{Email: stringPtr("other@test.com")},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "invalid email",
+			requestBody:    models.UpdateProfileRequest{Email: stringPtr("invalid-email")},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "short username",
+			requestBody:    models.UpdateProfileRequest{Username: stringPtr("ab")},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := performJSON(r, "PATCH", "/profile", registered.Token, tt.requestBody)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedStatus == http.StatusOK {
+				var user models.User
+				err := json.Unmarshal(w.Body.Bytes(), &user)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedUsername, user.Username)
+				assert.Equal(t, tt.expectedEmail, user.Email)
+			}
+		})
+	}
+
+	// Denormalized chat usernames follow the rename
+	var chatUsername string
+	err = database.DB.QueryRow("SELECT username FROM chat_messages WHERE user_id = ?", registered.User.ID).Scan(&chatUsername)
+	assert.NoError(t, err)
+	assert.Equal(t, "renamed", chatUsername)
+}
+
+func TestAuthHandler_ChangePassword(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+	r := newProfileRouter(handler)
+
+	registered := registerTestUser(t, handler, models.RegisterRequest{
+		Username: "testuser",
+		Email:    "test@test.com",
+		Password: "password123",
+	})
+
+	// Wrong current password
+	w := performJSON(r, "POST", "/profile/password", registered.Token, models.ChangePasswordRequest{
+		CurrentPassword: "wrongpassword",
+		NewPassword:     "newpassword123",
+	})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Make sure the new tokens are issued in a later second than the old ones
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	w = performJSON(r, "POST", "/profile/password", registered.Token, models.ChangePasswordRequest{
+		CurrentPassword: "password123",
+		NewPassword:     "newpassword123",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.LoginResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, response.Token)
+
+	// Old access and refresh tokens are invalidated
+	w = performJSON(r, "GET", "/profile", registered.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performJSON(r, "POST", "/refresh", "", models.RefreshRequest{RefreshToken: registered.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// The new token works
+	w = performJSON(r, "GET", "/profile", response.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The new password works for login
+	loginRouter := gin.New()
+	loginRouter.POST("/login", handler.Login)
+	w = performJSON(loginRouter, "POST", "/login", "", models.LoginRequest{Email: "test@test.com", Password: "newpassword123"})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAuthHandler_DeleteProfile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+	r := newProfileRouter(handler)
+
+	registered := registerTestUser(t, handler, models.RegisterRequest{
+		Username: "testuser",
+		Email:    "test@test.com",
+		Password: "password123",
+	})
+	userID := registered.User.ID
+
+	_, err := database.DB.Exec("INSERT INTO chat_messages (user_id, username, message) VALUES (?, 'testuser', 'hello')", userID)
+	assert.NoError(t, err)
+	_, err = database.DB.Exec(
+		"INSERT INTO orders (user_id, product_id, quantity, price, total, status) VALUES (?, 1, 1, 99.99, 99.99, 'completed')",
+		userID,
+	)
+	assert.NoError(t, err)
+
+	// The password must be confirmed
+	w := performJSON(r, "DELETE", "/profile", registered.Token, models.DeleteAccountRequest{Password: "wrongpassword"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performJSON(r, "DELETE", "/profile", registered.Token, models.DeleteAccountRequest{Password: "password123"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "deleted successfully")
+
+	// Chat messages are anonymized, orders kept
+	var chatUsername string
+	var orders int
+	assert.NoError(t, database.DB.QueryRow("SELECT username FROM chat_messages WHERE user_id = ?", userID).Scan(&chatUsername))
+	assert.NoError(t, database.DB.QueryRow("SELECT COUNT(*) FROM orders WHERE user_id = ?", userID).Scan(&orders))
+	assert.Equal(t, deletedChatUsername, chatUsername)
+	assert.Equal(t, 1, orders)
+
+	// The account can no longer be used and its email is free again
+	w = performJSON(r, "GET", "/profile", registered.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, 0, countUsersByEmail(t, "test@test.com"))
+}
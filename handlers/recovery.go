@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"smarapp-api/database"
+	"smarapp-api/mailer"
+	"smarapp-api/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Send a password reset email. The response is the same whether or not an account exists for the email.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body models.ForgotPasswordRequest true "Account email"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/forgot-password [post]
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var userID int
+	var email string
+	err := database.DB.QueryRow(
+		"SELECT id, email FROM users WHERE email = ? AND deleted_at IS NULL AND suspended_at IS NULL",
+		req.Email,
+	).Scan(&userID, &email)
+
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err == nil {
+		if err := h.sendPasswordResetEmail(userID, email); err != nil {
+			// Not reported to the client, it would reveal that the account exists
+			log.Printf("Failed to send password reset email to user %d: %v", userID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If an account exists for this email, a password reset link has been sent"})
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password using a token from a password reset email. All existing tokens are invalidated.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body models.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/reset-password [post]
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, userID, err := h.parseAccountToken(req.Token, purposePasswordReset)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	if err := h.PasswordPolicy.Check(req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := h.Passwords.Hash(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := consumeAccountToken(tx, claims.ID, purposePasswordReset); err == errInvalidAccountToken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// The token is only valid for the address it was sent to
+	var currentEmail string
+	err = tx.QueryRow(
+		"SELECT email FROM users WHERE id = ? AND deleted_at IS NULL AND suspended_at IS NULL",
+		userID,
+	).Scan(&currentEmail)
+	if err == sql.ErrNoRows || (err == nil && currentEmail != claims.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := setPasswordAndRevokeTokens(tx, userID, hashedPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	// Receiving the reset email proves ownership of the address
+	if _, err := tx.Exec("UPDATE users SET email_verified_at = ? WHERE id = ? AND email_verified_at IS NULL", time.Now(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "user.password_reset", auditTargetUser, userID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
+
+// VerifyEmail godoc
+// @Summary Verify email address
+// @Description Confirm the email address of an account using the token from a verification email
+// @Tags Authentication
+// @Produce json
+// @Param token query string true "Verification token"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/verify-email [get]
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	claims, userID, err := h.parseAccountToken(c.Query("token"), purposeEmailVerification)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := consumeAccountToken(tx, claims.ID, purposeEmailVerification); err == errInvalidAccountToken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	now := time.Now()
+	result, err := tx.Exec(
+		"UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?), updated_at = ? WHERE id = ? AND email = ? AND deleted_at IS NULL",
+		now, now, userID, claims.Email,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "user.email_verify", auditTargetUser, userID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerification godoc
+// @Summary Resend verification email
+// @Description Send a new verification email to the authenticated user's address
+// @Tags Profile
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /profile/verify-email [post]
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	user, err := fetchUser(userID.(int))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email already verified"})
+		return
+	}
+
+	if err := h.sendVerificationEmail(user.ID, user.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent successfully"})
+}
+
+func (h *AuthHandler) sendPasswordResetEmail(userID int, email string) error {
+	token, err := h.issueAccountToken(userID, email, purposePasswordReset, h.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf(
+		"Someone requested a password reset for your account.\n\nReset token: %s\n\nThe token expires in %s. If you did not request a reset, you can ignore this email.\n",
+		token, h.PasswordResetTTL,
+	)
+	if h.PasswordResetURL != "" {
+		body = fmt.Sprintf(
+			"Someone requested a password reset for your account.\n\nChoose a new password here: %s\n\nThe link expires in %s. If you did not request a reset, you can ignore this email.\n",
+			withTokenParam(h.PasswordResetURL, token), h.PasswordResetTTL,
+		)
+	}
+
+	return h.sendMail(mailer.Message{To: email, Subject: "Reset your password", Body: body})
+}
+
+func (h *AuthHandler) sendVerificationEmail(userID int, email string) error {
+	token, err := h.issueAccountToken(userID, email, purposeEmailVerification, h.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := withTokenParam(strings.TrimRight(h.PublicURL, "/")+"/api/v1/auth/verify-email", token)
+	body := fmt.Sprintf(
+		"Please confirm your email address by opening this link:\n\n%s\n\nThe link expires in %s.\n",
+		link, h.EmailVerificationTTL,
+	)
+
+	return h.sendMail(mailer.Message{To: email, Subject: "Verify your email address", Body: body})
+}
+
+// trySendVerificationEmail is used after registration and email changes,
+// where a delivery failure must not fail the request itself
+func (h *AuthHandler) trySendVerificationEmail(userID int, email string) {
+	if err := h.sendVerificationEmail(userID, email); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", userID, err)
+	}
+}
+
+func (h *AuthHandler) sendMail(msg mailer.Message) error {
+	if h.Mailer == nil {
+		return nil
+	}
+	return h.Mailer.Send(msg)
+}
+
+func withTokenParam(base, token string) string {
+	separator := "?"
+	if strings.Contains(base, "?") {
+		separator = "&"
+	}
+	return base + separator + "token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"smarapp-api/database"
+	"smarapp-api/mailer"
+	"smarapp-api/models"
+	"smarapp-api/testutil"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var tokenInEmail = regexp.MustCompile(`(?:token=|Reset token: )([A-Za-z0-9_\-.%]+)`)
+
+// tokenFromEmail extracts the token from the last email sent to the address
+func tokenFromEmail(t *testing.T, m *mailer.MemoryMailer, to string) string {
+	msg, found := m.Last(to)
+	if !found {
+		t.Fatalf("no email sent to %s", to)
+	}
+
+	match := tokenInEmail.FindStringSubmatch(msg.Body)
+	if match == nil {
+		t.Fatalf("no token in email: %s", msg.Body)
+	}
+
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatalf("invalid token in email: %v", err)
+	}
+	return token
+}
+
+func newRecoveryRouter(handler *AuthHandler) *gin.Engine {
+	r := newProfileRouter(handler)
+	r.POST("/login", handler.Login)
+	r.POST("/forgot-password", handler.ForgotPassword)
+	r.POST("/reset-password", handler.ResetPassword)
+	r.GET("/verify-email", handler.VerifyEmail)
+	return r
+}
+
+func TestAuthHandler_PasswordReset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	m := mailer.NewMemoryMailer()
+	handler := NewAuthHandler("test-secret")
+	handler.Mailer = m
+	r := newRecoveryRouter(handler)
+
+	registered := registerTestUser(t, handler, models.RegisterRequest{
+		Username: "testuser",
+		Email:    "test@test.com",
+		Password: "password123",
+	})
+
+	// Unknown emails get the same response and no email
+	sent := len(m.Messages())
+	w := performJSON(r, "POST", "/forgot-password", "", models.ForgotPasswordRequest{Email: "unknown@test.com"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, m.Messages(), sent)
+
+	w = performJSON(r, "POST", "/forgot-password", "", models.ForgotPasswordRequest{Email: "test@test.com"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	firstToken := tokenFromEmail(t, m, "test@test.com")
+
+	// Requesting a new reset invalidates the previous token
+	w = performJSON(r, "POST", "/forgot-password", "", models.ForgotPasswordRequest{Email: "test@test.com"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	token := tokenFromEmail(t, m, "test@test.com")
+	assert.NotEqual(t, firstToken, token)
+
+	w = performJSON(r, "POST", "/reset-password", "", models.ResetPasswordRequest{Token: firstToken, NewPassword: "newpassword123"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// A verification token cannot be used as a reset token
+	verificationToken, err := handler.issueAccountToken(registered.User.ID, "test@test.com", purposeEmailVerification, time.Hour)
+	assert.NoError(t, err)
+	w = performJSON(r, "POST", "/reset-password", "", models.ResetPasswordRequest{Token: verificationToken, NewPassword: "newpassword123"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Make sure tokens issued before the reset fall in an earlier second
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	w = performJSON(r, "POST", "/reset-password", "", models.ResetPasswordRequest{Token: token, NewPassword: "newpassword123"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Tokens are single-use
+	w = performJSON(r, "POST", "/reset-password", "", models.ResetPasswordRequest{Token: token, NewPassword: "otherpassword123"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Existing sessions are revoked and the new password works
+	w = performJSON(r, "GET", "/profile", registered.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performJSON(r, "POST", "/login", "", models.LoginRequest{Email: "test@test.com", Password: "password123"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performJSON(r, "POST", "/login", "", models.LoginRequest{Email: "test@test.com", Password: "newpassword123"})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAuthHandler_ResetPassword_ExpiredToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+	r := newRecoveryRouter(handler)
+
+	token, err := handler.issueAccountToken(2, "user@test.com", purposePasswordReset, -time.Minute)
+	assert.NoError(t, err)
+
+	w := performJSON(r, "POST", "/reset-password", "", models.ResetPasswordRequest{Token: token, NewPassword: "newpassword123"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performJSON(r, "POST", "/reset-password", "", models.ResetPasswordRequest{Token: "not-a-token", NewPassword: "newpassword123"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAuthHandler_VerifyEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	m := mailer.NewMemoryMailer()
+	handler := NewAuthHandler("test-secret")
+	handler.Mailer = m
+	r := newRecoveryRouter(handler)
+
+	registered := registerTestUser(t, handler, models.RegisterRequest{
+		Username: "testuser",
+		Email:    "test@test.com",
+		Password: "password123",
+	})
+	assert.Nil(t, registered.User.EmailVerifiedAt)
+
+	// Registration sends a verification email
+	token := tokenFromEmail(t, m, "test@test.com")
+
+	w := performJSON(r, "GET", "/verify-email?token="+url.QueryEscape(token), "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "verified successfully")
+
+	w = performJSON(r, "GET", "/verify-email?token="+url.QueryEscape(token), "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	user, err := fetchUser(registered.User.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, user.EmailVerifiedAt)
+
+	// Changing the email resets verification and sends a new email
+	w = performJSON(r, "PATCH", "/profile", registered.Token, models.UpdateProfileRequest{Email: stringPtr("new@test.com")})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	user, err = fetchUser(registered.User.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, user.EmailVerifiedAt)
+
+	newToken := tokenFromEmail(t, m, "new@test.com")
+
+	// A token sent to the old address no longer verifies the account
+	oldAddressToken, err := handler.issueAccountToken(registered.User.ID, "test@test.com", purposeEmailVerification, time.Hour)
+	assert.NoError(t, err)
+	w = performJSON(r, "GET", "/verify-email?token="+url.QueryEscape(oldAddressToken), "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Issuing the token above invalidated the one sent by PATCH /profile
+	w = performJSON(r, "GET", "/verify-email?token="+url.QueryEscape(newToken), "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performJSON(r, "POST", "/profile/verify-email", registered.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performJSON(r, "GET", "/verify-email?token="+url.QueryEscape(tokenFromEmail(t, m, "new@test.com")), "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Already verified
+	w = performJSON(r, "POST", "/profile/verify-email", registered.Token, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestOrderHandler_CreateOrder_RequireVerifiedEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	handler := NewOrderHandler()
+	handler.RequireVerifiedEmail = true
+
+	r := gin.New()
+	r.POST("/orders", func(c *gin.Context) {
+		c.Set("user_id", 2)
+		handler.CreateOrder(c)
+	})
+
+	order := models.CreateOrderRequest{ProductID: 1, Quantity: 1}
+
+	w := performJSON(r, "POST", "/orders", "", order)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	_, err := database.DB.Exec("UPDATE users SET email_verified_at = ? WHERE id = 2", time.Now())
+	assert.NoError(t, err)
+
+	w = performJSON(r, "POST", "/orders", "", order)
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
@@ -0,0 +1,407 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/middleware"
+	"smarapp-api/models"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleHandler struct{}
+
+func NewRoleHandler() *RoleHandler {
+	return &RoleHandler{}
+}
+
+// ListPermissions godoc
+// @Summary List permissions (Admin only)
+// @Description Get every permission that can be granted to a role
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /admin/permissions [get]
+func (h *RoleHandler) ListPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, models.AllPermissions)
+}
+
+// ListRoles godoc
+// @Summary List roles (Admin only)
+// @Description Get all roles with their permissions
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.RoleDefinition
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/roles [get]
+func (h *RoleHandler) ListRoles(c *gin.Context) {
+	rows, err := database.DB.Query("SELECT name, description, built_in, created_at, updated_at FROM roles ORDER BY built_in DESC, name")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+
+	roles := []models.RoleDefinition{}
+	for rows.Next() {
+		var role models.RoleDefinition
+		if err := rows.Scan(&role.Name, &role.Description, &role.BuiltIn, &role.CreatedAt, &role.UpdatedAt); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan role"})
+			return
+		}
+		roles = append(roles, role)
+	}
+	rows.Close()
+
+	for i := range roles {
+		roles[i].Permissions, err = database.RolePermissions(roles[i].Name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// CreateRole godoc
+// @Summary Create a role (Admin only)
+// @Description Create a custom role from a set of permissions. Only permissions held by the requesting user can be granted.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param role body models.CreateRoleRequest true "Role data"
+// @Success 201 {object} models.RoleDefinition
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/roles [post]
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var req models.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !req.Name.IsValidName() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role names must start with a lowercase letter and contain only lowercase letters, digits, '_' and '-'"})
+		return
+	}
+
+	permissions, ok := validateGrantedPermissions(c, req.Permissions)
+	if !ok {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec(
+		"INSERT OR IGNORE INTO roles (name, description, built_in, created_at, updated_at) VALUES (?, ?, 0, ?, ?)",
+		req.Name, req.Description, now, now,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+	if created, _ := result.RowsAffected(); created == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+		return
+	}
+
+	if err := replaceRolePermissions(tx, req.Name, permissions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+
+	role := models.RoleDefinition{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: sortedPermissions(permissions),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := recordAudit(c, tx, "role.create", auditTargetRole, role.Name, nil, role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	respondWithRole(c, http.StatusCreated, req.Name)
+}
+
+// UpdateRole godoc
+// @Summary Update a role (Admin only)
+// @Description Replace the permissions (and optionally the description) of a role. Changes apply to all its users immediately. The admin role always holds every permission.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Role name"
+// @Param role body models.UpdateRoleRequest true "Role data"
+// @Success 200 {object} models.RoleDefinition
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/roles/{name} [put]
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	name := models.Role(c.Param("name"))
+
+	var req models.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if name == models.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The admin role always holds every permission"})
+		return
+	}
+
+	permissions, ok := validateGrantedPermissions(c, req.Permissions)
+	if !ok {
+		return
+	}
+
+	before, err := loadRole(name)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Taking permissions away from a role is limited the same way as granting them
+	if _, ok := validateGrantedPermissions(c, before.Permissions); !ok {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	after := before
+	if req.Description != nil {
+		after.Description = *req.Description
+	}
+	after.Permissions = sortedPermissions(permissions)
+	after.UpdatedAt = time.Now()
+
+	result, err := tx.Exec(
+		"UPDATE roles SET description = ?, updated_at = ? WHERE name = ?",
+		after.Description, after.UpdatedAt, name,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	if err := replaceRolePermissions(tx, name, permissions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "role.update", auditTargetRole, name, before, after); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, after)
+}
+
+// DeleteRole godoc
+// @Summary Delete a role (Admin only)
+// @Description Delete a custom role that is not assigned to any user or pending invite
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Role name"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/roles/{name} [delete]
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	name := models.Role(c.Param("name"))
+
+	role, err := loadRole(name)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if role.BuiltIn {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in roles cannot be deleted"})
+		return
+	}
+
+	var inUse int
+	err = database.DB.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM users WHERE role = ? AND deleted_at IS NULL)
+		     + (SELECT COUNT(*) FROM invites WHERE role = ? AND used_at IS NULL AND expires_at > ?)
+	`, name, name, time.Now()).Scan(&inUse)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if inUse > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role is assigned to users or pending invites"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM roles WHERE name = ?", name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "role.delete", auditTargetRole, name, role, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
+
+// validateGrantedPermissions checks that every permission is known and held
+// by the requesting user, so nobody can hand out more access than they have.
+// It returns the permissions without duplicates.
+func validateGrantedPermissions(c *gin.Context, permissions []models.Permission) ([]models.Permission, bool) {
+	unique := []models.Permission{}
+	seen := map[models.Permission]bool{}
+	for _, permission := range permissions {
+		if !permission.IsValid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid permission: " + string(permission)})
+			return nil, false
+		}
+		if !middleware.HasPermission(c, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot grant a permission you do not hold: " + string(permission)})
+			return nil, false
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			unique = append(unique, permission)
+		}
+	}
+	return unique, true
+}
+
+// checkGrantableRole makes sure a role exists and that the requesting user
+// holds all of its permissions before it is assigned to someone. It writes
+// the error response and returns false otherwise.
+func checkGrantableRole(c *gin.Context, role models.Role) bool {
+	exists, err := database.RoleExists(role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return false
+	}
+
+	permissions, err := database.RolePermissions(role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	_, ok := validateGrantedPermissions(c, permissions)
+	return ok
+}
+
+func replaceRolePermissions(tx *sql.Tx, role models.Role, permissions []models.Permission) error {
+	if _, err := tx.Exec("DELETE FROM role_permissions WHERE role = ?", role); err != nil {
+		return err
+	}
+	for _, permission := range permissions {
+		if _, err := tx.Exec("INSERT INTO role_permissions (role, permission) VALUES (?, ?)", role, permission); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedPermissions orders permissions the way database.RolePermissions
+// returns them, so audit snapshots only differ when the set changes
+func sortedPermissions(permissions []models.Permission) []models.Permission {
+	sorted := append([]models.Permission{}, permissions...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+func loadRole(name models.Role) (models.RoleDefinition, error) {
+	var role models.RoleDefinition
+	err := database.DB.QueryRow(
+		"SELECT name, description, built_in, created_at, updated_at FROM roles WHERE name = ?", name,
+	).Scan(&role.Name, &role.Description, &role.BuiltIn, &role.CreatedAt, &role.UpdatedAt)
+	if err != nil {
+		return role, err
+	}
+
+	role.Permissions, err = database.RolePermissions(name)
+	return role, err
+}
+
+func respondWithRole(c *gin.Context, status int, name models.Role) {
+	role, err := loadRole(name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(status, role)
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/middleware"
+	"smarapp-api/models"
+	"smarapp-api/testutil"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newRoleRouter wires the role and user routes behind the real middleware, as in main.go
+func newRoleRouter(jwtSecret string) *gin.Engine {
+	roleHandler := NewRoleHandler()
+	userHandler := NewUserHandler()
+
+	r := newTestRouter(jwtSecret)
+	roles := r.Require("/admin", models.PermissionRolesManage)
+	roles.GET("/roles", roleHandler.ListRoles)
+	roles.POST("/roles", roleHandler.CreateRole)
+	roles.PUT("/roles/:name", roleHandler.UpdateRole)
+	roles.DELETE("/roles/:name", roleHandler.DeleteRole)
+
+	users := r.Require("/admin/users", models.PermissionUsersRead)
+	users.GET("", userHandler.ListUsers)
+	users.PUT("/:id/role", middleware.RequirePermission(models.PermissionUsersWrite), userHandler.UpdateUserRole)
+	return r.Engine
+}
+
+func TestRoleHandler_CustomRoles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	jwtSecret := "test-secret"
+	r := newRoleRouter(jwtSecret)
+
+	adminToken, _ := seedTokens(t, jwtSecret)
+	userToken, err := middleware.GenerateToken(models.User{ID: 2, Username: "user", Email: "user@test.com", Role: models.RoleUser}, jwtSecret)
+	assert.NoError(t, err)
+
+	w := performJSON(r, "GET", "/admin/roles", adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var roles []models.RoleDefinition
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &roles))
+	assert.Len(t, roles, 2)
+	assert.ElementsMatch(t, models.AllPermissions, roles[0].Permissions)
+
+	// Invalid names and permissions are rejected
+	w = performJSON(r, "POST", "/admin/roles", adminToken, models.CreateRoleRequest{Name: "Support Team", Permissions: []models.Permission{}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performJSON(r, "POST", "/admin/roles", adminToken, models.CreateRoleRequest{Name: "support", Permissions: []models.Permission{"orders:delete"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performJSON(r, "POST", "/admin/roles", adminToken, models.CreateRoleRequest{
+		Name:        "support",
+		Description: "Customer support",
+		Permissions: []models.Permission{models.PermissionUsersRead, models.PermissionUsersRead},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created models.RoleDefinition
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, []models.Permission{models.PermissionUsersRead}, created.Permissions)
+	assert.False(t, created.BuiltIn)
+
+	w = performJSON(r, "POST", "/admin/roles", adminToken, models.CreateRoleRequest{Name: "support", Permissions: []models.Permission{}})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Assigning the role grants its permissions, and nothing more
+	w = performJSON(r, "PUT", "/admin/users/2/role", adminToken, models.UpdateUserRoleRequest{Role: "support"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performJSON(r, "GET", "/admin/users", userToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performJSON(r, "PUT", "/admin/users/2/role", userToken, models.UpdateUserRoleRequest{Role: models.RoleAdmin})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Users cannot grant permissions they do not hold, nor take them away
+	_, err = database.DB.Exec("INSERT INTO role_permissions (role, permission) VALUES ('support', 'users:write')")
+	assert.NoError(t, err)
+	_, err = database.DB.Exec("INSERT INTO users (id, username, email, password, role) VALUES (3, 'other', 'other@test.com', 'x', 'user')")
+	assert.NoError(t, err)
+	w = performJSON(r, "PUT", "/admin/users/3/role", userToken, models.UpdateUserRoleRequest{Role: models.RoleAdmin})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Cannot grant a permission you do not hold")
+	w = performJSON(r, "PUT", "/admin/users/1/role", userToken, models.UpdateUserRoleRequest{Role: models.RoleUser})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = performJSON(r, "PUT", "/admin/users/3/role", userToken, models.UpdateUserRoleRequest{Role: "support"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performJSON(r, "PUT", "/admin/users/3/role", adminToken, models.UpdateUserRoleRequest{Role: models.RoleUser})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performJSON(r, "PUT", "/admin/users/2/role", adminToken, models.UpdateUserRoleRequest{Role: "unknown"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Built-in roles are protected, roles in use cannot be deleted
+	w = performJSON(r, "PUT", "/admin/roles/admin", adminToken, models.UpdateRoleRequest{Permissions: []models.Permission{}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performJSON(r, "DELETE", "/admin/roles/user", adminToken, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performJSON(r, "DELETE", "/admin/roles/support", adminToken, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Removing a permission applies to existing tokens right away
+	w = performJSON(r, "PUT", "/admin/roles/support", adminToken, models.UpdateRoleRequest{Permissions: []models.Permission{}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performJSON(r, "GET", "/admin/users", userToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performJSON(r, "PUT", "/admin/users/2/role", adminToken, models.UpdateUserRoleRequest{Role: models.RoleUser})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performJSON(r, "DELETE", "/admin/roles/support", adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performJSON(r, "DELETE", "/admin/roles/support", adminToken, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
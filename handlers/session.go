@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListSessions godoc
+// @Summary List sessions
+// @Description Get the signed-in devices of the authenticated user, most recently active first. The session making the request is marked as current.
+// @Tags Profile
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Session
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /profile/sessions [get]
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	sessions, err := activeSessions(userID.(int), c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession godoc
+// @Summary Sign out a session
+// @Description Sign out one of the authenticated user's devices. Its refresh token and access tokens are rejected from then on.
+// @Tags Profile
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Session ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /profile/sessions/{id} [delete]
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id := c.Param("id")
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var revokedAt sql.NullTime
+	err = tx.QueryRow(
+		"SELECT revoked_at FROM sessions WHERE id = ? AND user_id = ?",
+		id, userID,
+	).Scan(&revokedAt)
+	if err == sql.ErrNoRows || (err == nil && revokedAt.Valid) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := revokeSession(tx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "session.revoke", auditTargetSession, id, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// ListUserSessions godoc
+// @Summary List a user's sessions (Admin only)
+// @Description Get the signed-in devices of a user, most recently active first
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {array} models.Session
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/users/{id}/sessions [get]
+func (h *UserHandler) ListUserSessions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	sessions, err := activeSessions(id, c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeUserSessions godoc
+// @Summary Sign out all sessions of a user (Admin only)
+// @Description Sign out every device of a user. All of their refresh and access tokens are rejected from then on; API keys are not affected.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/users/{id}/sessions [delete]
+func (h *UserHandler) RevokeUserSessions(c *gin.Context) {
+	id, ok := targetUserID(c, "sign out")
+	if !ok || !checkManageableUser(c, id) {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Also covers access tokens issued before sessions were recorded
+	now := time.Now()
+	result, err := tx.Exec(
+		"UPDATE users SET tokens_valid_after = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL",
+		now.Truncate(time.Second), now, id,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := revokeUserSessions(tx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "user.sessions_revoke", auditTargetUser, id, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked successfully"})
+}
+
+// activeSessions returns the sessions of a user that are neither revoked nor
+// expired, flagging currentID
+func activeSessions(userID int, currentID string) ([]models.Session, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, user_agent, ip_address, mfa, created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL
+		ORDER BY last_seen_at DESC, created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(
+			&session.ID, &session.UserAgent, &session.IPAddress, &session.MFA,
+			&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if now.After(session.ExpiresAt) {
+			continue
+		}
+		session.Current = session.ID == currentID
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
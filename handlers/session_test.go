@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"smarapp-api/testutil"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newSessionRouter wires the session routes behind the real auth middleware
+func newSessionRouter(handler *AuthHandler) *gin.Engine {
+	userHandler := NewUserHandler()
+
+	r := newTestRouter(handler.JWTSecret)
+	r.POST("/login", handler.Login)
+	r.POST("/refresh", handler.Refresh)
+	r.Protected.GET("/profile", handler.GetProfile)
+	r.Protected.GET("/profile/sessions", handler.ListSessions)
+	r.Protected.DELETE("/profile/sessions/:id", handler.RevokeSession)
+
+	users := r.Require("/admin/users", models.PermissionUsersWrite)
+	users.GET("/:id/sessions", userHandler.ListUserSessions)
+	users.DELETE("/:id/sessions", userHandler.RevokeUserSessions)
+	return r.Engine
+}
+
+// loginWithUserAgent logs in from a device identified by its user agent
+func loginWithUserAgent(t *testing.T, r *gin.Engine, email, password, userAgent string) models.LoginResponse {
+	jsonBody, _ := json.Marshal(models.LoginRequest{Email: email, Password: password})
+	req := httptest.NewRequest("POST", "/login", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.LoginResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func TestAuthHandler_Sessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+	r := newSessionRouter(handler)
+
+	registerTestUser(t, handler, models.RegisterRequest{
+		Username: "testuser",
+		Email:    "test@test.com",
+		Password: "password123",
+	})
+	laptop := loginWithUserAgent(t, r, "test@test.com", "password123", "Laptop Browser")
+	phone := loginWithUserAgent(t, r, "test@test.com", "password123", "Phone App")
+
+	w := performJSON(r, "GET", "/profile/sessions", phone.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var sessions []models.Session
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &sessions))
+	assert.Len(t, sessions, 3)
+
+	var laptopSession models.Session
+	for _, session := range sessions {
+		if session.UserAgent == "Laptop Browser" {
+			laptopSession = session
+		}
+		assert.Equal(t, session.UserAgent == "Phone App", session.Current)
+		assert.NotEmpty(t, session.IPAddress)
+	}
+	assert.NotEmpty(t, laptopSession.ID)
+
+	// Signing out the laptop rejects its access and refresh tokens
+	w = performJSON(r, "DELETE", "/profile/sessions/"+laptopSession.ID, phone.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performJSON(r, "GET", "/profile", laptop.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Session has been revoked")
+
+	w = performJSON(r, "POST", "/refresh", "", models.RefreshRequest{RefreshToken: laptop.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performJSON(r, "DELETE", "/profile/sessions/"+laptopSession.ID, phone.Token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Refreshing keeps the session
+	w = performJSON(r, "POST", "/refresh", "", models.RefreshRequest{RefreshToken: phone.RefreshToken})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var refreshed models.LoginResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &refreshed))
+
+	w = performJSON(r, "GET", "/profile/sessions", refreshed.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &sessions))
+	assert.Len(t, sessions, 2)
+
+	// Sessions of other users cannot be signed out
+	other := registerTestUser(t, handler, models.RegisterRequest{
+		Username: "otheruser",
+		Email:    "other@test.com",
+		Password: "password123",
+	})
+	var otherSessionID string
+	err := database.DB.QueryRow("SELECT id FROM sessions WHERE user_id = ?", other.User.ID).Scan(&otherSessionID)
+	assert.NoError(t, err)
+	w = performJSON(r, "DELETE", "/profile/sessions/"+otherSessionID, phone.Token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestUserHandler_RevokeUserSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+	r := newSessionRouter(handler)
+
+	admin := registerTestUser(t, handler, models.RegisterRequest{
+		Username: "adminuser",
+		Email:    "admin@test.com",
+		Password: "password123",
+	})
+	_, err := database.DB.Exec("UPDATE users SET role = ? WHERE id = ?", models.RoleAdmin, admin.User.ID)
+	assert.NoError(t, err)
+
+	target := registerTestUser(t, handler, models.RegisterRequest{
+		Username: "testuser",
+		Email:    "test@test.com",
+		Password: "password123",
+	})
+	second := loginWithUserAgent(t, r, "test@test.com", "password123", "Second Device")
+
+	w := performJSON(r, "GET", "/admin/users/"+strconv.Itoa(target.User.ID)+"/sessions", admin.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var sessions []models.Session
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &sessions))
+	assert.Len(t, sessions, 2)
+
+	// Regular users cannot terminate sessions
+	w = performJSON(r, "DELETE", "/admin/users/"+strconv.Itoa(admin.User.ID)+"/sessions", target.Token, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performJSON(r, "DELETE", "/admin/users/"+strconv.Itoa(target.User.ID)+"/sessions", admin.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	for _, tokens := range []models.LoginResponse{target, second} {
+		w = performJSON(r, "GET", "/profile", tokens.Token, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = performJSON(r, "POST", "/refresh", "", models.RefreshRequest{RefreshToken: tokens.RefreshToken})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	w = performJSON(r, "GET", "/admin/users/"+strconv.Itoa(target.User.ID)+"/sessions", admin.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &sessions))
+	assert.Empty(t, sessions)
+
+	// The admin's own session is untouched
+	w = performJSON(r, "GET", "/profile", admin.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performJSON(r, "DELETE", "/admin/users/999/sessions", admin.Token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
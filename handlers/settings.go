@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SettingsHandler struct{}
+
+func NewSettingsHandler() *SettingsHandler {
+	return &SettingsHandler{}
+}
+
+// GetSecuritySettings godoc
+// @Summary Get security settings (Admin only)
+// @Description Get the security settings that apply to all accounts
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SecuritySettings
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/settings/security [get]
+func (h *SettingsHandler) GetSecuritySettings(c *gin.Context) {
+	settings, err := loadSecuritySettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSecuritySettings godoc
+// @Summary Update security settings (Admin only)
+// @Description Require two-factor authentication for all admin accounts. Enabling it requires the current session to have used two-factor authentication, so admins cannot lock themselves out.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param settings body models.UpdateSecuritySettingsRequest true "Security settings"
+// @Success 200 {object} models.SecuritySettings
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/settings/security [put]
+func (h *SettingsHandler) UpdateSecuritySettings(c *gin.Context) {
+	var req models.UpdateSecuritySettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if *req.RequireAdminTwoFactor && !c.GetBool("mfa") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sign in with two-factor authentication before requiring it for admins"})
+		return
+	}
+
+	before, err := loadSecuritySettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := database.SetSetting(tx, database.SettingRequireAdminTwoFactor, strconv.FormatBool(*req.RequireAdminTwoFactor)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
+		return
+	}
+
+	settings := models.SecuritySettings{RequireAdminTwoFactor: *req.RequireAdminTwoFactor}
+	if err := recordAudit(c, tx, "settings.update", auditTargetSettings, "security", before, settings); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+func loadSecuritySettings() (models.SecuritySettings, error) {
+	requireAdminTwoFactor, err := database.GetSetting(database.SettingRequireAdminTwoFactor, "false")
+	if err != nil {
+		return models.SecuritySettings{}, err
+	}
+
+	return models.SecuritySettings{RequireAdminTwoFactor: requireAdminTwoFactor == "true"}, nil
+}
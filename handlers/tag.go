@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TagHandler struct{}
+
+func NewTagHandler() *TagHandler {
+	return &TagHandler{}
+}
+
+// ListTags godoc
+// @Summary List tags
+// @Description Get all tags in alphabetical order with the number of products carrying each
+// @Tags Categories
+// @Produce json
+// @Success 200 {array} models.Tag
+// @Failure 500 {object} map[string]string
+// @Router /tags [get]
+func (h *TagHandler) ListTags(c *gin.Context) {
+	rows, err := database.DB.Query(`
+		SELECT t.id, t.name, COUNT(p.id), t.created_at
+		FROM tags t
+		LEFT JOIN product_tags pt ON pt.tag_id = t.id
+		LEFT JOIN products p ON p.id = pt.product_id AND p.deleted_at IS NULL
+		GROUP BY t.id ORDER BY t.name`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		return
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Products, &tag.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan tag"})
+			return
+		}
+		tags = append(tags, tag)
+	}
+
+	jsonWithWeakETag(c, tags)
+}
+
+// CreateTag godoc
+// @Summary Create a tag (Admin only)
+// @Description Create a tag ahead of tagging products. Tags are stored lowercase; products can also be given new tags directly.
+// @Tags Categories
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param tag body models.TagRequest true "Tag name"
+// @Success 201 {object} models.Tag
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/tags [post]
+func (h *TagHandler) CreateTag(c *gin.Context) {
+	var req models.TagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := normalizeTag(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tags must not be blank"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec("INSERT OR IGNORE INTO tags (name, created_at) VALUES (?, ?)", name, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tag"})
+		return
+	}
+	if created, _ := result.RowsAffected(); created == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Tag already exists"})
+		return
+	}
+
+	tagID, _ := result.LastInsertId()
+	tag := models.Tag{ID: int(tagID), Name: name, CreatedAt: now}
+
+	if err := recordAudit(c, tx, "tag.create", auditTargetTag, tag.ID, nil, tag); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tag)
+}
+
+// UpdateTag godoc
+// @Summary Rename a tag (Admin only)
+// @Description Rename a tag on every product carrying it
+// @Tags Categories
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Tag ID"
+// @Param tag body models.TagRequest true "New tag name"
+// @Success 200 {object} models.Tag
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/tags/{id} [put]
+func (h *TagHandler) UpdateTag(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		return
+	}
+
+	var req models.TagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := normalizeTag(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tags must not be blank"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := loadTag(tx, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var existingID int
+	err = tx.QueryRow("SELECT id FROM tags WHERE name = ? AND id != ?", name, id).Scan(&existingID)
+	if err != sql.ErrNoRows {
+		c.JSON(http.StatusConflict, gin.H{"error": "Tag already exists"})
+		return
+	}
+
+	// Products carrying the tag change too
+	if err := bumpProductVersions(tx, "SELECT product_id FROM product_tags WHERE tag_id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tag"})
+		return
+	}
+	if _, err := tx.Exec("UPDATE tags SET name = ? WHERE id = ?", name, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tag"})
+		return
+	}
+
+	tag := before
+	tag.Name = name
+
+	if err := recordAudit(c, tx, "tag.update", auditTargetTag, id, before, tag); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// DeleteTag godoc
+// @Summary Delete a tag (Admin only)
+// @Description Delete a tag and remove it from every product
+// @Tags Categories
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Tag ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/tags/{id} [delete]
+func (h *TagHandler) DeleteTag(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	tag, err := loadTag(tx, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := bumpProductVersions(tx, "SELECT product_id FROM product_tags WHERE tag_id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM tags WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "tag.delete", auditTargetTag, id, tag, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted successfully"})
+}
+
+func loadTag(tx *sql.Tx, id int) (models.Tag, error) {
+	var tag models.Tag
+	err := tx.QueryRow(
+		"SELECT t.id, t.name, (SELECT COUNT(*) FROM product_tags WHERE tag_id = t.id), t.created_at FROM tags t WHERE t.id = ?",
+		id,
+	).Scan(&tag.ID, &tag.Name, &tag.Products, &tag.CreatedAt)
+	return tag, err
+}
+
+// normalizeTag lowercases a tag and collapses its whitespace, so "Summer  Sale"
+// and "summer sale" are the same tag
+func normalizeTag(tag string) string {
+	return strings.Join(strings.Fields(strings.ToLower(tag)), " ")
+}
+
+// normalizeTags normalizes the tags of a product and returns them sorted and
+// without duplicates
+func normalizeTags(c *gin.Context, tags []string) ([]string, bool) {
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tags must not be blank"})
+			return nil, false
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			unique = append(unique, tag)
+		}
+	}
+	sort.Strings(unique)
+	return unique, true
+}
+
+// setProductTags replaces the tags of a product, creating tags that do not
+// exist yet
+func setProductTags(tx *sql.Tx, productID int, tags []string) error {
+	if _, err := tx.Exec("DELETE FROM product_tags WHERE product_id = ?", productID); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO tags (name, created_at) VALUES (?, ?)", tag, now); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO product_tags (product_id, tag_id) SELECT ?, id FROM tags WHERE name = ?", productID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"smarapp-api/database"
+	"smarapp-api/middleware"
+	"smarapp-api/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// generateOpaqueToken returns a random URL-safe token
+func generateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the SHA-256 hex digest stored in place of an opaque token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// insertRefreshToken stores a new refresh token in the given family and
+// returns the plain token together with its row ID. mfa records whether the
+// family was started with two-factor authentication.
+func insertRefreshToken(tx *sql.Tx, userID int, familyID string, mfa bool, ttl time.Duration) (string, int64, error) {
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return "", 0, err
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at, mfa, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, familyID, hashToken(token), time.Now().Add(ttl), mfa, time.Now(),
+	)
+	if err != nil {
+		return "", 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return "", 0, err
+	}
+
+	return token, id, nil
+}
+
+// revokeRefreshFamily revokes every still-active refresh token of a family
+// and signs out the session it belongs to
+func revokeRefreshFamily(familyID string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := revokeSession(tx, familyID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// revokeSession signs out a session and revokes its refresh token family
+func revokeSession(tx *sql.Tx, familyID string) error {
+	_, err := tx.Exec(
+		"UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL",
+		time.Now(), familyID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now(), familyID)
+	return err
+}
+
+// saveSession records the device a refresh token family is used from. Families
+// created before sessions existed get their session on the next refresh.
+func saveSession(tx *sql.Tx, c *gin.Context, userID int, familyID string, mfa bool, expiresAt time.Time) error {
+	userAgent, ipAddress := middleware.SessionDevice(c)
+	now := time.Now()
+	_, err := tx.Exec(`
+		INSERT INTO sessions (id, user_id, user_agent, ip_address, mfa, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET user_agent = excluded.user_agent, ip_address = excluded.ip_address,
+			last_seen_at = excluded.last_seen_at, expires_at = excluded.expires_at`,
+		familyID, userID, userAgent, ipAddress, mfa, now, now, expiresAt,
+	)
+	return err
+}
+
+// issueTokens starts a new session for the device making the request and
+// returns its access and refresh tokens. mfa marks sessions started with
+// two-factor authentication.
+func (h *AuthHandler) issueTokens(c *gin.Context, user models.User, mfa bool) (models.LoginResponse, error) {
+	familyID, err := middleware.NewTokenID()
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	accessToken, err := h.generateAccessToken(user, mfa, familyID)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+	defer tx.Rollback()
+
+	refreshToken, _, err := insertRefreshToken(tx, user.ID, familyID, mfa, h.RefreshTokenTTL)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	if err := saveSession(tx, c, user.ID, familyID, mfa, time.Now().Add(h.RefreshTokenTTL)); err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	return models.LoginResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(h.AccessTokenTTL.Seconds()),
+		User:         user,
+	}, nil
+}
+
+func (h *AuthHandler) generateAccessToken(user models.User, mfa bool, sessionID string) (string, error) {
+	claims, err := middleware.NewClaims(user, h.AccessTokenTTL)
+	if err != nil {
+		return "", err
+	}
+	claims.MFA = mfa
+	claims.SessionID = sessionID
+	return h.Keys.Sign(claims)
+}
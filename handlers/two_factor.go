@@ -0,0 +1,486 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"smarapp-api/totp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	twoFactorChallengeTTL = 5 * time.Minute
+
+	// maxChallengeAttempts wrong codes invalidate a login challenge
+	maxChallengeAttempts = 5
+
+	recoveryCodeCount = 10
+)
+
+// SetupTwoFactor godoc
+// @Summary Start two-factor enrollment
+// @Description Generate a new TOTP secret for the authenticated user. Two-factor authentication is enabled once a code is confirmed with POST /profile/2fa/enable.
+// @Tags Profile
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.TwoFactorSetupResponse
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /profile/2fa/setup [post]
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	user, err := fetchUser(userID.(int))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	// Replaces any unconfirmed secret from an earlier setup
+	if _, err := database.DB.Exec("UPDATE users SET totp_secret = ?, totp_last_counter = NULL WHERE id = ?", secret, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TwoFactorSetupResponse{
+		Secret:     secret,
+		OTPAuthURL: totp.KeyURI(h.TOTPIssuer, user.Email, secret),
+	})
+}
+
+// EnableTwoFactor godoc
+// @Summary Enable two-factor authentication
+// @Description Confirm the TOTP secret from the setup step with a current code. Returns single-use recovery codes, which are only shown once.
+// @Tags Profile
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param code body models.TwoFactorCodeRequest true "Current TOTP code"
+// @Success 200 {object} models.RecoveryCodesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /profile/2fa/enable [post]
+func (h *AuthHandler) EnableTwoFactor(c *gin.Context) {
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	var secret sql.NullString
+	var enabledAt sql.NullTime
+	err := database.DB.QueryRow(
+		"SELECT totp_secret, totp_enabled_at FROM users WHERE id = ? AND deleted_at IS NULL",
+		userID,
+	).Scan(&secret, &enabledAt)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if enabledAt.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if !secret.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor setup has not been started"})
+		return
+	}
+
+	counter, ok := totp.Validate(secret.String, strings.TrimSpace(req.Code), time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.Exec(
+		"UPDATE users SET totp_enabled_at = ?, totp_last_counter = ?, updated_at = ? WHERE id = ?",
+		now, counter, now, userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "user.two_factor_enable", auditTargetUser, userID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor godoc
+// @Summary Disable two-factor authentication
+// @Description Turn off two-factor authentication after confirming the password and a TOTP or recovery code
+// @Tags Profile
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param confirmation body models.DisableTwoFactorRequest true "Password and code"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /profile/2fa/disable [post]
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	var req models.DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	var hashedPassword string
+	var role models.Role
+	var secret sql.NullString
+	var enabledAt sql.NullTime
+	var lastCounter sql.NullInt64
+	err := database.DB.QueryRow(
+		"SELECT password, role, totp_secret, totp_enabled_at, totp_last_counter FROM users WHERE id = ? AND deleted_at IS NULL",
+		userID,
+	).Scan(&hashedPassword, &role, &secret, &enabledAt, &lastCounter)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if !enabledAt.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if !h.Passwords.Verify(hashedPassword, req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	permissions, err := database.RolePermissions(role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if len(permissions) > 0 {
+		required, err := database.GetSetting(database.SettingRequireAdminTwoFactor, "false")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if required == "true" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is required for admin accounts"})
+			return
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	ok, err := verifySecondFactor(tx, userID.(int), secret.String, lastCounter, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	_, err = tx.Exec(
+		"UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_counter = NULL, updated_at = ? WHERE id = ?",
+		time.Now(), userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "user.two_factor_disable", auditTargetUser, userID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled successfully"})
+}
+
+// VerifyTwoFactor godoc
+// @Summary Complete a two-factor login
+// @Description Exchange the challenge token returned by Login and a TOTP or recovery code for an access token and refresh token
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param challenge body models.TwoFactorVerifyRequest true "Challenge token and code"
+// @Success 200 {object} models.LoginResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/2fa/verify [post]
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	var req models.TwoFactorVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, userID, err := h.parseAccountToken(req.ChallengeToken, purposeTwoFactorChallenge)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+
+	var usedAt sql.NullTime
+	err = database.DB.QueryRow("SELECT used_at FROM account_tokens WHERE jti = ?", claims.ID).Scan(&usedAt)
+	if err == sql.ErrNoRows || (err == nil && usedAt.Valid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var user models.User
+	var suspendedAt sql.NullTime
+	var secret sql.NullString
+	var lastCounter sql.NullInt64
+	err = database.DB.QueryRow(
+		"SELECT id, username, email, role, suspended_at, totp_secret, totp_last_counter, created_at, updated_at FROM users WHERE id = ? AND deleted_at IS NULL AND totp_enabled_at IS NOT NULL",
+		userID,
+	).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &suspendedAt, &secret, &lastCounter, &user.CreatedAt, &user.UpdatedAt)
+
+	if err == sql.ErrNoRows || (err == nil && user.Email != claims.Email) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if suspendedAt.Valid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account suspended"})
+		return
+	}
+
+	ip := c.ClientIP()
+	wait, err := h.checkLoginThrottle(user.Email, ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if wait > 0 {
+		respondTooManyAttempts(c, wait)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	ok, err := verifySecondFactor(tx, user.ID, secret.String, lastCounter, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !ok {
+		tx.Rollback()
+		if err := recordChallengeFailure(claims.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if err := h.recordLoginFailure(user.Email, ip, &user.ID, loginFailureInvalid2FACode, true); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	if err := consumeAccountToken(tx, claims.ID, purposeTwoFactorChallenge); err == errInvalidAccountToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	if err := recordLoginSuccess(user.Email, ip, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	user.TwoFactorEnabled = true
+	response, err := h.issueTokens(c, user, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// verifySecondFactor accepts either a TOTP code that was not used before or
+// an unused recovery code, and marks it as used
+func verifySecondFactor(tx *sql.Tx, userID int, secret string, lastCounter sql.NullInt64, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+
+	if counter, ok := totp.Validate(secret, code, time.Now()); ok {
+		if lastCounter.Valid && counter <= uint64(lastCounter.Int64) {
+			return false, nil
+		}
+
+		result, err := tx.Exec(
+			"UPDATE users SET totp_last_counter = ? WHERE id = ? AND (totp_last_counter IS NULL OR totp_last_counter < ?)",
+			counter, userID, counter,
+		)
+		if err != nil {
+			return false, err
+		}
+		rowsAffected, _ := result.RowsAffected()
+		return rowsAffected == 1, nil
+	}
+
+	result, err := tx.Exec(
+		"UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		time.Now(), userID, hashToken(normalizeRecoveryCode(code)),
+	)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected == 1, nil
+}
+
+// recordChallengeFailure counts a wrong code and invalidates the challenge
+// once too many were tried
+func recordChallengeFailure(jti string) error {
+	_, err := database.DB.Exec(
+		"UPDATE account_tokens SET attempts = attempts + 1, used_at = CASE WHEN attempts + 1 >= ? THEN ? ELSE used_at END WHERE jti = ?",
+		maxChallengeAttempts, time.Now(), jti,
+	)
+	return err
+}
+
+// replaceRecoveryCodes generates a new set of recovery codes, dropping the old ones
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(
+			"INSERT INTO recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)",
+			userID, hashToken(normalizeRecoveryCode(code)), time.Now(),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// generateRecoveryCode returns a code such as "k3f7a-2mx7q" (50 random bits)
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+	return s[:5] + "-" + s[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
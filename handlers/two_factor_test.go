@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/middleware"
+	"smarapp-api/models"
+	"smarapp-api/testutil"
+	"smarapp-api/totp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTwoFactorRouter(handler *AuthHandler) *gin.Engine {
+	r := newProfileRouter(handler)
+	r.POST("/login", handler.Login)
+	r.POST("/2fa/verify", handler.VerifyTwoFactor)
+	authorized := r.Group("/")
+	authorized.Use(middleware.AuthMiddleware(handler.JWTSecret))
+	authorized.POST("/profile/2fa/setup", handler.SetupTwoFactor)
+	authorized.POST("/profile/2fa/enable", handler.EnableTwoFactor)
+	authorized.POST("/profile/2fa/disable", handler.DisableTwoFactor)
+	return r
+}
+
+// enableTwoFactor enrolls the user and returns the secret, the code used to
+// confirm it and the recovery codes
+func enableTwoFactor(t *testing.T, r *gin.Engine, token string) (string, string, []string) {
+	w := performJSON(r, "POST", "/profile/2fa/setup", token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var setup models.TwoFactorSetupResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &setup))
+	assert.Contains(t, setup.OTPAuthURL, "otpauth://totp/SmarApp:")
+
+	code, err := totp.Code(setup.Secret, time.Now())
+	assert.NoError(t, err)
+
+	w = performJSON(r, "POST", "/profile/2fa/enable", token, models.TwoFactorCodeRequest{Code: code})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var recovery models.RecoveryCodesResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &recovery))
+	assert.Len(t, recovery.RecoveryCodes, recoveryCodeCount)
+
+	return setup.Secret, code, recovery.RecoveryCodes
+}
+
+func loginChallenge(t *testing.T, r *gin.Engine, email, password string) string {
+	w := performJSON(r, "POST", "/login", "", models.LoginRequest{Email: email, Password: password})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var challenge models.TwoFactorChallengeResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &challenge))
+	assert.True(t, challenge.TwoFactorRequired)
+	assert.NotEmpty(t, challenge.ChallengeToken)
+	return challenge.ChallengeToken
+}
+
+func TestAuthHandler_TwoFactorLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+	r := newTwoFactorRouter(handler)
+
+	registered := registerTestUser(t, handler, models.RegisterRequest{
+		Username: "testuser",
+		Email:    "test@test.com",
+		Password: "password123",
+	})
+
+	secret, enrollmentCode, recoveryCodes := enableTwoFactor(t, r, registered.Token)
+
+	// Enrolling twice is rejected
+	w := performJSON(r, "POST", "/profile/2fa/setup", registered.Token, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Login no longer returns tokens directly
+	challenge := loginChallenge(t, r, "test@test.com", "password123")
+
+	w = performJSON(r, "POST", "/2fa/verify", "", models.TwoFactorVerifyRequest{ChallengeToken: challenge, Code: "000000"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// The code used during enrollment cannot be replayed
+	w = performJSON(r, "POST", "/2fa/verify", "", models.TwoFactorVerifyRequest{ChallengeToken: challenge, Code: enrollmentCode})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	nextCode, _ := totp.Code(secret, time.Now().Add(totp.Period))
+	w = performJSON(r, "POST", "/2fa/verify", "", models.TwoFactorVerifyRequest{ChallengeToken: challenge, Code: nextCode})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.LoginResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotEmpty(t, response.Token)
+	assert.NotEmpty(t, response.RefreshToken)
+	assert.True(t, response.User.TwoFactorEnabled)
+
+	claims := &middleware.Claims{}
+	_, _, err := jwt.NewParser().ParseUnverified(response.Token, claims)
+	assert.NoError(t, err)
+	assert.True(t, claims.MFA)
+
+	// The challenge is single-use
+	w = performJSON(r, "POST", "/2fa/verify", "", models.TwoFactorVerifyRequest{ChallengeToken: challenge, Code: recoveryCodes[0]})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Recovery codes work once, with or without formatting
+	challenge = loginChallenge(t, r, "test@test.com", "password123")
+	w = performJSON(r, "POST", "/2fa/verify", "", models.TwoFactorVerifyRequest{ChallengeToken: challenge, Code: "  " + recoveryCodes[0] + " "})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	challenge = loginChallenge(t, r, "test@test.com", "password123")
+	w = performJSON(r, "POST", "/2fa/verify", "", models.TwoFactorVerifyRequest{ChallengeToken: challenge, Code: recoveryCodes[0]})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Disabling requires the password and a second factor
+	w = performJSON(r, "POST", "/profile/2fa/disable", registered.Token, models.DisableTwoFactorRequest{Password: "wrongpassword", Code: recoveryCodes[1]})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performJSON(r, "POST", "/profile/2fa/disable", registered.Token, models.DisableTwoFactorRequest{Password: "password123", Code: recoveryCodes[1]})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performJSON(r, "POST", "/login", "", models.LoginRequest{Email: "test@test.com", Password: "password123"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "refresh_token")
+}
+
+func TestAuthHandler_TwoFactorChallengeAttempts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	handler := NewAuthHandler("test-secret")
+	r := newTwoFactorRouter(handler)
+
+	registered := registerTestUser(t, handler, models.RegisterRequest{
+		Username: "testuser",
+		Email:    "test@test.com",
+		Password: "password123",
+	})
+	_, _, recoveryCodes := enableTwoFactor(t, r, registered.Token)
+
+	challenge := loginChallenge(t, r, "test@test.com", "password123")
+	for i := 0; i < maxChallengeAttempts; i++ {
+		w := performJSON(r, "POST", "/2fa/verify", "", models.TwoFactorVerifyRequest{ChallengeToken: challenge, Code: "000000"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// Even a valid code is rejected once the challenge is used up
+	w := performJSON(r, "POST", "/2fa/verify", "", models.TwoFactorVerifyRequest{ChallengeToken: challenge, Code: recoveryCodes[0]})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid or expired challenge")
+}
+
+func TestSettingsHandler_RequireAdminTwoFactor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	handler := NewSettingsHandler()
+	enabled := true
+
+	newRouter := func(mfa bool) *gin.Engine {
+		r := gin.New()
+		r.PUT("/settings", func(c *gin.Context) {
+			c.Set("user_id", 1)
+			c.Set("role", models.RoleAdmin)
+			c.Set("mfa", mfa)
+			handler.UpdateSecuritySettings(c)
+		})
+		return r
+	}
+
+	// An admin without a two-factor session cannot lock everyone out
+	w := performJSON(newRouter(false), "PUT", "/settings", "", models.UpdateSecuritySettingsRequest{RequireAdminTwoFactor: &enabled})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performJSON(newRouter(true), "PUT", "/settings", "", models.UpdateSecuritySettingsRequest{RequireAdminTwoFactor: &enabled})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"require_admin_2fa":true`)
+
+	value, err := database.GetSetting(database.SettingRequireAdminTwoFactor, "false")
+	assert.NoError(t, err)
+	assert.Equal(t, "true", value)
+
+	// Admin endpoints now reject admin tokens without two-factor authentication
+	adminRouter := gin.New()
+	adminRouter.Use(middleware.AuthMiddleware("test-secret"), middleware.AdminMiddleware())
+	adminRouter.GET("/admin", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "ok"})
+	})
+
+	admin := models.User{ID: 1, Username: "admin", Email: "admin@test.com", Role: models.RoleAdmin}
+	token, err := middleware.GenerateToken(admin, "test-secret")
+	assert.NoError(t, err)
+
+	w = performJSON(adminRouter, "GET", "/admin", token, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	claims, err := middleware.NewClaims(admin, time.Minute)
+	assert.NoError(t, err)
+	claims.MFA = true
+	mfaToken, err := middleware.SignClaims(claims, "test-secret")
+	assert.NoError(t, err)
+
+	w = performJSON(adminRouter, "GET", "/admin", mfaToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
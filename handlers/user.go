@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type UserHandler struct{}
+
+func NewUserHandler() *UserHandler {
+	return &UserHandler{}
+}
+
+// ListUsers godoc
+// @Summary List users (Admin only)
+// @Description Get a paginated list of users, optionally filtered by a search term, role or status
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number (default 1)"
+// @Param page_size query int false "Page size (default 20, max 100)"
+// @Param q query string false "Search in username and email"
+// @Param role query string false "Filter by role"
+// @Param status query string false "Filter by status (active or suspended)"
+// @Success 200 {object} models.UserListResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/users [get]
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	page, pageSize, err := parsePagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	where := " WHERE deleted_at IS NULL"
+	args := []interface{}{}
+
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		where += ` AND (username LIKE ? ESCAPE '\' OR email LIKE ? ESCAPE '\')`
+		pattern := likePattern(q)
+		args = append(args, pattern, pattern)
+	}
+	if role := c.Query("role"); role != "" {
+		where += " AND role = ?"
+		args = append(args, role)
+	}
+	switch c.Query("status") {
+	case "":
+	case "active":
+		where += " AND suspended_at IS NULL"
+	case "suspended":
+		where += " AND suspended_at IS NOT NULL"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM users"+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count users"})
+		return
+	}
+
+	rows, err := database.DB.Query(
+		"SELECT "+userColumns+" FROM users"+where+" ORDER BY id LIMIT ? OFFSET ?",
+		append(args, pageSize, (page-1)*pageSize)...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan user"})
+			return
+		}
+		users = append(users, user)
+	}
+
+	c.JSON(http.StatusOK, models.UserListResponse{
+		Users:    users,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	})
+}
+
+// GetUser godoc
+// @Summary Get a user (Admin only)
+// @Description Get a single user by ID
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/users/{id} [get]
+func (h *UserHandler) GetUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := fetchUser(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateUserRole godoc
+// @Summary Change a user's role (Admin only)
+// @Description Change the role of another user
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param role body models.UpdateUserRoleRequest true "New role"
+// @Success 200 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/users/{id}/role [put]
+func (h *UserHandler) UpdateUserRole(c *gin.Context) {
+	id, ok := targetUserID(c, "change the role of")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkGrantableRole(c, req.Role) {
+		return
+	}
+
+	// Users holding permissions the requester lacks keep their role
+	if !checkManageableUser(c, id) {
+		return
+	}
+
+	h.applyUserChange(c, id, "user.role_change", "Failed to update user", func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE users SET role = ?, updated_at = ? WHERE id = ?", req.Role, time.Now(), id)
+		return err
+	})
+}
+
+// SuspendUser godoc
+// @Summary Suspend a user (Admin only)
+// @Description Suspend a user. Suspended users cannot log in and their tokens are rejected.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/users/{id}/suspend [post]
+func (h *UserHandler) SuspendUser(c *gin.Context) {
+	id, ok := targetUserID(c, "suspend")
+	if !ok || !checkManageableUser(c, id) {
+		return
+	}
+
+	h.applyUserChange(c, id, "user.suspend", "Failed to suspend user", func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			"UPDATE users SET suspended_at = COALESCE(suspended_at, ?), updated_at = ? WHERE id = ?",
+			time.Now(), time.Now(), id,
+		)
+		if err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, id)
+	})
+}
+
+// UnsuspendUser godoc
+// @Summary Unsuspend a user (Admin only)
+// @Description Lift the suspension of a user
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/users/{id}/unsuspend [post]
+func (h *UserHandler) UnsuspendUser(c *gin.Context) {
+	id, ok := targetUserID(c, "unsuspend")
+	if !ok || !checkManageableUser(c, id) {
+		return
+	}
+
+	h.applyUserChange(c, id, "user.unsuspend", "Failed to unsuspend user", func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE users SET suspended_at = NULL, updated_at = ? WHERE id = ?", time.Now(), id)
+		return err
+	})
+}
+
+// DeleteUser godoc
+// @Summary Delete a user (Admin only)
+// @Description Delete a user. Their orders are kept for accounting and stay linked to an anonymized account, their chat messages are anonymized and the products they created are reassigned to the requesting admin.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/users/{id} [delete]
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	id, ok := targetUserID(c, "delete")
+	if !ok || !checkManageableUser(c, id) {
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := scanUser(tx.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ? AND deleted_at IS NULL", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE products SET created_by = ?, updated_at = ? WHERE created_by = ?", adminID, time.Now(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reassign products"})
+		return
+	}
+
+	if err := anonymizeUser(tx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "user.delete", auditTargetUser, id, before, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
+
+// applyUserChange runs change against an existing user in a transaction,
+// records the difference in the audit log and responds with the updated user
+func (h *UserHandler) applyUserChange(c *gin.Context, id int, action, failureMessage string, change func(tx *sql.Tx) error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := scanUser(tx.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ? AND deleted_at IS NULL", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := change(tx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failureMessage})
+		return
+	}
+
+	user, err := scanUser(tx.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := recordAudit(c, tx, action, auditTargetUser, id, before, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// targetUserID parses the :id parameter and refuses actions an admin would
+// take against their own account
+func targetUserID(c *gin.Context, action string) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+
+	if currentUserID, _ := c.Get("user_id"); currentUserID == id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("You cannot %s your own account", action)})
+		return 0, false
+	}
+
+	return id, true
+}
+
+// checkManageableUser refuses to act on users who hold permissions the
+// requester lacks, so that nobody can suspend, delete or sign out an account
+// more privileged than their own. It writes the error response and returns
+// false otherwise.
+func checkManageableUser(c *gin.Context, id int) bool {
+	var role models.Role
+	err := database.DB.QueryRow("SELECT role FROM users WHERE id = ? AND deleted_at IS NULL", id).Scan(&role)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	return checkGrantableRole(c, role)
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// userColumns is the column list read by scanUser
+const userColumns = "id, username, email, role, suspended_at, email_verified_at, totp_enabled_at IS NOT NULL, created_at, updated_at"
+
+func scanUser(row rowScanner) (models.User, error) {
+	var user models.User
+	var suspendedAt, emailVerifiedAt sql.NullTime
+	err := row.Scan(
+		&user.ID, &user.Username, &user.Email, &user.Role, &suspendedAt, &emailVerifiedAt,
+		&user.TwoFactorEnabled, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if suspendedAt.Valid {
+		user.SuspendedAt = &suspendedAt.Time
+	}
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.Time
+	}
+	return user, err
+}
+
+func fetchUser(id int) (models.User, error) {
+	return scanUser(database.DB.QueryRow(
+		"SELECT "+userColumns+" FROM users WHERE id = ? AND deleted_at IS NULL",
+		id,
+	))
+}
+
+// deletedChatUsername replaces the username on chat messages of deleted accounts
+const deletedChatUsername = "Deleted user"
+
+// anonymizeUser turns an account into a tombstone. The row is kept so that
+// orders and other history stay linked, but it can no longer be used to log
+// in and its username and email become available again. Accounts deleted by
+// their owner and by an admin go through here alike.
+func anonymizeUser(tx *sql.Tx, id int) error {
+	result, err := tx.Exec(`
+		UPDATE users SET username = ?, email = ?, password = '', suspended_at = NULL,
+			totp_secret = NULL, totp_enabled_at = NULL, totp_last_counter = NULL, deleted_at = ?, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL`,
+		fmt.Sprintf("deleted-user-%d", id), fmt.Sprintf("deleted-user-%d@deleted.invalid", id), time.Now(), time.Now(), id,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	// The external account may sign up again as a new user
+	if _, err := tx.Exec("DELETE FROM user_identities WHERE user_id = ?", id); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", id); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE chat_messages SET username = ? WHERE user_id = ?", deletedChatUsername, id); err != nil {
+		return err
+	}
+
+	return revokeUserSessions(tx, id)
+}
+
+// revokeUserSessions signs out every session of a user and revokes their
+// refresh tokens
+func revokeUserSessions(tx *sql.Tx, userID int) error {
+	_, err := tx.Exec(
+		"UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		time.Now(), userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", time.Now(), userID)
+	return err
+}
+
+// parsePagination reads the page and page_size query parameters
+func parsePagination(c *gin.Context) (int, int, error) {
+	page, pageSize := 1, defaultPageSize
+
+	if value := c.Query("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return 0, 0, errors.New("Invalid page")
+		}
+		page = parsed
+	}
+
+	if value := c.Query("page_size"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			return 0, 0, fmt.Errorf("Invalid page_size (must be between 1 and %d)", maxPageSize)
+		}
+		pageSize = parsed
+	}
+
+	return page, pageSize, nil
+}
+
+// likePattern builds a LIKE pattern matching the term anywhere, escaping wildcards
+func likePattern(term string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return "%" + replacer.Replace(term) + "%"
+}
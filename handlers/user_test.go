@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"smarapp-api/database"
+	"smarapp-api/middleware"
+	"smarapp-api/models"
+	"smarapp-api/testutil"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newAdminUserRouter returns a router acting as the seeded admin (ID 1)
+func newAdminUserRouter(handler *UserHandler) *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", 1)
+		c.Set("role", models.RoleAdmin)
+		c.Set("permissions", models.AllPermissions)
+		c.Next()
+	})
+	r.GET("/admin/users", handler.ListUsers)
+	r.GET("/admin/users/:id", handler.GetUser)
+	r.PUT("/admin/users/:id/role", handler.UpdateUserRole)
+	r.POST("/admin/users/:id/suspend", handler.SuspendUser)
+	r.POST("/admin/users/:id/unsuspend", handler.UnsuspendUser)
+	r.POST("/admin/users/:id/unlock", handler.UnlockUser)
+	r.GET("/admin/login-attempts", handler.ListLoginAttempts)
+	r.DELETE("/admin/users/:id", handler.DeleteUser)
+	return r
+}
+
+func TestUserHandler_ListUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	r := newAdminUserRouter(NewUserHandler())
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedTotal  int
+		expectedUsers  int
+	}{
+		{
+			name:           "all users",
+			query:          "",
+			expectedStatus: http.StatusOK,
+			expectedTotal:  2,
+			expectedUsers:  2,
+		},
+		{
+			name:           "paginated",
+			query:          "?page=2&page_size=1",
+			expectedStatus: http.StatusOK,
+			expectedTotal:  2,
+			expectedUsers:  1,
+		},
+		{
+			name:           "search by email",
+			query:          "?q=admin@",
+			expectedStatus: http.StatusOK,
+			expectedTotal:  1,
+			expectedUsers:  1,
+		},
+		{
+			name:           "filter by role",
+			query:          "?role=user",
+			expectedStatus: http.StatusOK,
+			expectedTotal:  1,
+			expectedUsers:  1,
+		},
+		{
+			name:           "wildcards are matched literally",
+			query:          "?q=%25",
+			expectedStatus: http.StatusOK,
+			expectedTotal:  0,
+			expectedUsers:  0,
+		},
+		{
+			name:           "invalid page size",
+			query:          "?page_size=1000",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid status",
+			query:          "?status=banned",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin/users"+tt.query, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedStatus == http.StatusOK {
+				var response models.UserListResponse
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedTotal, response.Total)
+				assert.Len(t, response.Users, tt.expectedUsers)
+			}
+		})
+	}
+}
+
+func TestUserHandler_GetUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	r := newAdminUserRouter(NewUserHandler())
+
+	tests := []struct {
+		name           string
+		userID         string
+		expectedStatus int
+	}{
+		{"existing user", "2", http.StatusOK},
+		{"non-existent user", "999", http.StatusNotFound},
+		{"invalid user ID", "abc", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin/users/"+tt.userID, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestUserHandler_UpdateUserRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	r := newAdminUserRouter(NewUserHandler())
+
+	tests := []struct {
+		name           string
+		userID         string
+		role           models.Role
+		expectedStatus int
+	}{
+		{"promote user", "2", models.RoleAdmin, http.StatusOK},
+		{"invalid role", "2", "superuser", http.StatusBadRequest},
+		{"own account", "1", models.RoleUser, http.StatusBadRequest},
+		{"non-existent user", "999", models.RoleUser, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonBody, _ := json.Marshal(models.UpdateUserRoleRequest{Role: tt.role})
+			req := httptest.NewRequest("PUT", "/admin/users/"+tt.userID+"/role", bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedStatus == http.StatusOK {
+				var user models.User
+				err := json.Unmarshal(w.Body.Bytes(), &user)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.role, user.Role)
+			}
+		})
+	}
+}
+
+func TestUserHandler_SuspendAndUnsuspend(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	r := newAdminUserRouter(NewUserHandler())
+
+	_, err := database.DB.Exec(
+		"INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) VALUES (2, 'family', 'hash', datetime('now', '+1 day'))",
+	)
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/admin/users/2/suspend", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var user models.User
+	err = json.Unmarshal(w.Body.Bytes(), &user)
+	assert.NoError(t, err)
+	assert.NotNil(t, user.SuspendedAt)
+
+	// Suspension revokes refresh tokens
+	var active int
+	err = database.DB.QueryRow("SELECT COUNT(*) FROM refresh_tokens WHERE user_id = 2 AND revoked_at IS NULL").Scan(&active)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, active)
+
+	req = httptest.NewRequest("GET", "/admin/users?status=suspended", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), `"total":1`)
+
+	req = httptest.NewRequest("POST", "/admin/users/2/unsuspend", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	user = models.User{}
+	err = json.Unmarshal(w.Body.Bytes(), &user)
+	assert.NoError(t, err)
+	assert.Nil(t, user.SuspendedAt)
+
+	// Admins cannot suspend themselves
+	req = httptest.NewRequest("POST", "/admin/users/1/suspend", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestUserHandler_DeleteUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	r := newAdminUserRouter(NewUserHandler())
+
+	// Give the user a product so reassignment can be checked, and
+	// two-factor authentication
+	for _, query := range []string{
+		"UPDATE products SET created_by = 2 WHERE id = 2",
+		"UPDATE users SET totp_secret = 'secret', totp_enabled_at = CURRENT_TIMESTAMP, totp_last_counter = 1 WHERE id = 2",
+		"INSERT INTO recovery_codes (user_id, code_hash) VALUES (2, 'hash')",
+	} {
+		_, err := database.DB.Exec(query)
+		assert.NoError(t, err)
+	}
+
+	req := httptest.NewRequest("DELETE", "/admin/users/2", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "deleted successfully")
+
+	// Orders are kept, chat messages anonymized, products reassigned
+	var orders, messages, createdBy, recoveryCodes int
+	var totpCleared bool
+	assert.NoError(t, database.DB.QueryRow("SELECT COUNT(*) FROM orders WHERE user_id = 2").Scan(&orders))
+	assert.NoError(t, database.DB.QueryRow("SELECT COUNT(*) FROM chat_messages WHERE user_id = 2 AND username = ?", deletedChatUsername).Scan(&messages))
+	assert.NoError(t, database.DB.QueryRow("SELECT created_by FROM products WHERE id = 2").Scan(&createdBy))
+	assert.Equal(t, 1, orders)
+	assert.Equal(t, 1, messages)
+	assert.Equal(t, 1, createdBy)
+
+	// Second factors do not outlive the account
+	assert.NoError(t, database.DB.QueryRow("SELECT COUNT(*) FROM recovery_codes WHERE user_id = 2").Scan(&recoveryCodes))
+	assert.NoError(t, database.DB.QueryRow(
+		"SELECT totp_secret IS NULL AND totp_enabled_at IS NULL AND totp_last_counter IS NULL FROM users WHERE id = 2",
+	).Scan(&totpCleared))
+	assert.Equal(t, 0, recoveryCodes)
+	assert.True(t, totpCleared)
+
+	// The account is gone from the API and its email can be reused
+	assert.Equal(t, 0, countUsersByEmail(t, "user@test.com"))
+
+	req = httptest.NewRequest("GET", "/admin/users/2", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req = httptest.NewRequest("DELETE", "/admin/users/2", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Admins cannot delete themselves
+	req = httptest.NewRequest("DELETE", "/admin/users/1", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestUserHandler_ManageMorePrivilegedUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	jwtSecret := "test-secret"
+	handler := NewUserHandler()
+	router := newTestRouter(jwtSecret)
+	users := router.Require("/admin/users", models.PermissionUsersWrite)
+	users.POST("/:id/suspend", handler.SuspendUser)
+	users.POST("/:id/unsuspend", handler.UnsuspendUser)
+	users.POST("/:id/unlock", handler.UnlockUser)
+	users.DELETE("/:id/sessions", handler.RevokeUserSessions)
+	users.DELETE("/:id", handler.DeleteUser)
+	r := router.Engine
+
+	// A support role that may manage users but holds little else
+	for _, query := range []string{
+		"INSERT INTO roles (name) VALUES ('support')",
+		"INSERT INTO role_permissions (role, permission) VALUES ('support', 'users:read'), ('support', 'users:write')",
+		"UPDATE users SET role = 'support' WHERE id = 2",
+		"INSERT INTO users (id, username, email, password, role) VALUES (3, 'other', 'other@test.com', 'x', 'user')",
+	} {
+		_, err := database.DB.Exec(query)
+		assert.NoError(t, err)
+	}
+	supportToken, err := middleware.GenerateToken(models.User{ID: 2, Username: "user", Email: "user@test.com", Role: "support"}, jwtSecret)
+	assert.NoError(t, err)
+
+	requests := []struct {
+		method, path string
+	}{
+		{"POST", "/suspend"},
+		{"POST", "/unsuspend"},
+		{"POST", "/unlock"},
+		{"DELETE", "/sessions"},
+		{"DELETE", ""},
+	}
+
+	// Admins hold permissions the support role lacks, so they are out of reach
+	for _, tt := range requests {
+		w := performJSON(r, tt.method, "/admin/users/1"+tt.path, supportToken, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code, tt.method+" "+tt.path)
+	}
+	var untouched bool
+	err = database.DB.QueryRow(
+		"SELECT suspended_at IS NULL AND deleted_at IS NULL AND tokens_valid_after IS NULL FROM users WHERE id = 1",
+	).Scan(&untouched)
+	assert.NoError(t, err)
+	assert.True(t, untouched)
+
+	// Less privileged users can still be managed
+	for _, tt := range requests {
+		w := performJSON(r, tt.method, "/admin/users/3"+tt.path, supportToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code, tt.method+" "+tt.path)
+	}
+
+	for _, tt := range requests {
+		w := performJSON(r, tt.method, "/admin/users/2"+tt.path, supportToken, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, tt.method+" "+tt.path)
+	}
+}
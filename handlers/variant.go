@@ -0,0 +1,646 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetProductVariants godoc
+// @Summary List the variants of a product
+// @Description Get the option types of a product and its variants with their SKU, price and stock
+// @Tags Products
+// @Produce json
+// @Param id path int true "Product ID"
+// @Success 200 {object} models.ProductVariantsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /products/{id}/variants [get]
+func (h *ProductHandler) GetProductVariants(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var exists bool
+	if err := database.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM products WHERE id = ? AND deleted_at IS NULL)", id).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	var response models.ProductVariantsResponse
+	if response.Options, err = loadProductOptions(database.DB, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch options"})
+		return
+	}
+	if response.Variants, err = loadProductVariants(database.DB, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch variants"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// SetProductOptions godoc
+// @Summary Set the option types of a product (Admin only)
+// @Description Replace the option types of a product, such as size and color, and the values its variants can choose from. Options can only be changed while the product has no variants.
+// @Tags Products
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Param options body models.SetProductOptionsRequest true "Option types in display order"
+// @Success 200 {object} models.ProductVariantsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /products/{id}/options [put]
+func (h *ProductHandler) SetProductOptions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req models.SetProductOptionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Options == nil {
+		req.Options = []models.ProductOption{}
+	}
+
+	names := map[string]bool{}
+	for _, option := range req.Options {
+		if names[option.Name] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Duplicate option: " + option.Name})
+			return
+		}
+		names[option.Name] = true
+
+		values := map[string]bool{}
+		for _, value := range option.Values {
+			if values[value] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Duplicate value %q for option %s", value, option.Name)})
+				return
+			}
+			values[value] = true
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var exists, hasVariants bool
+	err = tx.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM products WHERE id = ? AND deleted_at IS NULL), EXISTS (SELECT 1 FROM product_variants WHERE product_id = ?)",
+		id, id,
+	).Scan(&exists, &hasVariants)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	if hasVariants {
+		c.JSON(http.StatusConflict, gin.H{"error": "Delete the variants of the product before changing its options"})
+		return
+	}
+
+	before, err := loadProductOptions(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM product_options WHERE product_id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update options"})
+		return
+	}
+	for i, option := range req.Options {
+		result, err := tx.Exec("INSERT INTO product_options (product_id, name, position) VALUES (?, ?, ?)", id, option.Name, i)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update options"})
+			return
+		}
+		optionID, _ := result.LastInsertId()
+		for j, value := range option.Values {
+			if _, err := tx.Exec("INSERT INTO product_option_values (option_id, value, position) VALUES (?, ?, ?)", optionID, value, j); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update options"})
+				return
+			}
+		}
+	}
+
+	err = recordAudit(c, tx, "product.options_update", auditTargetProduct, id, gin.H{"options": before}, gin.H{"options": req.Options})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ProductVariantsResponse{Options: req.Options, Variants: []models.ProductVariant{}})
+}
+
+// CreateVariant godoc
+// @Summary Add a variant to a product (Admin only)
+// @Description Add a variant with its own SKU and stock, choosing one value for every option type of the product. Without a price the variant sells at the product price. Once a product has variants, its stock is the sum of theirs.
+// @Tags Products
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Param variant body models.CreateVariantRequest true "Variant data"
+// @Success 201 {object} models.ProductVariant
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /products/{id}/variants [post]
+func (h *ProductHandler) CreateVariant(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req models.CreateVariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var currency models.Currency
+	err = tx.QueryRow("SELECT currency FROM products WHERE id = ? AND deleted_at IS NULL", id).Scan(&currency)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if req.Price != nil && !validatePrice(c, *req.Price, currency) {
+		return
+	}
+
+	options, err := loadProductOptions(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if len(options) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Define the options of the product before adding variants"})
+		return
+	}
+	if err := validateVariantOptions(options, req.Options); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Map keys are marshaled in sorted order, which makes the JSON a unique
+	// key for the combination
+	key, err := json.Marshal(req.Options)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create variant"})
+		return
+	}
+
+	var skuTaken, combinationTaken bool
+	err = tx.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM product_variants WHERE sku = ?), EXISTS (SELECT 1 FROM product_variants WHERE product_id = ? AND options = ?)",
+		req.SKU, id, string(key),
+	).Scan(&skuTaken, &combinationTaken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if skuTaken {
+		c.JSON(http.StatusConflict, gin.H{"error": "Variant with this SKU already exists"})
+		return
+	}
+	if combinationTaken {
+		c.JSON(http.StatusConflict, gin.H{"error": "Variant with these options already exists"})
+		return
+	}
+
+	// Stock held by the product itself goes away with its first variant
+	var productStock int
+	err = tx.QueryRow(
+		"SELECT stock FROM products WHERE id = ? AND NOT EXISTS (SELECT 1 FROM product_variants WHERE product_id = ?)", id, id,
+	).Scan(&productStock)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if productStock != 0 {
+		movement := models.InventoryMovement{
+			ProductID: id,
+			Kind:      models.MovementAdjustment,
+			Quantity:  -productStock,
+			Reason:    "Stock moved to variants",
+		}
+		if err := recordMovement(c, tx, &movement); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create variant"})
+			return
+		}
+	}
+
+	// The initial stock is booked as a receipt
+	now := time.Now()
+	result, err := tx.Exec(
+		"INSERT INTO product_variants (product_id, sku, options, price, stock, created_at, updated_at) VALUES (?, ?, ?, ?, 0, ?, ?)",
+		id, req.SKU, string(key), priceAmount(req.Price), now, now,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create variant"})
+		return
+	}
+
+	variantID, _ := result.LastInsertId()
+
+	if req.Stock > 0 {
+		newID := int(variantID)
+		movement := models.InventoryMovement{
+			ProductID: id,
+			VariantID: &newID,
+			Kind:      models.MovementReceipt,
+			Quantity:  req.Stock,
+			Reason:    "Initial stock",
+		}
+		if err := recordMovement(c, tx, &movement); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create variant"})
+			return
+		}
+	}
+
+	variant := models.ProductVariant{
+		ID:        int(variantID),
+		ProductID: id,
+		SKU:       req.SKU,
+		Options:   req.Options,
+		Price:     req.Price,
+		Stock:     req.Stock,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := recordAudit(c, tx, "product_variant.create", auditTargetProductVariant, variant.ID, nil, variant); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, variant)
+}
+
+// UpdateVariant godoc
+// @Summary Update a variant (Admin only)
+// @Description Change the SKU, price or stock of a variant. A price with an amount of 0 makes the variant sell at the product price again. Prices are in the product currency.
+// @Tags Products
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Param variant_id path int true "Variant ID"
+// @Param variant body models.UpdateVariantRequest true "Fields to change"
+// @Success 200 {object} models.ProductVariant
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /products/{id}/variants/{variant_id} [put]
+func (h *ProductHandler) UpdateVariant(c *gin.Context) {
+	productID, variantID, ok := variantParams(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateVariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := loadVariant(tx, productID, variantID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	variant := before
+	if req.SKU != nil && *req.SKU != variant.SKU {
+		var taken bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM product_variants WHERE sku = ?)", *req.SKU).Scan(&taken); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if taken {
+			c.JSON(http.StatusConflict, gin.H{"error": "Variant with this SKU already exists"})
+			return
+		}
+		variant.SKU = *req.SKU
+	}
+	if req.Price != nil {
+		variant.Price = nil
+		if req.Price.Amount != 0 {
+			var currency models.Currency
+			if err := tx.QueryRow("SELECT currency FROM products WHERE id = ?", productID).Scan(&currency); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
+			}
+			if !validatePrice(c, *req.Price, currency) {
+				return
+			}
+			variant.Price = req.Price
+		}
+	}
+	if req.Stock != nil {
+		variant.Stock = *req.Stock
+	}
+
+	variant.UpdatedAt = time.Now()
+	_, err = tx.Exec(
+		"UPDATE product_variants SET sku = ?, price = ?, updated_at = ? WHERE id = ?",
+		variant.SKU, priceAmount(variant.Price), variant.UpdatedAt, variantID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update variant"})
+		return
+	}
+
+	// Setting the stock books the difference as an adjustment
+	if variant.Stock != before.Stock {
+		movement := models.InventoryMovement{
+			ProductID: productID,
+			VariantID: &variantID,
+			Kind:      models.MovementAdjustment,
+			Quantity:  variant.Stock - before.Stock,
+			Reason:    "Stock set by variant update",
+		}
+		if err := recordMovement(c, tx, &movement); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update variant"})
+			return
+		}
+	}
+
+	if err := recordAudit(c, tx, "product_variant.update", auditTargetProductVariant, variantID, before, variant); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, variant)
+}
+
+// DeleteVariant godoc
+// @Summary Delete a variant (Admin only)
+// @Description Delete a variant. Past orders keep its ID and SKU.
+// @Tags Products
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Param variant_id path int true "Variant ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /products/{id}/variants/{variant_id} [delete]
+func (h *ProductHandler) DeleteVariant(c *gin.Context) {
+	productID, variantID, ok := variantParams(c)
+	if !ok {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	variant, err := loadVariant(tx, productID, variantID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// The ledger keeps adding up once the variant's stock is gone
+	if variant.Stock != 0 {
+		movement := models.InventoryMovement{
+			ProductID: productID,
+			VariantID: &variantID,
+			Kind:      models.MovementAdjustment,
+			Quantity:  -variant.Stock,
+			Reason:    "Variant deleted",
+		}
+		if err := recordMovement(c, tx, &movement); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete variant"})
+			return
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM product_variants WHERE id = ?", variantID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete variant"})
+		return
+	}
+
+	if err := recordAudit(c, tx, "product_variant.delete", auditTargetProductVariant, variantID, variant, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Variant deleted successfully"})
+}
+
+// variantParams parses the product and variant IDs of a variant route
+func variantParams(c *gin.Context) (int, int, bool) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return 0, 0, false
+	}
+	variantID, err := strconv.Atoi(c.Param("variant_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return 0, 0, false
+	}
+	return productID, variantID, true
+}
+
+// validateVariantOptions checks that a variant picks one of the allowed
+// values for every option type of its product, and nothing else
+func validateVariantOptions(options []models.ProductOption, chosen map[string]string) error {
+	if len(chosen) != len(options) {
+		return fmt.Errorf("A variant needs exactly one value for each of the %d options", len(options))
+	}
+	for _, option := range options {
+		value, ok := chosen[option.Name]
+		if !ok {
+			return fmt.Errorf("Missing value for option %s", option.Name)
+		}
+		allowed := false
+		for _, candidate := range option.Values {
+			if candidate == value {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("Invalid value %q for option %s", value, option.Name)
+		}
+	}
+	return nil
+}
+
+func loadProductOptions(q queryer, productID int) ([]models.ProductOption, error) {
+	rows, err := q.Query(`
+		SELECT o.name, v.value FROM product_options o
+		JOIN product_option_values v ON v.option_id = o.id
+		WHERE o.product_id = ? ORDER BY o.position, v.position`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	options := []models.ProductOption{}
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		if len(options) == 0 || options[len(options)-1].Name != name {
+			options = append(options, models.ProductOption{Name: name, Values: []string{}})
+		}
+		last := &options[len(options)-1]
+		last.Values = append(last.Values, value)
+	}
+	return options, rows.Err()
+}
+
+func loadProductVariants(q queryer, productID int) ([]models.ProductVariant, error) {
+	rows, err := q.Query("SELECT "+variantColumns+" FROM product_variants WHERE product_id = ? ORDER BY id", productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []models.ProductVariant{}
+	for rows.Next() {
+		variant, err := scanVariant(rows)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+	return variants, rows.Err()
+}
+
+// priceAmount is the stored form of an optional price, NULL when there is
+// none
+func priceAmount(price *models.Money) interface{} {
+	if price == nil {
+		return nil
+	}
+	return price.Amount
+}
+
+// loadVariant reads a variant of a product that is not in the trash
+func loadVariant(q queryer, productID, variantID int) (models.ProductVariant, error) {
+	return scanVariant(q.QueryRow(
+		"SELECT "+variantColumns+" FROM product_variants WHERE id = ? AND product_id = ? "+
+			"AND product_id IN (SELECT id FROM products WHERE deleted_at IS NULL)",
+		variantID, productID,
+	))
+}
+
+// variantColumns is the column list read by scanVariant. Variant prices
+// are in the currency of their product.
+const variantColumns = "id, product_id, sku, options, price, (SELECT currency FROM products WHERE products.id = product_variants.product_id), stock, created_at, updated_at"
+
+func scanVariant(row rowScanner) (models.ProductVariant, error) {
+	var variant models.ProductVariant
+	var options string
+	var price sql.NullInt64
+	var currency models.Currency
+	err := row.Scan(
+		&variant.ID, &variant.ProductID, &variant.SKU, &options, &price, &currency,
+		&variant.Stock, &variant.CreatedAt, &variant.UpdatedAt,
+	)
+	if err != nil {
+		return variant, err
+	}
+	if price.Valid {
+		variant.Price = &models.Money{Amount: price.Int64, Currency: currency}
+	}
+	err = json.Unmarshal([]byte(options), &variant.Options)
+	return variant, err
+}
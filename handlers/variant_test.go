@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/middleware"
+	"smarapp-api/models"
+	"smarapp-api/testutil"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newVariantRouter wires the variant and order routes behind the real middleware, as in main.go
+func newVariantRouter(jwtSecret string) *gin.Engine {
+	productHandler := NewProductHandler()
+	orderHandler := NewOrderHandler()
+
+	r := newTestRouter(jwtSecret)
+	r.GET("/products/:id", productHandler.GetProduct)
+	r.GET("/products/:id/variants", productHandler.GetProductVariants)
+	r.Protected.POST("/orders", orderHandler.CreateOrder)
+	r.Protected.GET("/orders/:id", orderHandler.GetOrder)
+
+	products := r.Require("/products", models.PermissionProductsWrite)
+	products.PUT("/:id", productHandler.UpdateProduct)
+	products.PATCH("/:id", productHandler.PatchProduct)
+	products.PUT("/:id/options", productHandler.SetProductOptions)
+	products.POST("/:id/variants", productHandler.CreateVariant)
+	products.PUT("/:id/variants/:variant_id", productHandler.UpdateVariant)
+	products.DELETE("/:id/variants/:variant_id", productHandler.DeleteVariant)
+	return r.Engine
+}
+
+func productStock(t *testing.T, id int) int {
+	var stock int
+	assert.NoError(t, database.DB.QueryRow("SELECT stock FROM products WHERE id = ?", id).Scan(&stock))
+	return stock
+}
+
+func TestProductHandler_Variants(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	jwtSecret := "test-secret"
+	r := newVariantRouter(jwtSecret)
+
+	adminToken, _ := seedTokens(t, jwtSecret)
+	userToken, err := middleware.GenerateToken(models.User{ID: 2, Username: "user", Email: "user@test.com", Role: models.RoleUser}, jwtSecret)
+	assert.NoError(t, err)
+
+	// Variants need options first
+	w := performJSON(r, "POST", "/products/1/variants", adminToken, models.CreateVariantRequest{SKU: "TS-S", Options: map[string]string{}, Stock: 1})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performJSON(r, "PUT", "/products/1/options", adminToken, models.SetProductOptionsRequest{Options: []models.ProductOption{
+		{Name: "Size", Values: []string{"S", "M", "S"}},
+	}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	options := []models.ProductOption{
+		{Name: "Size", Values: []string{"S", "M", "L"}},
+		{Name: "Color", Values: []string{"Red", "Blue"}},
+	}
+	w = performJSON(r, "PUT", "/products/1/options", userToken, models.SetProductOptionsRequest{Options: options})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = performJSON(r, "PUT", "/products/1/options", adminToken, models.SetProductOptionsRequest{Options: options})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	price := usd(1250)
+	w = performJSON(r, "POST", "/products/1/variants", adminToken, models.CreateVariantRequest{
+		SKU: "TS-S-RED", Options: map[string]string{"Size": "S", "Color": "Red"}, Stock: 4,
+	})
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var small models.ProductVariant
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &small))
+	assert.Nil(t, small.Price)
+
+	w = performJSON(r, "POST", "/products/1/variants", adminToken, models.CreateVariantRequest{
+		SKU: "TS-L-BLUE", Options: map[string]string{"Size": "L", "Color": "Blue"}, Price: price, Stock: 2,
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var large models.ProductVariant
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &large))
+
+	for _, tt := range []struct {
+		req    models.CreateVariantRequest
+		status int
+	}{
+		{models.CreateVariantRequest{SKU: "X1", Options: map[string]string{"Size": "S"}}, http.StatusBadRequest},
+		{models.CreateVariantRequest{SKU: "X2", Options: map[string]string{"Size": "XL", "Color": "Red"}}, http.StatusBadRequest},
+		{models.CreateVariantRequest{SKU: "X3", Options: map[string]string{"Size": "S", "Colour": "Red"}}, http.StatusBadRequest},
+		{models.CreateVariantRequest{SKU: "TS-S-RED", Options: map[string]string{"Size": "M", "Color": "Red"}}, http.StatusConflict},
+		{models.CreateVariantRequest{SKU: "X4", Options: map[string]string{"Color": "Red", "Size": "S"}}, http.StatusConflict},
+		{models.CreateVariantRequest{SKU: "X5", Options: map[string]string{"Size": "M", "Color": "Blue"}, Price: &models.Money{Amount: 1250, Currency: "EUR"}}, http.StatusBadRequest},
+		{models.CreateVariantRequest{SKU: "X6", Options: map[string]string{"Size": "M", "Color": "Blue"}, Price: usd(-1)}, http.StatusBadRequest},
+	} {
+		w = performJSON(r, "POST", "/products/1/variants", adminToken, tt.req)
+		assert.Equal(t, tt.status, w.Code, tt.req.SKU)
+	}
+
+	// Options are fixed while variants exist
+	w = performJSON(r, "PUT", "/products/1/options", adminToken, models.SetProductOptionsRequest{Options: options[:1]})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = performJSON(r, "GET", "/products/1/variants", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response models.ProductVariantsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, options, response.Options)
+	if assert.Len(t, response.Variants, 2) {
+		assert.Equal(t, map[string]string{"Size": "L", "Color": "Blue"}, response.Variants[1].Options)
+		assert.Equal(t, price, response.Variants[1].Price)
+	}
+
+	// The product stock is the sum of its variants and cannot be set directly
+	assert.Equal(t, 6, productStock(t, 1))
+	stock, name := 50, "T-shirt"
+	w = performJSON(r, "PATCH", "/products/1", adminToken, models.PatchProductRequest{Stock: &stock})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performJSON(r, "PATCH", "/products/1", adminToken, models.PatchProductRequest{Name: &name})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 6, productStock(t, 1))
+
+	// A replacement may only repeat the current stock
+	replacement := models.UpdateProductRequest{Name: name, Description: "Cotton", Price: usd(9999), Stock: &stock}
+	w = performJSON(r, "PUT", "/products/1", adminToken, replacement)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	stock = 6
+	w = performJSON(r, "PUT", "/products/1", adminToken, replacement)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, 6, productStock(t, 1))
+
+	// Variant prices are amounts in the product's currency, which cannot
+	// change under them
+	w = performJSON(r, "PATCH", "/products/1", adminToken, models.PatchProductRequest{Price: &models.Money{Amount: 8999, Currency: "EUR"}})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Orders pick a variant of the product
+	w = performJSON(r, "POST", "/orders", userToken, models.CreateOrderRequest{ProductID: 1, Quantity: 1})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performJSON(r, "POST", "/orders", userToken, models.CreateOrderRequest{ProductID: 2, VariantID: large.ID, Quantity: 1})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = performJSON(r, "POST", "/orders", userToken, models.CreateOrderRequest{ProductID: 1, VariantID: large.ID, Quantity: 3})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "only 2 left of the variant")
+
+	w = performJSON(r, "POST", "/orders", userToken, models.CreateOrderRequest{ProductID: 1, VariantID: large.ID, Quantity: 2})
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var order models.OrderResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &order))
+	assert.Equal(t, *price, order.Order.Price)
+	assert.Equal(t, *usd(2500), order.Order.Total)
+	assert.Equal(t, large.ID, *order.Order.VariantID)
+	assert.Equal(t, "TS-L-BLUE", order.Order.SKU)
+	assert.Equal(t, 0, order.Variant.Stock)
+	assert.Equal(t, 4, order.Product.Stock)
+	assert.Equal(t, 4, productStock(t, 1))
+
+	w = performJSON(r, "POST", "/orders", userToken, models.CreateOrderRequest{ProductID: 1, VariantID: small.ID, Quantity: 1})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &order))
+	assert.Equal(t, *usd(9999), order.Order.Price, "variants without a price sell at the product price")
+
+	// Products without variants are unaffected
+	w = performJSON(r, "POST", "/orders", userToken, models.CreateOrderRequest{ProductID: 2, Quantity: 1})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, 4, productStock(t, 2))
+
+	// Restocking, price removal and deletion keep the product stock in sync
+	stock = 10
+	w = performJSON(r, "PUT", fmt.Sprintf("/products/1/variants/%d", large.ID), adminToken, models.UpdateVariantRequest{Stock: &stock, Price: usd(0)})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &large))
+	assert.Nil(t, large.Price)
+	assert.Equal(t, 13, productStock(t, 1))
+
+	sku := "TS-L-BLUE"
+	w = performJSON(r, "PUT", fmt.Sprintf("/products/1/variants/%d", small.ID), adminToken, models.UpdateVariantRequest{SKU: &sku})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = performJSON(r, "DELETE", fmt.Sprintf("/products/2/variants/%d", large.ID), adminToken, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = performJSON(r, "DELETE", fmt.Sprintf("/products/1/variants/%d", large.ID), adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 3, productStock(t, 1))
+
+	// Past orders keep the variant they were placed for
+	w = performJSON(r, "GET", fmt.Sprintf("/orders/%d", order.Order.ID-1), userToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var details models.OrderWithDetails
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &details))
+	assert.Equal(t, "TS-L-BLUE", details.SKU)
+}
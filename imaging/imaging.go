@@ -0,0 +1,65 @@
+// Package imaging scales images down for thumbnails.
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Fit scales src down so that neither side exceeds maxSide, keeping the
+// aspect ratio. Images that already fit are returned as they are.
+func Fit(src image.Image, maxSide int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSide && height <= maxSide {
+		return src
+	}
+
+	dstWidth, dstHeight := maxSide, maxSide
+	if width > height {
+		dstHeight = max(1, height*maxSide/width)
+	} else {
+		dstWidth = max(1, width*maxSide/height)
+	}
+	return resize(src, dstWidth, dstHeight)
+}
+
+// resize scales by averaging the source pixels covered by each destination
+// pixel. Colors are premultiplied by alpha so transparent pixels do not
+// bleed into their neighbours.
+func resize(src image.Image, width, height int) *image.RGBA {
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	srcWidth, srcHeight := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := max(y0+1, (y+1)*srcHeight/height)
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := max(x0+1, (x+1)*srcWidth/width)
+
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					pixel := row[sx*4 : sx*4+4]
+					r += int(pixel[0])
+					g += int(pixel[1])
+					b += int(pixel[2])
+					a += int(pixel[3])
+					n++
+				}
+			}
+
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
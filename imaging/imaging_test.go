@@ -0,0 +1,43 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFit(t *testing.T) {
+	// Left half red, right half blue
+	src := image.NewNRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			c := color.NRGBA{R: 255, A: 255}
+			if x >= 200 {
+				c = color.NRGBA{B: 255, A: 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+
+	thumb := Fit(src, 100)
+	assert.Equal(t, image.Rect(0, 0, 100, 50), thumb.Bounds())
+	assert.Equal(t, color.RGBA{R: 255, A: 255}, thumb.At(10, 25))
+	assert.Equal(t, color.RGBA{B: 255, A: 255}, thumb.At(90, 25))
+
+	tall := Fit(image.NewGray(image.Rect(0, 0, 30, 900)), 300)
+	assert.Equal(t, image.Rect(0, 0, 10, 300), tall.Bounds())
+
+	// Extreme aspect ratios keep at least one pixel
+	thin := Fit(image.NewGray(image.Rect(0, 0, 1000, 2)), 100)
+	assert.Equal(t, image.Rect(0, 0, 100, 1), thin.Bounds())
+
+	// Small images are not enlarged
+	small := image.NewGray(image.Rect(0, 0, 50, 20))
+	assert.Same(t, small, Fit(small, 100))
+
+	// Fully transparent pixels stay transparent
+	clear := Fit(image.NewNRGBA(image.Rect(0, 0, 200, 200)), 20)
+	assert.Equal(t, color.RGBA{}, clear.At(5, 5))
+}
@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryMailer(t *testing.T) {
+	m := NewMemoryMailer()
+
+	_, found := m.Last("a@test.com")
+	assert.False(t, found)
+
+	assert.NoError(t, m.Send(Message{To: "a@test.com", Subject: "first"}))
+	assert.NoError(t, m.Send(Message{To: "b@test.com", Subject: "other"}))
+	assert.NoError(t, m.Send(Message{To: "a@test.com", Subject: "second"}))
+
+	msg, found := m.Last("a@test.com")
+	assert.True(t, found)
+	assert.Equal(t, "second", msg.Subject)
+	assert.Len(t, m.Messages(), 3)
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := NewFileMailer(dir, "noreply@test.com")
+
+	err := m.Send(Message{To: "user@test.com", Subject: "Hello", Body: "line one\nline two"})
+	assert.NoError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.True(t, strings.HasSuffix(entries[0].Name(), "-user@test.com.eml"))
+
+	content, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "From: noreply@test.com\r\n")
+	assert.Contains(t, string(content), "Subject: Hello\r\n")
+	assert.Contains(t, string(content), "line one\r\nline two")
+}
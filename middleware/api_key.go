@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyPrefix starts every API key so leaked keys are easy to recognize
+const APIKeyPrefix = "sk_"
+
+// apiKeyLastUsedInterval limits how often last_used_at is written for a key
+const apiKeyLastUsedInterval = time.Minute
+
+// NewAPIKey returns a new API key of the form sk_<prefix>_<secret> together
+// with its visible prefix
+func NewAPIKey() (key, prefix string, err error) {
+	prefixBytes := make([]byte, 4)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	prefix = APIKeyPrefix + hex.EncodeToString(prefixBytes)
+	return prefix + "_" + base64.RawURLEncoding.EncodeToString(secret), prefix, nil
+}
+
+// HashAPIKey returns the SHA-256 hex digest stored in place of an API key
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseAPIKeyScopes splits the comma-separated scopes stored with a key
+func ParseAPIKeyScopes(value string) []models.APIKeyScope {
+	scopes := []models.APIKeyScope{}
+	for _, scope := range strings.Split(value, ",") {
+		if scope != "" {
+			scopes = append(scopes, models.APIKeyScope(scope))
+		}
+	}
+	return scopes
+}
+
+// authenticateAPIKey handles requests sent with "Authorization: ApiKey ...",
+// setting the same context keys as a bearer token
+func authenticateAPIKey(c *gin.Context, key string) {
+	var keyID, userID int
+	var username, email, scopeList string
+	var mfa bool
+	var revokedAt, lastUsedAt sql.NullTime
+	err := database.DB.QueryRow(`
+		SELECT k.id, k.user_id, k.scopes, k.mfa, k.revoked_at, k.last_used_at, u.username, u.email
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = ?
+	`, HashAPIKey(key)).Scan(&keyID, &userID, &scopeList, &mfa, &revokedAt, &lastUsedAt, &username, &email)
+
+	if err == sql.ErrNoRows || (err == nil && revokedAt.Valid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		c.Abort()
+		return
+	}
+
+	account, err := loadActiveAccount(userID)
+	if err == errAccountNotFound {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		c.Abort()
+		return
+	}
+	if err == errAccountSuspended {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account suspended"})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		c.Abort()
+		return
+	}
+
+	scopes := ParseAPIKeyScopes(scopeList)
+	required := models.APIKeyScopeWrite
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions {
+		required = models.APIKeyScopeRead
+	}
+	if !hasScope(scopes, required) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API key lacks the " + string(required) + " scope"})
+		c.Abort()
+		return
+	}
+
+	now := time.Now()
+	if !lastUsedAt.Valid || now.Sub(lastUsedAt.Time) >= apiKeyLastUsedInterval {
+		if _, err := database.DB.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", now, keyID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.Abort()
+			return
+		}
+	}
+
+	c.Set("user_id", userID)
+	c.Set("username", username)
+	c.Set("email", email)
+	c.Set("role", account.role)
+	c.Set("permissions", account.permissions)
+	c.Set("mfa", mfa)
+	c.Set("mfa_required", account.mfaRequired)
+	c.Set("api_key_id", keyID)
+	c.Set("api_key_scopes", scopes)
+
+	c.Next()
+}
+
+// SessionOnly rejects requests authenticated with an API key or made while
+// impersonating, for endpoints that manage the account's credentials
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rejectImpersonation(c) {
+			return
+		}
+
+		if _, ok := c.Get("api_key_id"); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint cannot be used with an API key"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func hasScope(scopes []models.APIKeyScope, scope models.APIKeyScope) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,12 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"net/http"
+	"smarapp-api/database"
 	"smarapp-api/models"
 	"strings"
 	"time"
@@ -10,31 +15,74 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+var (
+	errAccountNotFound  = errors.New("account not found")
+	errAccountSuspended = errors.New("account suspended")
+)
+
 type Claims struct {
-	UserID   int         `json:"user_id"`
-	Username string      `json:"username"`
-	Email    string      `json:"email"`
-	Role     models.Role `json:"role"`
+	UserID    int         `json:"user_id"`
+	Username  string      `json:"username"`
+	Email     string      `json:"email"`
+	Role      models.Role `json:"role"`
+	MFA       bool        `json:"mfa,omitempty"` // Set when the session was started with two-factor authentication
+	SessionID string      `json:"sid,omitempty"` // Login session the token was issued for
+	Actor     *Actor      `json:"act,omitempty"` // Admin behind an impersonation token
 	jwt.RegisteredClaims
 }
 
+// DefaultAccessTokenTTL is the lifetime of access tokens issued by GenerateToken
+const DefaultAccessTokenTTL = 15 * time.Minute
+
 func GenerateToken(user models.User, jwtSecret string) (string, error) {
-	claims := Claims{
+	return GenerateTokenWithTTL(user, jwtSecret, DefaultAccessTokenTTL)
+}
+
+// GenerateTokenWithTTL issues an access token with a unique jti so it can be
+// revoked before it expires.
+func GenerateTokenWithTTL(user models.User, jwtSecret string, ttl time.Duration) (string, error) {
+	claims, err := NewClaims(user, ttl)
+	if err != nil {
+		return "", err
+	}
+	return SignClaims(claims, jwtSecret)
+}
+
+// NewClaims returns the claims of an access token for the user, to be
+// adjusted before signing with SignClaims
+func NewClaims(user models.User, ttl time.Duration) (Claims, error) {
+	jti, err := NewTokenID()
+	if err != nil {
+		return Claims{}, err
+	}
+
+	return Claims{
 		UserID:   user.ID,
 		Username: user.Username,
 		Email:    user.Email,
 		Role:     user.Role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
-	}
+	}, nil
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(jwtSecret))
+// SignClaims signs access token claims with an HS256 secret
+func SignClaims(claims Claims, jwtSecret string) (string, error) {
+	return NewHMACKeySet(jwtSecret).Sign(claims)
 }
 
+// AuthMiddleware verifies HS256 tokens signed with jwtSecret
 func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
+	return AuthMiddlewareWithKeys(NewHMACKeySet(jwtSecret))
+}
+
+// AuthMiddlewareWithKeys verifies tokens against a key set, picking the
+// verification key by the kid header. Requests sent with
+// "Authorization: ApiKey ..." are authenticated with a personal API key instead.
+func AuthMiddlewareWithKeys(keys *KeySet) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -43,6 +91,11 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 			return
 		}
 
+		if apiKey, ok := strings.CutPrefix(authHeader, "ApiKey "); ok {
+			authenticateAPIKey(c, apiKey)
+			return
+		}
+
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		if tokenString == authHeader {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Bearer token required"})
@@ -51,28 +104,119 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 		}
 
 		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(jwtSecret), nil
-		})
-
-		if err != nil || !token.Valid {
+		if err := keys.Parse(tokenString, claims); err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
+		if claims.ID != "" {
+			revoked, err := IsTokenRevoked(claims.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				c.Abort()
+				return
+			}
+			if revoked {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+				c.Abort()
+				return
+			}
+		}
+
+		// The role comes from the database so role changes and suspensions apply immediately
+		account, err := loadActiveAccount(claims.UserID)
+		if err == errAccountNotFound {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+		if err == errAccountSuspended {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account suspended"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.Abort()
+			return
+		}
+
+		// Tokens issued before a password change are no longer accepted
+		if account.tokensValidAfter.Valid && claims.IssuedAt != nil && claims.IssuedAt.Time.Before(account.tokensValidAfter.Time) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
+		// Impersonation ends as soon as the admin loses the permission, and
+		// the impersonated user's permissions never apply
+		if claims.Actor != nil {
+			allowed, err := checkImpersonator(claims.Actor)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				c.Abort()
+				return
+			}
+			if !allowed {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Impersonation is no longer allowed"})
+				c.Abort()
+				return
+			}
+			account.permissions = []models.Permission{}
+			account.mfaRequired = false
+		}
+
+		// Signing a session out rejects its access tokens right away
+		if claims.SessionID != "" {
+			err := touchSession(c, claims.SessionID, claims.UserID)
+			if err == errSessionRevoked {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+				c.Abort()
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				c.Abort()
+				return
+			}
+		}
+
 		// Set user information in context
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("email", claims.Email)
-		c.Set("role", claims.Role)
+		c.Set("role", account.role)
+		c.Set("permissions", account.permissions)
+		c.Set("jti", claims.ID)
+		c.Set("mfa", claims.MFA)
+		c.Set("mfa_required", account.mfaRequired)
+		c.Set("session_id", claims.SessionID)
+		if claims.ExpiresAt != nil {
+			c.Set("token_expires_at", claims.ExpiresAt.Time)
+		}
+		if claims.Actor != nil {
+			c.Set("impersonator_id", claims.Actor.UserID)
+		}
 
 		c.Next()
+
+		// Everything done while impersonating is audited
+		if claims.Actor != nil {
+			recordImpersonatedRequest(c, claims.Actor.UserID, claims.UserID)
+		}
 	}
 }
 
+// AdminMiddleware only lets the admin role through.
+//
+// Deprecated: use RequirePermission, which also admits custom roles.
 func AdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if rejectImpersonation(c) {
+			return
+		}
+
 		role, exists := c.Get("role")
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User role not found"})
@@ -86,6 +230,147 @@ func AdminMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if !allowPrivilegedAccess(c) {
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission lets requests through whose role holds all of the given
+// permissions
+func RequirePermission(permissions ...models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rejectImpersonation(c) {
+			return
+		}
+
+		if _, exists := c.Get("permissions"); !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User permissions not found"})
+			c.Abort()
+			return
+		}
+
+		for _, permission := range permissions {
+			if !HasPermission(c, permission) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Permission required: " + string(permission)})
+				c.Abort()
+				return
+			}
+		}
+
+		if !allowPrivilegedAccess(c) {
+			return
+		}
+
 		c.Next()
 	}
 }
+
+// HasPermission reports whether the authenticated user's role holds the permission
+func HasPermission(c *gin.Context, permission models.Permission) bool {
+	granted, _ := c.Get("permissions")
+	permissions, _ := granted.([]models.Permission)
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// allowPrivilegedAccess applies the extra requirements of admin endpoints:
+// API keys need the admin scope and, when required, the session must have
+// been started with two-factor authentication. It aborts the request otherwise.
+func allowPrivilegedAccess(c *gin.Context) bool {
+	if scopes, ok := c.Get("api_key_scopes"); ok && !hasScope(scopes.([]models.APIKeyScope), models.APIKeyScopeAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API key lacks the admin scope"})
+		c.Abort()
+		return false
+	}
+
+	if c.GetBool("mfa_required") && !c.GetBool("mfa") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication required for admin access"})
+		c.Abort()
+		return false
+	}
+
+	return true
+}
+
+// NewTokenID returns a random identifier suitable for a jti claim
+func NewTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// RevokeToken adds an access token to the denylist until it expires
+func RevokeToken(jti string, userID int, expiresAt time.Time) error {
+	// Entries for tokens that have expired on their own are no longer needed
+	if _, err := database.DB.Exec("DELETE FROM revoked_tokens WHERE expires_at < ?", time.Now()); err != nil {
+		return err
+	}
+
+	_, err := database.DB.Exec(
+		"INSERT OR IGNORE INTO revoked_tokens (jti, user_id, expires_at, revoked_at) VALUES (?, ?, ?, ?)",
+		jti, userID, expiresAt, time.Now(),
+	)
+	return err
+}
+
+// IsTokenRevoked reports whether the access token with the given jti was revoked
+func IsTokenRevoked(jti string) (bool, error) {
+	var found string
+	err := database.DB.QueryRow("SELECT jti FROM revoked_tokens WHERE jti = ?", jti).Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+type accountState struct {
+	role             models.Role
+	permissions      []models.Permission
+	tokensValidAfter sql.NullTime
+	mfaRequired      bool // Admin endpoints need a two-factor session
+}
+
+// loadActiveAccount returns the current state of a user that is neither
+// deleted nor suspended
+func loadActiveAccount(userID int) (accountState, error) {
+	var account accountState
+	var suspendedAt sql.NullTime
+	var requireAdminTwoFactor sql.NullString
+	err := database.DB.QueryRow(
+		"SELECT role, suspended_at, tokens_valid_after, (SELECT value FROM settings WHERE key = ?) FROM users WHERE id = ? AND deleted_at IS NULL",
+		database.SettingRequireAdminTwoFactor, userID,
+	).Scan(&account.role, &suspendedAt, &account.tokensValidAfter, &requireAdminTwoFactor)
+
+	if err == sql.ErrNoRows {
+		return account, errAccountNotFound
+	}
+	if err != nil {
+		return account, err
+	}
+	if suspendedAt.Valid {
+		return account, errAccountSuspended
+	}
+
+	// Permissions are resolved on every request so role changes apply immediately
+	account.permissions, err = database.RolePermissions(account.role)
+	if err != nil {
+		return account, err
+	}
+
+	// Any role holding permissions counts as an admin for the two-factor requirement
+	account.mfaRequired = len(account.permissions) > 0 && requireAdminTwoFactor.String == "true"
+
+	return account, nil
+}
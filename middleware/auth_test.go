@@ -1,10 +1,14 @@
 package middleware
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"smarapp-api/database"
 	"smarapp-api/models"
+	"smarapp-api/testutil"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -28,6 +32,8 @@ func TestGenerateToken(t *testing.T) {
 
 func TestAuthMiddleware_ValidToken(t *testing.T) {
 	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
 
 	// Create a test user and token
 	user := models.User{
@@ -70,6 +76,96 @@ func TestAuthMiddleware_ValidToken(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "test@example.com")
 }
 
+func TestAuthMiddleware_RevokedToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	user := models.User{
+		ID:       1,
+		Username: "testuser",
+		Email:    "test@example.com",
+		Role:     models.RoleUser,
+	}
+
+	jwtSecret := "test-secret"
+	token, err := GenerateToken(user, jwtSecret)
+	assert.NoError(t, err)
+
+	r := gin.New()
+	r.Use(AuthMiddleware(jwtSecret))
+	r.GET("/test", func(c *gin.Context) {
+		jti, _ := c.Get("jti")
+		c.JSON(http.StatusOK, gin.H{"jti": jti})
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var body map[string]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.NotEmpty(t, body["jti"])
+
+	// Revoke the token and try again
+	err = RevokeToken(body["jti"], user.ID, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+
+	req = httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Token has been revoked")
+}
+
+func TestAuthMiddleware_AccountState(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	jwtSecret := "test-secret"
+
+	// Token claims say admin, but the database role wins
+	token, err := GenerateToken(models.User{ID: 2, Username: "user", Email: "user@test.com", Role: models.RoleAdmin}, jwtSecret)
+	assert.NoError(t, err)
+
+	r := gin.New()
+	r.Use(AuthMiddleware(jwtSecret))
+	r.GET("/test", func(c *gin.Context) {
+		role, _ := c.Get("role")
+		c.JSON(http.StatusOK, gin.H{"role": role})
+	})
+
+	request := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"role":"user"`)
+
+	// Suspended accounts are rejected
+	_, err = database.DB.Exec("UPDATE users SET suspended_at = ? WHERE id = 2", time.Now())
+	assert.NoError(t, err)
+	w = request()
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Account suspended")
+
+	// Deleted accounts are rejected
+	_, err = database.DB.Exec("UPDATE users SET suspended_at = NULL, deleted_at = ? WHERE id = 2", time.Now())
+	assert.NoError(t, err)
+	w = request()
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
 func TestAuthMiddleware_NoToken(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -187,3 +283,50 @@ func TestAdminMiddleware_NoRole(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 	assert.Contains(t, w.Body.String(), "User role not found")
 }
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	jwtSecret := "test-secret"
+
+	r := gin.New()
+	r.Use(AuthMiddleware(jwtSecret))
+	r.GET("/test", RequirePermission(models.PermissionProductsWrite, models.PermissionOrdersReadAll), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "access granted"})
+	})
+
+	request := func(user models.User) *httptest.ResponseRecorder {
+		token, err := GenerateToken(user, jwtSecret)
+		assert.NoError(t, err)
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	admin := models.User{ID: 1, Username: "admin", Email: "admin@test.com", Role: models.RoleAdmin}
+	user := models.User{ID: 2, Username: "user", Email: "user@test.com", Role: models.RoleUser}
+
+	// Built-in roles are seeded with their default permissions
+	assert.Equal(t, http.StatusOK, request(admin).Code)
+	w := request(user)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Permission required: products:write")
+
+	// A custom role needs every listed permission, and changes apply immediately
+	_, err := database.DB.Exec("INSERT INTO roles (name) VALUES ('catalog')")
+	assert.NoError(t, err)
+	_, err = database.DB.Exec("INSERT INTO role_permissions (role, permission) VALUES ('catalog', 'products:write')")
+	assert.NoError(t, err)
+	_, err = database.DB.Exec("UPDATE users SET role = 'catalog' WHERE id = 2")
+	assert.NoError(t, err)
+	w = request(user)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Permission required: orders:read_all")
+
+	_, err = database.DB.Exec("INSERT INTO role_permissions (role, permission) VALUES ('catalog', 'orders:read_all')")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, request(user).Code)
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"smarapp-api/audit"
+	"smarapp-api/database"
+	"smarapp-api/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Actor identifies the admin behind an impersonation token (the "act" claim)
+type Actor struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// Impersonation event actions
+const (
+	ImpersonationActionStart   = "start"
+	ImpersonationActionRequest = "request"
+)
+
+// IsImpersonating reports whether the request was made by an admin
+// impersonating the authenticated user
+func IsImpersonating(c *gin.Context) bool {
+	_, ok := c.Get("impersonator_id")
+	return ok
+}
+
+// rejectImpersonation aborts requests made while impersonating, for endpoints
+// an admin must not use on behalf of a customer
+func rejectImpersonation(c *gin.Context) bool {
+	if !IsImpersonating(c) {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint cannot be used while impersonating a user"})
+	c.Abort()
+	return true
+}
+
+// checkImpersonator verifies that the admin behind an impersonation token may
+// still impersonate users
+func checkImpersonator(actor *Actor) (bool, error) {
+	account, err := loadActiveAccount(actor.UserID)
+	if err == errAccountNotFound || err == errAccountSuspended {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, permission := range account.permissions {
+		if permission == models.PermissionUsersImpersonate {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RecordImpersonationEvent adds an entry to the impersonation audit log. db
+// is a transaction when the event is written together with other changes.
+func RecordImpersonationEvent(db audit.Execer, c *gin.Context, adminID, userID int, action string, status int) error {
+	_, err := db.Exec(
+		"INSERT INTO impersonation_events (admin_id, user_id, action, method, path, status, ip_address, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		adminID, userID, action, c.Request.Method, c.Request.URL.Path, status, c.ClientIP(), time.Now(),
+	)
+	return err
+}
+
+// recordImpersonatedRequest logs a request made while impersonating once it
+// has been handled. The response is already sent, so failures are only logged.
+func recordImpersonatedRequest(c *gin.Context, adminID, userID int) {
+	if err := RecordImpersonationEvent(database.DB, c, adminID, userID, ImpersonationActionRequest, c.Writer.Status()); err != nil {
+		log.Printf("Failed to record impersonated request of admin %d as user %d: %v", adminID, userID, err)
+	}
+}
@@ -0,0 +1,244 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSAKeyBits is the smallest RSA modulus accepted for signing keys
+const minRSAKeyBits = 2048
+
+// Key is an asymmetric key identified by the kid header of the tokens it signs
+type Key struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer // nil for verification-only keys
+	PublicKey  crypto.PublicKey
+}
+
+// KeySet holds the key used to sign new tokens and every key accepted when
+// verifying them, so keys can be rotated without invalidating live tokens.
+// HS256 tokens signed with the shared secret are accepted while a secret is
+// configured, which allows migrating from the HS256-only setup.
+type KeySet struct {
+	signing    *Key // nil when signing with the HS256 secret
+	keys       map[string]*Key
+	hmacSecret []byte
+}
+
+// NewHMACKeySet signs and verifies tokens with a shared HS256 secret
+func NewHMACKeySet(secret string) *KeySet {
+	return &KeySet{keys: map[string]*Key{}, hmacSecret: []byte(secret)}
+}
+
+// LoadKeySet loads every *.pem file of dir as a key named after the file
+// (the kid). Files may hold a PKCS#8 or PKCS#1 private key (RSA or Ed25519)
+// or a PKIX public key for retired keys that should only verify tokens.
+// signingKeyID selects the signing key and may be empty when the directory
+// holds exactly one private key. An empty hmacSecret disables HS256.
+func LoadKeySet(dir, signingKeyID, hmacSecret string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	ks := &KeySet{keys: map[string]*Key{}}
+	if hmacSecret != "" {
+		ks.hmacSecret = []byte(hmacSecret)
+	}
+
+	var privateKeys []*Key
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := parseKey(strings.TrimSuffix(filepath.Base(path), ".pem"), data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		ks.keys[key.ID] = key
+		if key.PrivateKey != nil {
+			privateKeys = append(privateKeys, key)
+		}
+	}
+
+	switch {
+	case signingKeyID != "":
+		key, ok := ks.keys[signingKeyID]
+		if !ok || key.PrivateKey == nil {
+			return nil, fmt.Errorf("no private key %q in %s", signingKeyID, dir)
+		}
+		ks.signing = key
+	case len(privateKeys) == 1:
+		ks.signing = privateKeys[0]
+	case len(privateKeys) == 0:
+		return nil, fmt.Errorf("no private key in %s", dir)
+	default:
+		return nil, errors.New("several private keys found, set the signing key ID")
+	}
+
+	return ks, nil
+}
+
+func parseKey(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{ID: id}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.PrivateKey, key.PublicKey = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.PublicKey = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.PrivateKey, key.PublicKey = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.PublicKey = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	if rsaKey, ok := key.PublicKey.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("RSA keys must be at least %d bits", minRSAKeyBits)
+	}
+
+	return key, nil
+}
+
+// Sign signs claims with the current signing key
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if ks.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.hmacSecret)
+	}
+
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+	return token.SignedString(ks.signing.PrivateKey)
+}
+
+// Parse verifies a token against the key set and fills claims
+func (ks *KeySet) Parse(tokenString string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, ks.keyfunc, jwt.WithValidMethods([]string{
+		jwt.SigningMethodHS256.Alg(),
+		jwt.SigningMethodRS256.Alg(),
+		jwt.SigningMethodEdDSA.Alg(),
+	}))
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
+// keyfunc picks the verification key by the kid header
+func (ks *KeySet) keyfunc(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+		if ks.hmacSecret == nil {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		return ks.hmacSecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok || key.Method.Alg() != token.Method.Alg() {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key.PublicKey, nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public verification keys. The HS256 secret is never exposed.
+func (ks *KeySet) JWKS() JWKSet {
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, id := range ids {
+		key := ks.keys[id]
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+
+		switch pub := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+// JWKSHandler serves the public keys of the key set so other services can
+// verify our tokens, typically at /.well-known/jwks.json
+func JWKSHandler(ks *KeySet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, ks.JWKS())
+	}
+}
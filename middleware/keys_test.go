@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"smarapp-api/models"
+	"smarapp-api/testutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func writePrivateKey(t *testing.T, dir, kid string, key crypto.Signer) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600))
+}
+
+func writePublicKey(t *testing.T, dir, kid string, key crypto.PublicKey) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	assert.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o644))
+}
+
+func testClaims(t *testing.T) Claims {
+	claims, err := NewClaims(models.User{ID: 1, Username: "admin", Email: "admin@test.com", Role: models.RoleAdmin}, time.Minute)
+	assert.NoError(t, err)
+	return claims
+}
+
+func TestKeySet_SignAndRotate(t *testing.T) {
+	dir := t.TempDir()
+
+	_, oldKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	writePrivateKey(t, dir, "old", oldKey)
+	writePrivateKey(t, dir, "new", newKey)
+
+	// Several private keys need an explicit signing key
+	_, err = LoadKeySet(dir, "", "")
+	assert.Error(t, err)
+	_, err = LoadKeySet(dir, "missing", "")
+	assert.Error(t, err)
+
+	before, err := LoadKeySet(dir, "old", "")
+	assert.NoError(t, err)
+	oldToken, err := before.Sign(testClaims(t))
+	assert.NoError(t, err)
+
+	// After switching the signing key, tokens from the old key still verify
+	after, err := LoadKeySet(dir, "new", "")
+	assert.NoError(t, err)
+	newToken, err := after.Sign(testClaims(t))
+	assert.NoError(t, err)
+
+	header, _, err := jwt.NewParser().ParseUnverified(newToken, &Claims{})
+	assert.NoError(t, err)
+	assert.Equal(t, "new", header.Header["kid"])
+	assert.Equal(t, "RS256", header.Method.Alg())
+
+	assert.NoError(t, after.Parse(oldToken, &Claims{}))
+	assert.NoError(t, after.Parse(newToken, &Claims{}))
+
+	// Retired keys can be kept as public keys only
+	assert.NoError(t, os.Remove(filepath.Join(dir, "old.pem")))
+	writePublicKey(t, dir, "old", oldKey.Public())
+	retired, err := LoadKeySet(dir, "", "")
+	assert.NoError(t, err)
+	assert.NoError(t, retired.Parse(oldToken, &Claims{}))
+
+	// Removing the key invalidates its tokens
+	assert.NoError(t, os.Remove(filepath.Join(dir, "old.pem")))
+	removed, err := LoadKeySet(dir, "", "")
+	assert.NoError(t, err)
+	assert.Error(t, removed.Parse(oldToken, &Claims{}))
+	assert.NoError(t, removed.Parse(newToken, &Claims{}))
+}
+
+func TestKeySet_HS256Migration(t *testing.T) {
+	dir := t.TempDir()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	writePrivateKey(t, dir, "k1", key)
+
+	legacyToken, err := SignClaims(testClaims(t), "test-secret")
+	assert.NoError(t, err)
+
+	migrating, err := LoadKeySet(dir, "", "test-secret")
+	assert.NoError(t, err)
+	assert.NoError(t, migrating.Parse(legacyToken, &Claims{}))
+
+	migrated, err := LoadKeySet(dir, "", "")
+	assert.NoError(t, err)
+	assert.Error(t, migrated.Parse(legacyToken, &Claims{}))
+
+	// A token claiming an asymmetric algorithm with an unknown kid is rejected
+	forged := jwt.NewWithClaims(jwt.SigningMethodEdDSA, testClaims(t))
+	forged.Header["kid"] = "unknown"
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	forgedToken, err := forged.SignedString(otherKey)
+	assert.NoError(t, err)
+	assert.Error(t, migrating.Parse(forgedToken, &Claims{}))
+}
+
+func TestKeySet_RejectsWeakRSAKeys(t *testing.T) {
+	dir := t.TempDir()
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	writePrivateKey(t, dir, "weak", key)
+
+	_, err = LoadKeySet(dir, "", "")
+	assert.Error(t, err)
+}
+
+func TestJWKSHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	writePrivateKey(t, dir, "a-rsa", rsaKey)
+	writePrivateKey(t, dir, "b-ed", edKey)
+
+	keys, err := LoadKeySet(dir, "b-ed", "test-secret")
+	assert.NoError(t, err)
+
+	r := gin.New()
+	r.GET("/.well-known/jwks.json", JWKSHandler(keys))
+
+	req := httptest.NewRequest("GET", "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "test-secret")
+	assert.NotContains(t, w.Body.String(), `"d"`)
+
+	var set JWKSet
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &set))
+	assert.Len(t, set.Keys, 2)
+
+	assert.Equal(t, "a-rsa", set.Keys[0].Kid)
+	assert.Equal(t, "RSA", set.Keys[0].Kty)
+	assert.Equal(t, "RS256", set.Keys[0].Alg)
+	assert.Equal(t, "AQAB", set.Keys[0].E)
+	assert.NotEmpty(t, set.Keys[0].N)
+
+	assert.Equal(t, "b-ed", set.Keys[1].Kid)
+	assert.Equal(t, "OKP", set.Keys[1].Kty)
+	assert.Equal(t, "Ed25519", set.Keys[1].Crv)
+	assert.Equal(t, "EdDSA", set.Keys[1].Alg)
+	assert.False(t, strings.ContainsAny(set.Keys[1].X, "+/="))
+	assert.Len(t, set.Keys[1].X, 43)
+}
+
+func TestAuthMiddlewareWithKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cleanup := testutil.SetupTestDBWithData(t)
+	defer cleanup()
+
+	dir := t.TempDir()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	writePrivateKey(t, dir, "k1", key)
+
+	keys, err := LoadKeySet(dir, "", "test-secret")
+	assert.NoError(t, err)
+
+	r := gin.New()
+	r.Use(AuthMiddlewareWithKeys(keys))
+	r.GET("/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetInt("user_id")})
+	})
+
+	signed, err := keys.Sign(testClaims(t))
+	assert.NoError(t, err)
+	legacy, err := SignClaims(testClaims(t), "test-secret")
+	assert.NoError(t, err)
+	wrongSecret, err := SignClaims(testClaims(t), "other-secret")
+	assert.NoError(t, err)
+
+	for token, expected := range map[string]int{
+		signed:      http.StatusOK,
+		legacy:      http.StatusOK,
+		wrongSecret: http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, expected, w.Code)
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"database/sql"
+	"errors"
+	"smarapp-api/database"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sessionLastSeenInterval limits how often last_seen_at is written for a session
+const sessionLastSeenInterval = time.Minute
+
+// maxUserAgentLength caps the stored user agent of a session
+const maxUserAgentLength = 255
+
+var errSessionRevoked = errors.New("session revoked")
+
+// SessionDevice returns the user agent and client IP recorded for sessions
+// started by the request
+func SessionDevice(c *gin.Context) (userAgent, ipAddress string) {
+	userAgent = c.Request.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return userAgent, c.ClientIP()
+}
+
+// touchSession checks that a session of the user is still active and records
+// the request as its latest activity
+func touchSession(c *gin.Context, sessionID string, userID int) error {
+	var revokedAt, lastSeenAt sql.NullTime
+	err := database.DB.QueryRow(
+		"SELECT revoked_at, last_seen_at FROM sessions WHERE id = ? AND user_id = ?",
+		sessionID, userID,
+	).Scan(&revokedAt, &lastSeenAt)
+	if err == sql.ErrNoRows {
+		return errSessionRevoked
+	}
+	if err != nil {
+		return err
+	}
+	if revokedAt.Valid {
+		return errSessionRevoked
+	}
+
+	now := time.Now()
+	if lastSeenAt.Valid && now.Sub(lastSeenAt.Time) < sessionLastSeenInterval {
+		return nil
+	}
+
+	userAgent, ipAddress := SessionDevice(c)
+	_, err = database.DB.Exec(
+		"UPDATE sessions SET last_seen_at = ?, ip_address = ?, user_agent = ? WHERE id = ?",
+		now, ipAddress, userAgent, sessionID,
+	)
+	return err
+}
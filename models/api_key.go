@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+type APIKeyScope string
+
+const (
+	APIKeyScopeRead  APIKeyScope = "read"  // GET requests
+	APIKeyScopeWrite APIKeyScope = "write" // Requests that change data
+	APIKeyScopeAdmin APIKeyScope = "admin" // Admin endpoints, for admin accounts only
+)
+
+// IsValid reports whether the scope is one of the known scopes
+func (s APIKeyScope) IsValid() bool {
+	return s == APIKeyScopeRead || s == APIKeyScopeWrite || s == APIKeyScopeAdmin
+}
+
+type APIKey struct {
+	ID         int           `json:"id" db:"id"`
+	Name       string        `json:"name" db:"name"`
+	Prefix     string        `json:"prefix" db:"prefix"` // Visible start of the key, to tell keys apart
+	Scopes     []APIKeyScope `json:"scopes" db:"scopes"`
+	LastUsedAt *time.Time    `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt  *time.Time    `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt  time.Time     `json:"created_at" db:"created_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string        `json:"name" binding:"required,max=100"`
+	Scopes []APIKeyScope `json:"scopes" binding:"required,min=1"`
+}
+
+type CreateAPIKeyResponse struct {
+	Key    string `json:"key"` // Only returned once, store it safely
+	APIKey APIKey `json:"api_key"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// AuditChange is the value of a field before and after a change
+type AuditChange struct {
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+type AuditEvent struct {
+	ID             int                    `json:"id" db:"id"`
+	ActorID        *int                   `json:"actor_id,omitempty" db:"actor_id"`
+	ImpersonatorID *int                   `json:"impersonator_id,omitempty" db:"impersonator_id"` // Admin acting as the actor
+	Action         string                 `json:"action" db:"action"`                             // e.g. "product.update"
+	TargetType     string                 `json:"target_type" db:"target_type"`
+	TargetID       string                 `json:"target_id" db:"target_id"`
+	Changes        map[string]AuditChange `json:"changes" db:"changes"`
+	RequestID      string                 `json:"request_id" db:"request_id"`
+	IPAddress      string                 `json:"ip_address" db:"ip_address"`
+	CreatedAt      time.Time              `json:"created_at" db:"created_at"`
+}
+
+type AuditEventListResponse struct {
+	Events   []AuditEvent `json:"events"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"page_size"`
+	Total    int          `json:"total"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"regexp"
+	"time"
+)
+
+var categorySlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// IsValidCategorySlug reports whether slug is made of lowercase letters and
+// digits separated by single hyphens
+func IsValidCategorySlug(slug string) bool {
+	return categorySlugPattern.MatchString(slug)
+}
+
+type Category struct {
+	ID        int       `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Slug      string    `json:"slug" db:"slug"`
+	ParentID  *int      `json:"parent_id" db:"parent_id"` // Null for top-level categories
+	SortOrder int       `json:"sort_order" db:"sort_order"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// CategoryTree is a category with its subcategories, ordered by sort order
+// and name
+type CategoryTree struct {
+	Category
+	Children []CategoryTree `json:"children"`
+}
+
+type CreateCategoryRequest struct {
+	Name      string `json:"name" binding:"required,min=1,max=100"`
+	Slug      string `json:"slug,omitempty" binding:"omitempty,max=100"` // Derived from the name if empty
+	ParentID  *int   `json:"parent_id,omitempty"`
+	SortOrder int    `json:"sort_order,omitempty"`
+}
+
+type UpdateCategoryRequest struct {
+	Name      *string `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	Slug      *string `json:"slug,omitempty" binding:"omitempty,min=1,max=100"`
+	ParentID  *int    `json:"parent_id,omitempty"` // 0 moves the category to the top level
+	SortOrder *int    `json:"sort_order,omitempty"`
+}
+
+type Tag struct {
+	ID        int       `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Products  int       `json:"products"` // Number of tagged products
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type TagRequest struct {
+	Name string `json:"name" binding:"required,min=1,max=30"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+type ImpersonationResponse struct {
+	Token        string `json:"token"`
+	ExpiresIn    int64  `json:"expires_in"` // Token lifetime in seconds; impersonation tokens cannot be refreshed
+	User         User   `json:"user"`
+	Impersonator User   `json:"impersonator"`
+}
+
+type ImpersonationEvent struct {
+	ID        int       `json:"id" db:"id"`
+	AdminID   int       `json:"admin_id" db:"admin_id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	Action    string    `json:"action" db:"action"` // "start" or "request"
+	Method    string    `json:"method" db:"method"`
+	Path      string    `json:"path" db:"path"`
+	Status    int       `json:"status" db:"status"`
+	IPAddress string    `json:"ip_address" db:"ip_address"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type ImpersonationEventListResponse struct {
+	Events   []ImpersonationEvent `json:"events"`
+	Page     int                  `json:"page"`
+	PageSize int                  `json:"page_size"`
+	Total    int                  `json:"total"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// MovementKind says why stock changed
+type MovementKind string
+
+const (
+	MovementOpening    MovementKind = "opening" // Stock that existed before the ledger
+	MovementReceipt    MovementKind = "receipt"
+	MovementSale       MovementKind = "sale"
+	MovementAdjustment MovementKind = "adjustment"
+	MovementReturn     MovementKind = "return"
+)
+
+// InventoryMovement is an entry of the inventory ledger. Quantity is signed:
+// receipts and returns add stock, sales take it.
+type InventoryMovement struct {
+	ID        int          `json:"id" db:"id"`
+	ProductID int          `json:"product_id" db:"product_id"`
+	VariantID *int         `json:"variant_id,omitempty" db:"variant_id"`
+	Kind      MovementKind `json:"kind" db:"kind"`
+	Quantity  int          `json:"quantity" db:"quantity"`
+	Reason    string       `json:"reason" db:"reason"`
+	ActorID   *int         `json:"actor_id,omitempty" db:"actor_id"`
+	OrderID   *int         `json:"order_id,omitempty" db:"order_id"`
+	CreatedAt time.Time    `json:"created_at" db:"created_at"`
+}
+
+// InventoryResponse is a page of a product's ledger, newest first, with the
+// stock the ledger adds up to
+type InventoryResponse struct {
+	ProductID   int                 `json:"product_id"`
+	Stock       int                 `json:"stock"`
+	LedgerStock int                 `json:"ledger_stock"` // Differs from stock only if they drifted apart
+	Movements   []InventoryMovement `json:"movements"`
+	Page        int                 `json:"page"`
+	PageSize    int                 `json:"page_size"`
+	Total       int                 `json:"total"`
+}
+
+// CreateInventoryMovementRequest records stock received, returned or
+// corrected by hand. Sales are recorded by orders.
+type CreateInventoryMovementRequest struct {
+	Kind      MovementKind `json:"kind" binding:"required,oneof=receipt adjustment return"`
+	Quantity  int          `json:"quantity" binding:"required"` // Positive for receipts and returns
+	VariantID *int         `json:"variant_id,omitempty"`        // Required for products with variants
+	Reason    string       `json:"reason" binding:"required,max=200"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+type Invite struct {
+	ID        int        `json:"id" db:"id"`
+	Role      Role       `json:"role" db:"role"`
+	Email     string     `json:"email,omitempty" db:"email"` // Optional, restricts who can redeem the invite
+	CreatedBy int        `json:"created_by" db:"created_by"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+	UsedBy    *int       `json:"used_by,omitempty" db:"used_by"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+type CreateInviteRequest struct {
+	Role           Role   `json:"role" binding:"required"`
+	Email          string `json:"email,omitempty" binding:"omitempty,email"`
+	ExpiresInHours int    `json:"expires_in_hours,omitempty" binding:"omitempty,gt=0,lte=720"` // Optional, defaults to 72
+}
+
+type CreateInviteResponse struct {
+	Code   string `json:"code"` // Only returned once, store it safely
+	Invite Invite `json:"invite"`
+}
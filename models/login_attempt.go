@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type LoginAttempt struct {
+	ID        int       `json:"id" db:"id"`
+	Email     string    `json:"email" db:"email"`
+	IPAddress string    `json:"ip_address" db:"ip_address"`
+	UserID    *int      `json:"user_id,omitempty" db:"user_id"`
+	Success   bool      `json:"success" db:"success"`
+	Reason    string    `json:"reason,omitempty" db:"reason"` // Why a failed attempt was rejected
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type LoginAttemptListResponse struct {
+	Attempts []LoginAttempt `json:"attempts"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"page_size"`
+	Total    int            `json:"total"`
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Currency is an ISO 4217 currency code
+type Currency string
+
+// DefaultCurrency is the currency of prices stored before products declared
+// their own
+const DefaultCurrency Currency = "USD"
+
+// currencyExponents holds the number of decimals of each ISO 4217 currency
+var currencyExponents = func() map[Currency]int {
+	byExponent := map[int]string{
+		0: "BIF CLP DJF GNF ISK JPY KMF KRW PYG RWF UGX UYI VND VUV XAF XOF XPF",
+		2: "AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BMD BND BOB BOV BRL BSD BTN BWP BYN BZD " +
+			"CAD CDF CHE CHF CHW CNY COP COU CRC CUP CVE CZK DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP " +
+			"GMD GTQ GYD HKD HNL HTG HUF IDR ILS INR IRR JMD KES KGS KHR KPW KYD KZT LAK LBP LKR LRD LSL MAD MDL " +
+			"MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MXV MYR MZN NAD NGN NIO NOK NPR NZD PAB PEN PGK PHP PKR PLN " +
+			"QAR RON RSD RUB SAR SBD SCR SDG SEK SGD SHP SLE SOS SRD SSP STN SVC SYP SZL THB TJS TMT TOP TRY TTD " +
+			"TWD TZS UAH USD USN UYU UZS VED VES WST XCD XCG YER ZAR ZMW ZWG",
+		3: "BHD IQD JOD KWD LYD OMR TND",
+		4: "CLF UYW",
+	}
+	exponents := map[Currency]int{}
+	for exponent, codes := range byExponent {
+		for _, code := range strings.Fields(codes) {
+			exponents[Currency(code)] = exponent
+		}
+	}
+	return exponents
+}()
+
+// Valid reports whether c is a known ISO 4217 code
+func (c Currency) Valid() bool {
+	_, ok := currencyExponents[c]
+	return ok
+}
+
+// Exponent is the number of decimals of the currency's minor unit, 2 for
+// cents
+func (c Currency) Exponent() int {
+	return currencyExponents[c]
+}
+
+var ErrAmountOverflow = errors.New("amount is too large")
+
+// Money is an exact amount in the minor unit of its currency, so 12.50 USD
+// is stored as 1250. In JSON it is {"amount": "12.50", "currency": "USD"},
+// where the amount may also be sent as a number.
+type Money struct {
+	Amount   int64    `json:"amount" swaggertype:"string" example:"12.50"`
+	Currency Currency `json:"currency" swaggertype:"string" example:"USD"`
+}
+
+// ParseMoney reads a decimal amount such as "12.5" in the given currency. It
+// refuses amounts with more decimals than the currency has.
+func ParseMoney(amount string, currency Currency) (Money, error) {
+	if !currency.Valid() {
+		return Money{}, fmt.Errorf("unknown currency %q", currency)
+	}
+	exponent := currency.Exponent()
+
+	digits, negative := strings.CutPrefix(amount, "-")
+	whole, fraction, hasPoint := strings.Cut(digits, ".")
+	if whole == "" || (hasPoint && fraction == "") || !isDigits(whole) || !isDigits(fraction) {
+		return Money{}, fmt.Errorf("invalid amount %q, use a decimal such as 12.50", amount)
+	}
+	if len(fraction) > exponent {
+		return Money{}, fmt.Errorf("amount %q has more than %d decimals for %s", amount, exponent, currency)
+	}
+
+	minor, err := strconv.ParseInt(whole+fraction+strings.Repeat("0", exponent-len(fraction)), 10, 64)
+	if err != nil {
+		return Money{}, ErrAmountOverflow
+	}
+	if negative {
+		minor = -minor
+	}
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Mul multiplies the amount by a quantity, failing instead of overflowing
+func (m Money) Mul(quantity int) (Money, error) {
+	q := int64(quantity)
+	if q != 0 && (m.Amount > math.MaxInt64/abs(q) || m.Amount < math.MinInt64/abs(q)) {
+		return Money{}, ErrAmountOverflow
+	}
+	return Money{Amount: m.Amount * q, Currency: m.Currency}, nil
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// String formats the amount as a decimal with the currency's number of
+// decimals, without the currency
+func (m Money) String() string {
+	sign, amount := "", uint64(m.Amount)
+	if m.Amount < 0 {
+		sign, amount = "-", uint64(-m.Amount)
+	}
+	exponent := m.Currency.Exponent()
+	if exponent == 0 {
+		return sign + strconv.FormatUint(amount, 10)
+	}
+	scale := uint64(math.Pow10(exponent))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/scale, exponent, amount%scale)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   string   `json:"amount"`
+		Currency Currency `json:"currency"`
+	}{m.String(), m.Currency})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var fields struct {
+		Amount   json.RawMessage `json:"amount"`
+		Currency Currency        `json:"currency"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return errors.New("money must be an object with amount and currency")
+	}
+	if len(fields.Amount) == 0 || fields.Currency == "" {
+		return errors.New("money needs both amount and currency")
+	}
+
+	// Numbers are read from their literal text, never as floats
+	amount := string(fields.Amount)
+	if strings.HasPrefix(amount, `"`) {
+		if err := json.Unmarshal(fields.Amount, &amount); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := ParseMoney(amount, fields.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
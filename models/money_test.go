@@ -0,0 +1,100 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func usd(cents int64) Money {
+	return Money{Amount: cents, Currency: "USD"}
+}
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency Currency
+		expected int64
+		valid    bool
+	}{
+		{"99.99", "USD", 9999, true},
+		{"12.5", "EUR", 1250, true},
+		{"7", "USD", 700, true},
+		{"0.10", "USD", 10, true},
+		{"-3.25", "USD", -325, true},
+		{"1500", "JPY", 1500, true},
+		{"1.234", "KWD", 1234, true},
+		{"1.5", "JPY", 0, false},
+		{"0.001", "USD", 0, false},
+		{"12.", "USD", 0, false},
+		{".5", "USD", 0, false},
+		{"1e2", "USD", 0, false},
+		{"1,50", "EUR", 0, false},
+		{"", "USD", 0, false},
+		{"92233720368547758.08", "USD", 0, false},
+		{"10", "XYZ", 0, false},
+		{"10", "usd", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.amount+" "+string(tt.currency), func(t *testing.T) {
+			money, err := ParseMoney(tt.amount, tt.currency)
+			if !tt.valid {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, Money{Amount: tt.expected, Currency: tt.currency}, money)
+		})
+	}
+}
+
+func TestMoney_String(t *testing.T) {
+	assert.Equal(t, "99.99", usd(9999).String())
+	assert.Equal(t, "0.05", usd(5).String())
+	assert.Equal(t, "-1.50", usd(-150).String())
+	assert.Equal(t, "1500", Money{Amount: 1500, Currency: "JPY"}.String())
+	assert.Equal(t, "1.234", Money{Amount: 1234, Currency: "BHD"}.String())
+}
+
+func TestMoney_Mul(t *testing.T) {
+	// 99.99 * 3 in floating point is 299.96999999999997
+	total, err := usd(9999).Mul(3)
+	assert.NoError(t, err)
+	assert.Equal(t, usd(29997), total)
+	assert.Equal(t, "299.97", total.String())
+
+	_, err = usd(math.MaxInt64 / 2).Mul(3)
+	assert.ErrorIs(t, err, ErrAmountOverflow)
+}
+
+func TestMoney_JSON(t *testing.T) {
+	data, err := json.Marshal(usd(1250))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"amount": "12.50", "currency": "USD"}`, string(data))
+
+	for _, body := range []string{
+		`{"amount": "12.50", "currency": "USD"}`,
+		`{"amount": 12.50, "currency": "USD"}`,
+		`{"amount": 12.5, "currency": "USD"}`,
+	} {
+		var money Money
+		assert.NoError(t, json.Unmarshal([]byte(body), &money), body)
+		assert.Equal(t, usd(1250), money, body)
+	}
+
+	for _, body := range []string{
+		`"12.50"`,
+		`12.5`,
+		`{"amount": "12.50"}`,
+		`{"currency": "USD"}`,
+		`{"amount": "12.505", "currency": "USD"}`,
+		`{"amount": true, "currency": "USD"}`,
+		`{"amount": "12.50", "currency": "DOLLAR"}`,
+	} {
+		var money Money
+		assert.Error(t, json.Unmarshal([]byte(body), &money), body)
+	}
+}
@@ -17,9 +17,12 @@ type Order struct {
 	UserID    int         `json:"user_id" db:"user_id"`
 	ProductID int         `json:"product_id" db:"product_id"`
 	Quantity  int         `json:"quantity" db:"quantity"`
-	Price     float64     `json:"price" db:"price"` // Price at time of purchase
-	Total     float64     `json:"total" db:"total"`
+	Price     Money       `json:"price" db:"price"` // Price at time of purchase
+	Total     Money       `json:"total" db:"total"`
 	Status    OrderStatus `json:"status" db:"status"`
+	VariantID *int        `json:"variant_id,omitempty" db:"variant_id"`
+	SKU       string      `json:"sku,omitempty" db:"sku"` // SKU of the variant at time of purchase
+	Version   int         `json:"version" db:"version"`   // Changes on every update, sent as the ETag
 	CreatedAt time.Time   `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time   `json:"updated_at" db:"updated_at"`
 }
@@ -32,10 +35,12 @@ type OrderWithDetails struct {
 
 type CreateOrderRequest struct {
 	ProductID int `json:"product_id" binding:"required,gt=0"`
+	VariantID int `json:"variant_id,omitempty" binding:"omitempty,gt=0"` // Required for products with variants
 	Quantity  int `json:"quantity" binding:"required,gt=0"`
 }
 
 type OrderResponse struct {
-	Order   Order   `json:"order"`
-	Product Product `json:"product"`
+	Order   Order           `json:"order"`
+	Product Product         `json:"product"`
+	Variant *ProductVariant `json:"variant,omitempty"`
 }
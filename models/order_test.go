@@ -18,8 +18,8 @@ func TestOrder_Structure(t *testing.T) {
 		UserID:    2,
 		ProductID: 3,
 		Quantity:  5,
-		Price:     99.99,
-		Total:     499.95,
+		Price:     usd(9999),
+		Total:     usd(49995),
 		Status:    OrderStatusCompleted,
 	}
 
@@ -27,8 +27,8 @@ func TestOrder_Structure(t *testing.T) {
 	assert.Equal(t, 2, order.UserID)
 	assert.Equal(t, 3, order.ProductID)
 	assert.Equal(t, 5, order.Quantity)
-	assert.Equal(t, 99.99, order.Price)
-	assert.Equal(t, 499.95, order.Total)
+	assert.Equal(t, usd(9999), order.Price)
+	assert.Equal(t, usd(49995), order.Total)
 	assert.Equal(t, OrderStatusCompleted, order.Status)
 }
 
@@ -90,8 +90,8 @@ func TestOrderResponse_Structure(t *testing.T) {
 		UserID:    2,
 		ProductID: 3,
 		Quantity:  2,
-		Price:     99.99,
-		Total:     199.98,
+		Price:     usd(9999),
+		Total:     usd(19998),
 		Status:    OrderStatusCompleted,
 	}
 
@@ -99,7 +99,7 @@ func TestOrderResponse_Structure(t *testing.T) {
 		ID:          3,
 		Name:        "Test Product",
 		Description: "Test Description",
-		Price:       99.99,
+		Price:       usd(9999),
 		Stock:       10,
 		CreatedBy:   1,
 	}
@@ -122,8 +122,8 @@ func TestOrderWithDetails_Structure(t *testing.T) {
 			UserID:    2,
 			ProductID: 3,
 			Quantity:  2,
-			Price:     99.99,
-			Total:     199.98,
+			Price:     usd(9999),
+			Total:     usd(19998),
 			Status:    OrderStatusCompleted,
 		},
 		ProductName: "Test Product",
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+)
+
+// Permission grants access to a group of privileged endpoints. Roles are
+// composed of permissions; regular actions such as ordering need none.
+type Permission string
+
+const (
+	PermissionProductsWrite    Permission = "products:write"
+	PermissionOrdersReadAll    Permission = "orders:read_all"
+	PermissionUsersRead        Permission = "users:read"
+	PermissionUsersWrite       Permission = "users:write"
+	PermissionUsersImpersonate Permission = "users:impersonate"
+	PermissionRolesManage      Permission = "roles:manage"
+	PermissionInvitesManage    Permission = "invites:manage"
+	PermissionSettingsManage   Permission = "settings:manage"
+	PermissionChatModerate     Permission = "chat:moderate"
+	PermissionAuditRead        Permission = "audit:read"
+)
+
+// AllPermissions lists every known permission
+var AllPermissions = []Permission{
+	PermissionProductsWrite,
+	PermissionOrdersReadAll,
+	PermissionUsersRead,
+	PermissionUsersWrite,
+	PermissionUsersImpersonate,
+	PermissionRolesManage,
+	PermissionInvitesManage,
+	PermissionSettingsManage,
+	PermissionChatModerate,
+	PermissionAuditRead,
+}
+
+// IsValid reports whether the permission is one of the known permissions
+func (p Permission) IsValid() bool {
+	for _, permission := range AllPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultRolePermissions are the permissions of the built-in roles. The admin
+// role always holds every permission.
+var DefaultRolePermissions = map[Role][]Permission{
+	RoleAdmin: AllPermissions,
+	RoleUser:  {},
+}
+
+type RoleDefinition struct {
+	Name        Role         `json:"name" db:"name"`
+	Description string       `json:"description" db:"description"`
+	Permissions []Permission `json:"permissions"`
+	BuiltIn     bool         `json:"built_in" db:"built_in"` // Built-in roles cannot be deleted
+	CreatedAt   time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at" db:"updated_at"`
+}
+
+type CreateRoleRequest struct {
+	Name        Role         `json:"name" binding:"required"` // Lowercase letters, digits, "_" and "-"
+	Description string       `json:"description,omitempty" binding:"max=200"`
+	Permissions []Permission `json:"permissions" binding:"required"`
+}
+
+type UpdateRoleRequest struct {
+	Description *string      `json:"description,omitempty" binding:"omitempty,max=200"`
+	Permissions []Permission `json:"permissions" binding:"required"`
+}
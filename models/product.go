@@ -5,26 +5,86 @@ import (
 )
 
 type Product struct {
-	ID          int       `json:"id" db:"id"`
-	Name        string    `json:"name" db:"name"`
-	Description string    `json:"description" db:"description"`
-	Price       float64   `json:"price" db:"price"`
-	Stock       int       `json:"stock" db:"stock"`
-	CreatedBy   int       `json:"created_by" db:"created_by"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID          int            `json:"id" db:"id"`
+	Name        string         `json:"name" db:"name"`
+	Description string         `json:"description" db:"description"`
+	Price       Money          `json:"price" db:"price"` // In the product's currency
+	Stock       int            `json:"stock" db:"stock"`
+	CreatedBy   int            `json:"created_by" db:"created_by"`
+	CategoryIDs []int          `json:"category_ids"`
+	Tags        []string       `json:"tags"`
+	Images      []ProductImage `json:"images"`               // Gallery in display order
+	Version     int            `json:"version" db:"version"` // Changes on every update, sent as the ETag
+	CreatedAt   time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at" db:"updated_at"`
+	DeletedAt   *time.Time     `json:"deleted_at,omitempty" db:"deleted_at"` // Set while the product is in the trash
 }
 
 type CreateProductRequest struct {
-	Name        string  `json:"name" binding:"required,min=1,max=100"`
-	Description string  `json:"description" binding:"required,min=1,max=500"`
-	Price       float64 `json:"price" binding:"required,gt=0"`
-	Stock       int     `json:"stock" binding:"required,gte=0"`
+	Name        string   `json:"name" binding:"required,min=1,max=100"`
+	Description string   `json:"description" binding:"required,min=1,max=500"`
+	Price       *Money   `json:"price" binding:"required"` // Declares the product's currency
+	Stock       int      `json:"stock" binding:"required,gte=0"`
+	CategoryIDs []int    `json:"category_ids,omitempty" binding:"omitempty,max=20"`
+	Tags        []string `json:"tags,omitempty" binding:"omitempty,max=20,dive,max=30"`
 }
 
+// UpdateProductRequest replaces every field of a product. Omitted
+// category_ids or tags remove the assignments.
 type UpdateProductRequest struct {
-	Name        string  `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
-	Description string  `json:"description,omitempty" binding:"omitempty,min=1,max=500"`
-	Price       float64 `json:"price,omitempty" binding:"omitempty,gt=0"`
-	Stock       int     `json:"stock,omitempty" binding:"omitempty,gte=0"`
+	Name        string   `json:"name" binding:"required,min=1,max=100"`
+	Description string   `json:"description" binding:"required,min=1,max=500"`
+	Price       *Money   `json:"price" binding:"required"`
+	Stock       *int     `json:"stock" binding:"required,gte=0"`
+	CategoryIDs []int    `json:"category_ids" binding:"omitempty,max=20"`
+	Tags        []string `json:"tags" binding:"omitempty,max=20,dive,max=30"`
+}
+
+// PatchProductRequest is a JSON merge patch of a product, omitted fields are
+// kept
+type PatchProductRequest struct {
+	Name        *string  `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	Description *string  `json:"description,omitempty" binding:"omitempty,min=1,max=500"`
+	Price       *Money   `json:"price,omitempty"`
+	Stock       *int     `json:"stock,omitempty" binding:"omitempty,gte=0"`
+	CategoryIDs []int    `json:"category_ids,omitempty" binding:"omitempty,max=20"`     // Replaces the categories, [] or null removes all
+	Tags        []string `json:"tags,omitempty" binding:"omitempty,max=20,dive,max=30"` // Replaces the tags, [] or null removes all
+}
+
+// ProductImage is an uploaded picture of a product with its thumbnails
+type ProductImage struct {
+	ID          int               `json:"id" db:"id"`
+	ProductID   int               `json:"product_id" db:"product_id"`
+	Position    int               `json:"position" db:"position"`
+	URL         string            `json:"url" db:"url"`
+	Thumbnails  map[string]string `json:"thumbnails"` // Size name (small, medium, large) to URL
+	ContentType string            `json:"content_type" db:"content_type"`
+	Width       int               `json:"width" db:"width"`
+	Height      int               `json:"height" db:"height"`
+	Size        int64             `json:"size" db:"size"` // Bytes
+	CreatedAt   time.Time         `json:"created_at" db:"created_at"`
+}
+
+type ReorderImagesRequest struct {
+	ImageIDs []int `json:"image_ids" binding:"required"` // Every image of the product, in the new order
+}
+
+type ProductListResponse struct {
+	Products   []Product `json:"products"`
+	NextCursor string    `json:"next_cursor,omitempty"` // Empty on the last page
+	Total      int       `json:"total"`                 // Products matching the filters, on all pages
+}
+
+// ProductSearchResult is a matching product with its matches wrapped in
+// <mark> tags. Both texts are HTML-escaped.
+type ProductSearchResult struct {
+	Product
+	NameHighlight      string `json:"name_highlight"`
+	DescriptionSnippet string `json:"description_snippet"` // Part of the description around the matches
+}
+
+type ProductSearchResponse struct {
+	Results    []ProductSearchResult `json:"results"`
+	NextCursor string                `json:"next_cursor,omitempty"` // Empty on the last page
+	Total      int                   `json:"total"`                 // Matching products, on all pages
 }
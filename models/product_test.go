@@ -13,7 +13,7 @@ func TestProduct_Structure(t *testing.T) {
 		ID:          1,
 		Name:        "Test Product",
 		Description: "Test Description",
-		Price:       99.99,
+		Price:       usd(9999),
 		Stock:       10,
 		CreatedBy:   1,
 		CreatedAt:   now,
@@ -23,7 +23,7 @@ func TestProduct_Structure(t *testing.T) {
 	assert.Equal(t, 1, product.ID)
 	assert.Equal(t, "Test Product", product.Name)
 	assert.Equal(t, "Test Description", product.Description)
-	assert.Equal(t, 99.99, product.Price)
+	assert.Equal(t, "99.99", product.Price.String())
 	assert.Equal(t, 10, product.Stock)
 	assert.Equal(t, 1, product.CreatedBy)
 	assert.Equal(t, now, product.CreatedAt)
@@ -41,7 +41,7 @@ func TestCreateProductRequest_Validation(t *testing.T) {
 			request: CreateProductRequest{
 				Name:        "Test Product",
 				Description: "Test Description",
-				Price:       99.99,
+				Price:       ptr(usd(9999)),
 				Stock:       10,
 			},
 			valid: true,
@@ -51,7 +51,7 @@ func TestCreateProductRequest_Validation(t *testing.T) {
 			request: CreateProductRequest{
 				Name:        "",
 				Description: "Test Description",
-				Price:       99.99,
+				Price:       ptr(usd(9999)),
 				Stock:       10,
 			},
 			valid: false,
@@ -61,7 +61,7 @@ func TestCreateProductRequest_Validation(t *testing.T) {
 			request: CreateProductRequest{
 				Name:        "This is a very long product name that exceeds the maximum allowed length of one hundred characters",
 				Description: "Test Description",
-				Price:       99.99,
+				Price:       ptr(usd(9999)),
 				Stock:       10,
 			},
 			valid: false,
@@ -71,7 +71,7 @@ func TestCreateProductRequest_Validation(t *testing.T) {
 			request: CreateProductRequest{
 				Name:        "Test Product",
 				Description: "",
-				Price:       99.99,
+				Price:       ptr(usd(9999)),
 				Stock:       10,
 			},
 			valid: false,
@@ -81,7 +81,7 @@ func TestCreateProductRequest_Validation(t *testing.T) {
 			request: CreateProductRequest{
 				Name:        "Test Product",
 				Description: "Test Description",
-				Price:       0,
+				Price:       ptr(usd(0)),
 				Stock:       10,
 			},
 			valid: false,
@@ -91,7 +91,7 @@ func TestCreateProductRequest_Validation(t *testing.T) {
 			request: CreateProductRequest{
 				Name:        "Test Product",
 				Description: "Test Description",
-				Price:       -10.0,
+				Price:       ptr(usd(-1000)),
 				Stock:       10,
 			},
 			valid: false,
@@ -101,7 +101,7 @@ func TestCreateProductRequest_Validation(t *testing.T) {
 			request: CreateProductRequest{
 				Name:        "Test Product",
 				Description: "Test Description",
-				Price:       99.99,
+				Price:       ptr(usd(9999)),
 				Stock:       -1,
 			},
 			valid: false,
@@ -111,7 +111,7 @@ func TestCreateProductRequest_Validation(t *testing.T) {
 			request: CreateProductRequest{
 				Name:        "Test Product",
 				Description: "Test Description",
-				Price:       99.99,
+				Price:       ptr(usd(9999)),
 				Stock:       0,
 			},
 			valid: true,
@@ -123,7 +123,7 @@ func TestCreateProductRequest_Validation(t *testing.T) {
 			if tt.valid {
 				assert.NotEmpty(t, tt.request.Name)
 				assert.NotEmpty(t, tt.request.Description)
-				assert.Greater(t, tt.request.Price, 0.0)
+				assert.Greater(t, tt.request.Price.Amount, int64(0))
 				assert.GreaterOrEqual(t, tt.request.Stock, 0)
 				assert.LessOrEqual(t, len(tt.request.Name), 100)
 				assert.LessOrEqual(t, len(tt.request.Description), 500)
@@ -132,53 +132,64 @@ func TestCreateProductRequest_Validation(t *testing.T) {
 	}
 }
 
-func TestUpdateProductRequest_Validation(t *testing.T) {
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestPatchProductRequest_Validation(t *testing.T) {
 	tests := []struct {
 		name    string
-		request UpdateProductRequest
+		request PatchProductRequest
 		valid   bool
 	}{
 		{
 			name: "valid partial update",
-			request: UpdateProductRequest{
-				Name:  "Updated Product",
-				Price: 149.99,
+			request: PatchProductRequest{
+				Name:  ptr("Updated Product"),
+				Price: ptr(usd(14999)),
 			},
 			valid: true,
 		},
 		{
 			name: "valid full update",
-			request: UpdateProductRequest{
-				Name:        "Updated Product",
-				Description: "Updated Description",
-				Price:       149.99,
-				Stock:       20,
+			request: PatchProductRequest{
+				Name:        ptr("Updated Product"),
+				Description: ptr("Updated Description"),
+				Price:       ptr(usd(14999)),
+				Stock:       ptr(20),
 			},
 			valid: true,
 		},
 		{
-			name: "empty update (valid)",
-			request: UpdateProductRequest{},
+			name:    "empty update (valid)",
+			request: PatchProductRequest{},
+			valid:   true,
+		},
+		{
+			name: "stock set to zero (valid)",
+			request: PatchProductRequest{
+				Stock: ptr(0),
+			},
 			valid: true,
 		},
 		{
 			name: "invalid name too long",
-			request: UpdateProductRequest{
-				Name: "This is a very long product name that exceeds the maximum allowed length of one hundred characters",
+			request: PatchProductRequest{
+				Name: ptr("This is a very long product name that exceeds the maximum allowed length of one hundred characters"),
 			},
 			valid: false,
 		},
 		{
 			name: "invalid zero price",
-			request: UpdateProductRequest{
-				Price: 0,
+			request: PatchProductRequest{
+				Price: ptr(usd(0)),
 			},
 			valid: false,
 		},
 		{
 			name: "invalid negative stock",
-			request: UpdateProductRequest{
-				Stock: -1,
+			request: PatchProductRequest{
+				Stock: ptr(-1),
 			},
 			valid: false,
 		},
@@ -187,17 +198,17 @@ func TestUpdateProductRequest_Validation(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			if tt.valid {
-				if tt.request.Name != "" {
-					assert.LessOrEqual(t, len(tt.request.Name), 100)
+				if tt.request.Name != nil {
+					assert.LessOrEqual(t, len(*tt.request.Name), 100)
 				}
-				if tt.request.Description != "" {
-					assert.LessOrEqual(t, len(tt.request.Description), 500)
+				if tt.request.Description != nil {
+					assert.LessOrEqual(t, len(*tt.request.Description), 500)
 				}
-				if tt.request.Price != 0 {
-					assert.Greater(t, tt.request.Price, 0.0)
+				if tt.request.Price != nil {
+					assert.Greater(t, tt.request.Price.Amount, int64(0))
 				}
-				if tt.request.Stock != 0 {
-					assert.GreaterOrEqual(t, tt.request.Stock, 0)
+				if tt.request.Stock != nil {
+					assert.GreaterOrEqual(t, *tt.request.Stock, 0)
 				}
 			}
 		})
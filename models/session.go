@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is a signed-in device. It lasts as long as its refresh token chain.
+type Session struct {
+	ID         string    `json:"id" db:"id"`
+	UserAgent  string    `json:"user_agent" db:"user_agent"`
+	IPAddress  string    `json:"ip_address" db:"ip_address"`
+	MFA        bool      `json:"mfa" db:"mfa"`
+	Current    bool      `json:"current"` // Set for the session making the request
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at" db:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at" db:"expires_at"`
+}
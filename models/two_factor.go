@@ -0,0 +1,40 @@
+package models
+
+// TwoFactorChallengeResponse is returned by Login instead of a LoginResponse
+// when the account has two-factor authentication enabled
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int64  `json:"expires_in"` // Challenge lifetime in seconds
+}
+
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"` // TOTP code or recovery code
+}
+
+type TwoFactorSetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"` // TOTP code or recovery code
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type SecuritySettings struct {
+	RequireAdminTwoFactor bool `json:"require_admin_2fa"`
+}
+
+type UpdateSecuritySettingsRequest struct {
+	RequireAdminTwoFactor *bool `json:"require_admin_2fa" binding:"required"`
+}
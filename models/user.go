@@ -1,6 +1,7 @@
 package models
 
 import (
+	"regexp"
 	"time"
 )
 
@@ -11,29 +12,91 @@ const (
 	RoleUser  Role = "user"
 )
 
+// IsValid reports whether the role is one of the built-in roles. Custom
+// roles live in the roles table.
+func (r Role) IsValid() bool {
+	return r == RoleAdmin || r == RoleUser
+}
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,49}$`)
+
+// IsValidName reports whether the role is usable as the name of a custom role
+func (r Role) IsValidName() bool {
+	return roleNamePattern.MatchString(string(r))
+}
+
 type User struct {
-	ID        int       `json:"id" db:"id"`
-	Username  string    `json:"username" db:"username"`
-	Email     string    `json:"email" db:"email"`
-	Password  string    `json:"-" db:"password"` // Don't include in JSON responses
-	Role      Role      `json:"role" db:"role"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID          int        `json:"id" db:"id"`
+	Username    string     `json:"username" db:"username"`
+	Email       string     `json:"email" db:"email"`
+	Password    string     `json:"-" db:"password"` // Don't include in JSON responses
+	Role        Role       `json:"role" db:"role"`
+	SuspendedAt *time.Time `json:"suspended_at,omitempty" db:"suspended_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+
+	EmailVerifiedAt  *time.Time   `json:"email_verified_at,omitempty" db:"email_verified_at"`
+	TwoFactorEnabled bool         `json:"two_factor_enabled" db:"-"`
+	Permissions      []Permission `json:"permissions,omitempty" db:"-"` // Only filled for the own profile
 }
 
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"`
 }
 
 type RegisterRequest struct {
-	Username string `json:"username" binding:"required,min=3,max=50"`
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
-	Role     Role   `json:"role,omitempty"` // Optional, defaults to user
+	Username   string `json:"username" binding:"required,min=3,max=50"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required"` // Checked against the password policy
+	InviteCode string `json:"invite_code,omitempty"`       // Optional, grants the role bound to the invite
 }
 
 type LoginResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"` // Access token lifetime in seconds
+	User         User   `json:"user"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token,omitempty"` // Optional, revokes the whole refresh token family
+}
+
+type UpdateUserRoleRequest struct {
+	Role Role `json:"role" binding:"required"`
+}
+
+type UserListResponse struct {
+	Users    []User `json:"users"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"page_size"`
+	Total    int    `json:"total"`
+}
+
+type UpdateProfileRequest struct {
+	Username *string `json:"username,omitempty" binding:"omitempty,min=3,max=50"`
+	Email    *string `json:"email,omitempty" binding:"omitempty,email"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"` // Checked against the password policy
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"` // Checked against the password policy
 }
@@ -11,6 +11,13 @@ func TestRole_Constants(t *testing.T) {
 	assert.Equal(t, Role("user"), RoleUser)
 }
 
+func TestRole_IsValid(t *testing.T) {
+	assert.True(t, RoleAdmin.IsValid())
+	assert.True(t, RoleUser.IsValid())
+	assert.False(t, Role("superuser").IsValid())
+	assert.False(t, Role("").IsValid())
+}
+
 func TestUser_JSONSerialization(t *testing.T) {
 	user := User{
 		ID:       1,
@@ -93,17 +100,16 @@ func TestRegisterRequest_Validation(t *testing.T) {
 				Username: "testuser",
 				Email:    "test@example.com",
 				Password: "password123",
-				Role:     RoleUser,
 			},
 			valid: true,
 		},
 		{
-			name: "valid admin request",
+			name: "valid invited request",
 			request: RegisterRequest{
-				Username: "admin",
-				Email:    "admin@example.com",
-				Password: "password123",
-				Role:     RoleAdmin,
+				Username:   "admin",
+				Email:      "admin@example.com",
+				Password:   "password123",
+				InviteCode: "invite-code",
 			},
 			valid: true,
 		},
@@ -113,7 +119,6 @@ func TestRegisterRequest_Validation(t *testing.T) {
 				Username: "ab",
 				Email:    "test@example.com",
 				Password: "password123",
-				Role:     RoleUser,
 			},
 			valid: false,
 		},
@@ -123,7 +128,6 @@ func TestRegisterRequest_Validation(t *testing.T) {
 				Username: "this-is-a-very-long-username-that-exceeds-fifty-characters",
 				Email:    "test@example.com",
 				Password: "password123",
-				Role:     RoleUser,
 			},
 			valid: false,
 		},
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+// ProductOption is an option type of a product, such as size or color, with
+// the values variants can choose from
+type ProductOption struct {
+	Name   string   `json:"name" binding:"required,min=1,max=50"`
+	Values []string `json:"values" binding:"required,min=1,max=50,dive,min=1,max=50"`
+}
+
+// ProductVariant is a sellable version of a product with one value for each
+// of the product's option types
+type ProductVariant struct {
+	ID        int               `json:"id" db:"id"`
+	ProductID int               `json:"product_id" db:"product_id"`
+	SKU       string            `json:"sku" db:"sku"`
+	Options   map[string]string `json:"options" db:"options"` // Option name to value
+	Price     *Money            `json:"price" db:"price"`     // Overrides the product price when set
+	Stock     int               `json:"stock" db:"stock"`
+	CreatedAt time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+type ProductVariantsResponse struct {
+	Options  []ProductOption  `json:"options"`
+	Variants []ProductVariant `json:"variants"`
+}
+
+type SetProductOptionsRequest struct {
+	Options []ProductOption `json:"options" binding:"max=5,dive"` // Replaces all option types, [] removes them
+}
+
+type CreateVariantRequest struct {
+	SKU     string            `json:"sku" binding:"required,min=1,max=64"`
+	Options map[string]string `json:"options" binding:"required"`
+	Price   *Money            `json:"price,omitempty"` // In the product's currency
+	Stock   int               `json:"stock" binding:"gte=0"`
+}
+
+type UpdateVariantRequest struct {
+	SKU   *string `json:"sku,omitempty" binding:"omitempty,min=1,max=64"`
+	Price *Money  `json:"price,omitempty"` // An amount of 0 removes the override
+	Stock *int    `json:"stock,omitempty" binding:"omitempty,gte=0"`
+}
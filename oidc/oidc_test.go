@@ -0,0 +1,95 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"smarapp-api/oidc"
+	"smarapp-api/oidc/oidctest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// Example from RFC 7636 appendix B
+func TestChallenge_RFC7636(t *testing.T) {
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", oidc.Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+}
+
+// login runs the authorization code flow against the fake provider
+func login(t *testing.T, fake *oidctest.Provider, provider *oidc.Provider, nonce string) (*oidc.Claims, error) {
+	verifier, err := oidc.NewVerifier()
+	assert.NoError(t, err)
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state-1", "nonce-1", verifier)
+	assert.NoError(t, err)
+
+	redirect := fake.Authorize(t, authURL)
+	assert.Equal(t, "state-1", redirect.Query().Get("state"))
+
+	return provider.Exchange(context.Background(), redirect.Query().Get("code"), verifier, nonce)
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	fake := oidctest.NewProvider(t)
+	fake.User.PreferredUsername = "sso-user"
+	provider := fake.Client("fake", "http://localhost/callback")
+
+	claims, err := login(t, fake, provider, "nonce-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "fake-subject", claims.Subject)
+	assert.Equal(t, "sso@example.com", claims.Email)
+	assert.True(t, claims.EmailVerified)
+	assert.Equal(t, "sso-user", claims.PreferredUsername)
+}
+
+func TestProvider_Exchange_Rejects(t *testing.T) {
+	tests := []struct {
+		name         string
+		modifyClaims func(jwt.MapClaims)
+		nonce        string
+	}{
+		{"nonce mismatch", nil, "other-nonce"},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "other-client" }, "nonce-1"},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, "nonce-1"},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, "nonce-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := oidctest.NewProvider(t)
+			fake.ModifyClaims = tt.modifyClaims
+			provider := fake.Client("fake", "http://localhost/callback")
+
+			_, err := login(t, fake, provider, tt.nonce)
+			assert.True(t, errors.Is(err, oidc.ErrInvalidIDToken), "got %v", err)
+		})
+	}
+}
+
+func TestProvider_Exchange_WrongVerifier(t *testing.T) {
+	fake := oidctest.NewProvider(t)
+	provider := fake.Client("fake", "http://localhost/callback")
+
+	verifier, err := oidc.NewVerifier()
+	assert.NoError(t, err)
+	authURL, err := provider.AuthCodeURL(context.Background(), "state-1", "nonce-1", verifier)
+	assert.NoError(t, err)
+	redirect := fake.Authorize(t, authURL)
+
+	otherVerifier, err := oidc.NewVerifier()
+	assert.NoError(t, err)
+	_, err = provider.Exchange(context.Background(), redirect.Query().Get("code"), otherVerifier, "nonce-1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid_grant")
+}
+
+func TestProvider_Discover_IssuerMismatch(t *testing.T) {
+	fake := oidctest.NewProvider(t)
+	provider := fake.Client("fake", "http://localhost/callback")
+	provider.IssuerURL = fake.Issuer() + "/tenant"
+
+	_, err := provider.Discover(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,154 @@
+// Package password hashes passwords and checks new ones against a policy.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hasher hashes new passwords and verifies stored hashes. Hashes encode
+// their algorithm and parameters, so hashes created with older settings keep
+// working and can be upgraded once the password is known again.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches the hash. Hashes in a
+	// format the hasher does not understand never match.
+	Verify(encoded, password string) bool
+	// NeedsRehash reports whether the hash should be replaced by a fresh one
+	// because it uses another algorithm or outdated parameters
+	NeedsRehash(encoded string) bool
+}
+
+// Default hashes new passwords with Argon2id and still accepts bcrypt hashes
+func Default() Hasher {
+	return Chain{DefaultArgon2id(), Bcrypt{Cost: bcrypt.DefaultCost}}
+}
+
+// Chain hashes new passwords with its first hasher and verifies hashes with
+// any of them, so an application can move to a new algorithm without
+// invalidating existing passwords
+type Chain []Hasher
+
+func (c Chain) Hash(password string) (string, error) {
+	return c[0].Hash(password)
+}
+
+func (c Chain) Verify(encoded, password string) bool {
+	for _, hasher := range c {
+		if hasher.Verify(encoded, password) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Chain) NeedsRehash(encoded string) bool {
+	return c[0].NeedsRehash(encoded)
+}
+
+// Argon2id hashes passwords with Argon2id, encoded in the PHC string format:
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>
+type Argon2id struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2id uses the OWASP recommended minimum parameters
+func DefaultArgon2id() Argon2id {
+	return Argon2id{
+		Memory:      19 * 1024,
+		Iterations:  2,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+func (a Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a Argon2id) Verify(encoded, password string) bool {
+	params, salt, key, ok := decodeArgon2id(encoded)
+	if !ok {
+		return false
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+func (a Argon2id) NeedsRehash(encoded string) bool {
+	params, salt, key, ok := decodeArgon2id(encoded)
+	if !ok {
+		return true
+	}
+	return params.Memory != a.Memory || params.Iterations != a.Iterations || params.Parallelism != a.Parallelism ||
+		uint32(len(salt)) != a.SaltLength || uint32(len(key)) != a.KeyLength
+}
+
+func decodeArgon2id(encoded string) (Argon2id, []byte, []byte, bool) {
+	var params Argon2id
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return params, nil, nil, false
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, false
+	}
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil || params.Iterations == 0 || params.Parallelism == 0 {
+		return params, nil, nil, false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, false
+	}
+	return params, salt, key, true
+}
+
+// Bcrypt hashes passwords with bcrypt. Only the first 72 bytes of a password
+// are used, so prefer Argon2id for new hashes.
+type Bcrypt struct {
+	Cost int
+}
+
+func (b Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	return string(hash), err
+}
+
+func (b Bcrypt) Verify(encoded, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+}
+
+func (b Bcrypt) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != b.Cost
+}
@@ -0,0 +1,107 @@
+package password
+
+import (
+	"crypto/sha1"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestArgon2id(t *testing.T) {
+	hasher := DefaultArgon2id()
+
+	hash, err := hasher.Hash("correct horse")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$"))
+	assert.True(t, hasher.Verify(hash, "correct horse"))
+	assert.False(t, hasher.Verify(hash, "wrong horse"))
+	assert.False(t, hasher.NeedsRehash(hash))
+
+	// Every hash gets its own salt
+	other, err := hasher.Hash("correct horse")
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, other)
+
+	// Hashes keep their parameters, so stronger settings still verify old hashes
+	stronger := hasher
+	stronger.Iterations = 3
+	assert.True(t, stronger.Verify(hash, "correct horse"))
+	assert.True(t, stronger.NeedsRehash(hash))
+
+	for _, malformed := range []string{"", "$argon2id$v=19$m=1,t=1,p=1$salt", "$argon2i$v=19$m=19456,t=2,p=1$c2FsdA$a2V5", "$argon2id$v=19$m=19456,t=0,p=1$c2FsdA$a2V5"} {
+		assert.False(t, hasher.Verify(malformed, ""), malformed)
+		assert.True(t, hasher.NeedsRehash(malformed), malformed)
+	}
+}
+
+func TestBcrypt(t *testing.T) {
+	hasher := Bcrypt{Cost: bcrypt.MinCost}
+
+	hash, err := hasher.Hash("correct horse")
+	assert.NoError(t, err)
+	assert.True(t, hasher.Verify(hash, "correct horse"))
+	assert.False(t, hasher.Verify(hash, "wrong horse"))
+	assert.False(t, hasher.NeedsRehash(hash))
+	assert.True(t, Bcrypt{Cost: bcrypt.MinCost + 1}.NeedsRehash(hash))
+	assert.True(t, hasher.NeedsRehash("$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$a2V5"))
+}
+
+func TestChain_UpgradesLegacyHashes(t *testing.T) {
+	legacy, err := Bcrypt{Cost: bcrypt.MinCost}.Hash("correct horse")
+	assert.NoError(t, err)
+
+	hasher := Chain{DefaultArgon2id(), Bcrypt{Cost: bcrypt.MinCost}}
+	assert.True(t, hasher.Verify(legacy, "correct horse"))
+	assert.False(t, hasher.Verify(legacy, "wrong horse"))
+	assert.True(t, hasher.NeedsRehash(legacy))
+
+	hash, err := hasher.Hash("correct horse")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$"))
+	assert.True(t, hasher.Verify(hash, "correct horse"))
+	assert.False(t, hasher.NeedsRehash(hash))
+
+	// Passwords of accounts without one never match
+	assert.False(t, hasher.Verify("", ""))
+}
+
+func TestPolicy_Check(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.Breached = map[[sha1.Size]byte]struct{}{sha1.Sum([]byte("password123")): {}}
+
+	assert.NoError(t, policy.Check("correct horse"))
+	assert.NoError(t, policy.Check("pässwörd"), "length counts characters, not bytes")
+	assert.EqualError(t, policy.Check("short"), "Password must be at least 8 characters")
+	assert.EqualError(t, policy.Check(strings.Repeat("a", 129)), "Password must be at most 128 characters")
+	assert.Error(t, policy.Check("password123"))
+}
+
+func TestLoadBreachedList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	content := strings.Join([]string{
+		"# common passwords",
+		"letmein123",
+		"",
+		// SHA-1 of "password123" in the Have I Been Pwned format
+		"CBFDAC6008F9CAB4083784CBD1874F76618D2A97:2468",
+		"5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8",
+	}, "\n")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	breached, err := LoadBreachedList(path)
+	assert.NoError(t, err)
+	assert.Len(t, breached, 3)
+
+	policy := &Policy{MinLength: 1, Breached: breached}
+	assert.Error(t, policy.Check("letmein123"))
+	assert.Error(t, policy.Check("password123"))
+	assert.Error(t, policy.Check("password"))
+	assert.NoError(t, policy.Check("# common passwords"))
+
+	_, err = LoadBreachedList(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
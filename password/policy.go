@@ -0,0 +1,86 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Policy decides which new passwords are acceptable. Its errors are meant to
+// be shown to the user.
+type Policy struct {
+	MinLength int // In characters
+	MaxLength int // In characters, 0 for no limit
+	// Breached holds the SHA-1 hashes of passwords known from data breaches
+	Breached map[[sha1.Size]byte]struct{}
+}
+
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MinLength: 8,
+		MaxLength: 128,
+	}
+}
+
+// Check returns an error describing why the password is not acceptable
+func (p *Policy) Check(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return fmt.Errorf("Password must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Errorf("Password must be at most %d characters", p.MaxLength)
+	}
+	if _, ok := p.Breached[sha1.Sum([]byte(password))]; ok {
+		return fmt.Errorf("This password has appeared in a data breach, choose a different one")
+	}
+	return nil
+}
+
+// LoadBreachedList reads a list of breached passwords, one per line. Lines
+// holding 40 hex characters, optionally followed by ":<count>" as in the
+// Have I Been Pwned downloads, are SHA-1 hashes; any other line is a
+// password in plain text. Empty lines and lines starting with "#" are
+// skipped.
+func LoadBreachedList(path string) (map[[sha1.Size]byte]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	breached := map[[sha1.Size]byte]struct{}{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hash, ok := parseSHA1(line)
+		if !ok {
+			hash = sha1.Sum([]byte(line))
+		}
+		breached[hash] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return breached, nil
+}
+
+func parseSHA1(line string) ([sha1.Size]byte, bool) {
+	var hash [sha1.Size]byte
+	digest, _, _ := strings.Cut(line, ":")
+	if len(digest) != hex.EncodedLen(sha1.Size) {
+		return hash, false
+	}
+	if _, err := hex.Decode(hash[:], []byte(digest)); err != nil {
+		return hash, false
+	}
+	return hash, true
+}
@@ -40,26 +40,27 @@ find . -name "*.db" -type f -delete 2>/dev/null || true
 print_status "Ensuring dependencies are up to date..."
 go mod tidy
 
-# Run tests with coverage
+# Run tests with coverage. Product search needs the FTS5 extension of
+# go-sqlite3, which is only compiled in with the sqlite_fts5 tag.
 print_status "Running unit tests with coverage..."
 
 # Test individual packages
 echo ""
 echo "?? Testing Models..."
-go test ./models/... -v -cover
+go test -tags sqlite_fts5 ./models/... -v -cover
 
 echo ""
 echo "?? Testing Middleware..."
-go test ./middleware/... -v -cover
+go test -tags sqlite_fts5 ./middleware/... -v -cover
 
 echo ""
 echo "?? Testing Handlers..."
-go test ./handlers/... -v -cover
+go test -tags sqlite_fts5 ./handlers/... -v -cover
 
 # Run all tests together for overall coverage
 echo ""
 echo "?? Generating overall coverage report..."
-go test ./... -coverprofile=coverage.out -covermode=atomic
+go test -tags sqlite_fts5 ./... -coverprofile=coverage.out -covermode=atomic
 
 # Generate coverage report
 if command -v go &> /dev/null; then
@@ -77,7 +78,10 @@ fi
 echo ""
 echo "?? Running Integration Tests..."
 print_status "Building application..."
-go build -o smarapp-api-test cmd/server/main.go
+go build -tags sqlite_fts5 -o smarapp-api-test ./cmd/server
+
+print_status "Creating admin user..."
+./smarapp-api-test create-admin -username admin -email admin@example.com -password password123
 
 print_status "Starting test server..."
 ./smarapp-api-test &
@@ -119,7 +123,7 @@ echo "  ? Integration Tests: API endpoints"
 echo "  ?? Coverage Report: coverage.html"
 echo ""
 echo "?? To run the application:"
-echo "  go run cmd/server/main.go"
+echo "  go run -tags sqlite_fts5 ./cmd/server"
 echo ""
 echo "?? To view API documentation:"
 echo "  Open http://localhost:8080/docs/index.html after starting the server"
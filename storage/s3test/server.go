@@ -0,0 +1,110 @@
+// Package s3test provides an in-process stand-in for an S3 bucket for tests.
+package s3test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Object is a stored object
+type Object struct {
+	Data        []byte
+	ContentType string
+}
+
+// Server answers PUT, GET and DELETE requests for objects of a single bucket
+// at path-style URLs. It checks that requests carry a Signature Version 4
+// authorization for AccessKeyID and a matching payload hash, but does not
+// verify the signature itself.
+type Server struct {
+	Server      *httptest.Server
+	Bucket      string
+	AccessKeyID string
+
+	mu      sync.Mutex
+	objects map[string]Object
+}
+
+// NewServer starts a fake bucket that is shut down when the test ends
+func NewServer(t *testing.T, bucket, accessKeyID string) *Server {
+	t.Helper()
+
+	s := &Server{Bucket: bucket, AccessKeyID: accessKeyID, objects: map[string]Object{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Server.Close)
+	return s
+}
+
+// URL is the endpoint to configure the client with
+func (s *Server) URL() string {
+	return s.Server.URL
+}
+
+// Object returns a stored object
+func (s *Server) Object(key string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	object, ok := s.objects[key]
+	return object, ok
+}
+
+// Len is the number of stored objects
+func (s *Server) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.objects)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+s.Bucket+"/")
+	if !ok || key == "" {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "IncompleteBody", http.StatusBadRequest)
+		return
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential="+s.AccessKeyID+"/") ||
+		!strings.Contains(authorization, "Signature=") || r.Header.Get("X-Amz-Date") == "" {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+	sum := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		s.objects[key] = Object{Data: body, ContentType: r.Header.Get("Content-Type")}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		object, ok := s.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", object.ContentType)
+		w.Write(object.Data)
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,21 @@
+// Package storage keeps uploaded files such as product images.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned for keys that do not exist
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores blobs under slash-separated keys and knows the public URL
+// each of them is served from
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes a blob. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
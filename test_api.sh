@@ -11,19 +11,17 @@ echo "1. Testing health check..."
 curl -s "http://127.0.0.1:8080/health" | jq .
 echo ""
 
-# Register admin user
-echo "2. Registering admin user..."
-ADMIN_RESPONSE=$(curl -s -X POST "$BASE_URL/auth/register" \
+# Login as admin (bootstrap it first with: ./smarapp-api create-admin -username admin -email admin@example.com -password password123)
+echo "2. Logging in as admin..."
+ADMIN_RESPONSE=$(curl -s -X POST "$BASE_URL/auth/login" \
   -H "Content-Type: application/json" \
   -d '{
-    "username": "admin",
     "email": "admin@example.com",
-    "password": "password123",
-    "role": "admin"
+    "password": "password123"
   }')
 
 ADMIN_TOKEN=$(echo $ADMIN_RESPONSE | jq -r '.token')
-echo "Admin registered. Token: ${ADMIN_TOKEN:0:20}..."
+echo "Admin logged in. Token: ${ADMIN_TOKEN:0:20}..."
 echo ""
 
 # Register regular user
@@ -48,18 +48,23 @@ func SetupTestDBWithData(t *testing.T) func() {
 	_, err = database.DB.Exec(`
 		INSERT INTO products (id, name, description, price, stock, created_by, created_at, updated_at)
 		VALUES 
-		(1, 'Test Product 1', 'Test Description 1', 99.99, 10, 1, datetime('now'), datetime('now')),
-		(2, 'Test Product 2', 'Test Description 2', 149.99, 5, 1, datetime('now'), datetime('now'))
+		(1, 'Test Product 1', 'Test Description 1', 9999, 10, 1, datetime('now'), datetime('now')),
+		(2, 'Test Product 2', 'Test Description 2', 14999, 5, 1, datetime('now'), datetime('now'))
 	`)
 	if err != nil {
 		t.Fatalf("Failed to insert test products: %v", err)
 	}
 
+	// Book the products' stock as opening balances, as for existing databases
+	if err := database.SeedInventoryLedger(); err != nil {
+		t.Fatalf("Failed to seed inventory ledger: %v", err)
+	}
+
 	// Insert test orders
 	_, err = database.DB.Exec(`
 		INSERT INTO orders (id, user_id, product_id, quantity, price, total, status, created_at, updated_at)
 		VALUES 
-		(1, 2, 1, 2, 99.99, 199.98, 'completed', datetime('now'), datetime('now'))
+		(1, 2, 1, 2, 9999, 19998, 'completed', datetime('now'), datetime('now'))
 	`)
 	if err != nil {
 		t.Fatalf("Failed to insert test orders: %v", err)
@@ -107,7 +112,7 @@ func GetTestUser(t *testing.T, userID int) (map[string]interface{}, error) {
 func GetTestProduct(t *testing.T, productID int) (map[string]interface{}, error) {
 	var id, stock, createdBy int
 	var name, description string
-	var price float64
+	var price int64 // In cents
 	var createdAt, updatedAt string
 
 	err := database.DB.QueryRow(
@@ -0,0 +1,80 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test vectors from RFC 4226 appendix D
+func TestHOTP_RFC4226(t *testing.T) {
+	key := []byte("12345678901234567890")
+	expected := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+
+	for counter, want := range expected {
+		assert.Equal(t, want, hotp(key, uint64(counter), 6))
+	}
+}
+
+// SHA1 test vectors from RFC 6238 appendix B
+func TestTOTP_RFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, hotp(key, Counter(time.Unix(tt.unix, 0)), 8))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+
+	code, err := Code(secret, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "050471", code)
+
+	counter, ok := Validate(secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, Counter(now), counter)
+
+	// Codes from the neighbouring steps are accepted, older ones are not
+	_, ok = Validate(secret, code, now.Add(Period))
+	assert.True(t, ok)
+	_, ok = Validate(secret, code, now.Add(3*Period))
+	assert.False(t, ok)
+
+	_, ok = Validate(secret, "000000", now)
+	assert.False(t, ok)
+	_, ok = Validate(secret, "12345", now)
+	assert.False(t, ok)
+	_, ok = Validate("not base32!", code, now)
+	assert.False(t, ok)
+}
+
+func TestGenerateSecretAndKeyURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	uri := KeyURI("SmarApp", "user@test.com", secret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/SmarApp:user@test.com?"))
+	assert.Contains(t, uri, "secret="+secret)
+	assert.Contains(t, uri, "issuer=SmarApp")
+}
@@ -31,6 +31,7 @@ type Client struct {
 	send     chan []byte
 	UserID   int
 	Username string
+	ReadOnly bool // Set for impersonated connections, which may not post as the user
 }
 
 func (c *Client) readPump() {
@@ -70,6 +71,11 @@ func (c *Client) readPump() {
 
 		log.Printf("Parsed message from client %s (ID: %d): %s", c.Username, c.UserID, msg.Message)
 
+		if c.ReadOnly {
+			log.Printf("Dropping message from read-only client %s (ID: %d)", c.Username, c.UserID)
+			continue
+		}
+
 		// Save and broadcast the message
 		if err := c.hub.SaveAndBroadcastMessage(c.UserID, c.Username, msg.Message); err != nil {
 			log.Printf("Error saving message: %v", err)
@@ -121,7 +127,7 @@ func (c *Client) writePump() {
 	}
 }
 
-func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request, userID int, username string) {
+func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request, userID int, username string, readOnly bool) {
 	log.Printf("ServeWS called for user %s (ID: %d)", username, userID)
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -136,6 +142,7 @@ func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request, userID int, usern
 		send:     make(chan []byte, 256),
 		UserID:   userID,
 		Username: username,
+		ReadOnly: readOnly,
 	}
 
 	log.Printf("Registering client %s (ID: %d)", username, userID)